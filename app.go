@@ -25,21 +25,27 @@ func runGame() {
 }
 
 func runStandalone() {
-	battleServer := NewBattleServer()
-	go battleServer.ListenTCP("127.0.0.1:9999")
+	mods := loadMods()
+	battleServer := NewBattleServer(mods)
+	battleServer.AllowAIToSeeThroughFog(true) // the AI client runs in this process
+	transport := game.NewMemoryTransport()
+	go battleServer.Serve(transport)
 
-	dummyClient := game.NewDummyClient("127.0.0.1:9999")
-	dummyClient.CreateGameSequence()
+	dummyClient := game.NewDummyClient(transport, mods)
+	dummyClient.CreateGameSequence(game.AISeat{Difficulty: game.DefaultAIDifficulty, Personality: game.DefaultAIPersonality})
 
 	mainthread.Call(func() {
-		connection := game.NewTCPConnection("127.0.0.1:9999")
+		connection := game.NewConnection(transport)
+		connection.SetModSet(mods)
 		terminalClient(connection, "join")
 	})
 }
 
 func runNetworkClient(createOrJoin string, endpoint string) {
+	mods := loadMods()
 	mainthread.Call(func() {
 		connection := game.NewTCPConnection(endpoint)
+		connection.SetModSet(mods)
 		terminalClient(connection, createOrJoin)
 	})
 }
@@ -69,19 +75,38 @@ func startGraphicalClient(con *game.ServerConnection, gameInfo game.GameStartedM
 
 	gameClient.Run()
 }
+
+func startSpectatorClient(con *game.ServerConnection, spectatorID uint64, state game.SpectatorStateMessage, settings client.ClientSettings) {
+	gameClient := client.NewBattleGame(con, state.GameInfo(spectatorID), settings)
+	gameClient.SetSpectating()
+	gameClient.LoadMapBlocks()
+
+	gameClient.OnSpectatorState(state)
+
+	gameClient.SwitchToWaitForEvents()
+
+	gameClient.Run()
+}
 func terminalClient(con *game.ServerConnection, argOne string) {
 	loginSuccess := false
 	createSuccess := false
 	joinSuccess := false
 	factionSuccess := false
 	unitSelectionSuccess := false
+	spectateSuccess := false
+	isSpectator := false
 	gameStarted := false
+	var ownID uint64
 	var gameInfo game.GameStartedMessage
+	var spectatorState game.SpectatorStateMessage
+	gameListReceived := false
+	var gameList game.GameListMessage
 	con.SetEventHandler(func(msgReceived game.StringMessage) {
 		if msgReceived.MessageType == "LoginResponse" {
-			var msg game.ActionResponse
+			var msg game.LoginResponse
 			if util.FromJson(msgReceived.Message, &msg) {
 				if msg.Success {
+					ownID = msg.UserID
 					loginSuccess = true
 				}
 				println(fmt.Sprintf("[Client] Login response: %s", msg.Message))
@@ -102,6 +127,14 @@ func terminalClient(con *game.ServerConnection, argOne string) {
 				}
 				println(fmt.Sprintf("[Client] Join game response: %s", msg.Message))
 			}
+		} else if msgReceived.MessageType == "LoadGameResponse" {
+			var msg game.ActionResponse
+			if util.FromJson(msgReceived.Message, &msg) {
+				if msg.Success {
+					joinSuccess = true
+				}
+				println(fmt.Sprintf("[Client] Load game response: %s", msg.Message))
+			}
 		} else if msgReceived.MessageType == "SelectFactionResponse" {
 			var msg game.ActionResponse
 			if util.FromJson(msgReceived.Message, &msg) {
@@ -118,10 +151,35 @@ func terminalClient(con *game.ServerConnection, argOne string) {
 				}
 				println(fmt.Sprintf("[Client] Select units response: %s", msg.Message))
 			}
+		} else if msgReceived.MessageType == "SpectateGameResponse" {
+			var msg game.ActionResponse
+			if util.FromJson(msgReceived.Message, &msg) {
+				println(fmt.Sprintf("[Client] Spectate game response: %s", msg.Message))
+			}
 		} else if msgReceived.MessageType == "GameStarted" {
 			util.LogGameInfo("Game started!")
 			gameStarted = true
 			util.FromJson(msgReceived.Message, &gameInfo)
+			for _, playerID := range gameInfo.FogImmunePlayers {
+				println(fmt.Sprintf("[Client] %s is an AI that sees all units through the fog", gameInfo.PlayerNameMap[playerID]))
+			}
+		} else if msgReceived.MessageType == "GameList" {
+			if util.FromJson(msgReceived.Message, &gameList) {
+				gameListReceived = true
+			}
+		} else if msgReceived.MessageType == "LobbyUpdate" {
+			var msg game.LobbyUpdateMessage
+			if util.FromJson(msgReceived.Message, &msg) {
+				if msg.Removed {
+					println(fmt.Sprintf("[Client] Game '%s' is no longer available", msg.Game.GameID))
+				} else {
+					println(fmt.Sprintf("[Client] Game '%s' now has %d/%d players", msg.Game.GameID, msg.Game.Players, msg.Game.PlayersNeeded))
+				}
+			}
+		} else if msgReceived.MessageType == "SpectatorState" {
+			if util.FromJson(msgReceived.Message, &spectatorState) {
+				spectateSuccess = true
+			}
 		} else {
 			println(fmt.Sprintf("[Client] Unhandled message type: %s", msgReceived.MessageType))
 		}
@@ -130,25 +188,25 @@ func terminalClient(con *game.ServerConnection, argOne string) {
 	createGameSequence := func() {
 		util.MustSend(con.Login("creator"))
 		util.WaitForTrue(&loginSuccess)
-		util.MustSend(con.CreateGame("map", "fx's test game", game.NewRandomDeathmatch(), true))
+		util.MustSend(con.CreateGame("map", "fx's test game", game.NewRandomDeathmatch(), true, 0, game.DefaultRulesetName, nil))
 		util.WaitForTrue(&createSuccess)
 		util.MustSend(con.SelectFaction("X-Com"))
 		util.WaitForTrue(&factionSuccess)
 		util.MustSend(con.SelectUnits([]game.UnitChoice{
 			{
-				UnitTypeID: 0,
+				UnitType:   "Soldier",
 				Name:       "Jimmy",
 				Weapon:     "Mossberg 500",
 				Items: []string{"Smoke Grenade"},
 			},
 			{
-				UnitTypeID: 0,
+				UnitType:   "Soldier",
 				Name:       "Bimmy",
 				Weapon:     "Steyr SSG 69",
 				Items: []string{"Frag Grenade"},
 			},
 			{
-				UnitTypeID: 0,
+				UnitType:   "Soldier",
 				Name:       "Timmy",
 				Weapon:     "M16 Rifle",
 				Items: []string{"Poison Grenade"},
@@ -156,29 +214,27 @@ func terminalClient(con *game.ServerConnection, argOne string) {
 		}))
 		util.WaitForTrue(&unitSelectionSuccess)
 	}
-	joinGameSequence := func() {
-		util.MustSend(con.Login("joiner"))
-		util.WaitForTrue(&loginSuccess)
-		util.MustSend(con.JoinGame("fx's test game"))
+	joinGame := func(gameID string) {
+		util.MustSend(con.JoinGame(gameID))
 		util.WaitForTrue(&joinSuccess)
 		util.MustSend(con.SelectFaction("Deep Ones"))
 		util.WaitForTrue(&factionSuccess)
 		util.MustSend(con.SelectUnits([]game.UnitChoice{
 			{
-				UnitTypeID: 2,
+				UnitType:   "Deep One",
 				Name:       "Gnarg",
 				Weapon: "M1911 Pistol",
 				Items:  []string{"Frag Grenade"},
 			},
 
 			{
-				UnitTypeID: 2,
+				UnitType:   "Deep One",
 				Name:       "Gorn",
 				Weapon: "M16 Rifle",
 				Items:  []string{"Poison Grenade"},
 			},
 			{
-				UnitTypeID: 2,
+				UnitType:   "Deep One",
 				Name:       "Grimbel",
 				Weapon:     "Mossberg 500",
 				Items: []string{"Smoke Grenade"},
@@ -186,12 +242,62 @@ func terminalClient(con *game.ServerConnection, argOne string) {
 		}))
 		util.WaitForTrue(&unitSelectionSuccess)
 	}
+	joinGameSequence := func() {
+		util.MustSend(con.Login("joiner"))
+		util.WaitForTrue(&loginSuccess)
+		joinGame("fx's test game")
+	}
+	browseGamesSequence := func() {
+		util.MustSend(con.Login("joiner"))
+		util.WaitForTrue(&loginSuccess)
+		util.MustSend(con.ListGames(true))
+		util.WaitForTrue(&gameListReceived)
+		if len(gameList.Games) == 0 {
+			println("[Client] No open games, joining the default game")
+			joinGame("fx's test game")
+			return
+		}
+		items := make([]TextItem, 0, len(gameList.Games))
+		for _, entry := range gameList.Games {
+			gameID := entry.GameID
+			items = append(items, TextItem{
+				Text: fmt.Sprintf("%s (%s, %s) by %s - %d/%d players", entry.GameID, entry.Map, entry.Scenario, entry.Creator, entry.Players, entry.PlayersNeeded),
+				Func: func() { joinGame(gameID) },
+			})
+		}
+		textMenu(items)
+	}
+	// a saved game continues once every player took the old seat again, under the same name as before
+	loadGameSequence := func() {
+		util.MustSend(con.Login("creator"))
+		util.WaitForTrue(&loginSuccess)
+		util.MustSend(con.LoadGame("fx's test game"))
+		util.WaitForTrue(&joinSuccess)
+	}
+	rejoinGameSequence := func() {
+		util.MustSend(con.Login("joiner"))
+		util.WaitForTrue(&loginSuccess)
+		util.MustSend(con.JoinGame("fx's test game"))
+		util.WaitForTrue(&joinSuccess)
+	}
+	spectateGameSequence := func() {
+		isSpectator = true
+		util.MustSend(con.Login("spectator"))
+		util.WaitForTrue(&loginSuccess)
+		util.MustSend(con.SpectateGame("fx's test game"))
+	}
 
 	// get first command line argument as string
 	if argOne == "create" {
 		createGameSequence()
 	} else if argOne == "join" {
 		joinGameSequence()
+	} else if argOne == "spectate" {
+		spectateGameSequence()
+	} else if argOne == "load" {
+		loadGameSequence()
+	} else if argOne == "rejoin" {
+		rejoinGameSequence()
 	} else {
 		textMenu([]TextItem{
 			{
@@ -202,9 +308,32 @@ func terminalClient(con *game.ServerConnection, argOne string) {
 				Text: "Join Game",
 				Func: joinGameSequence,
 			},
+			{
+				Text: "Browse Games",
+				Func: browseGamesSequence,
+			},
+			{
+				Text: "Spectate Game",
+				Func: spectateGameSequence,
+			},
+			{
+				Text: "Load Saved Game",
+				Func: loadGameSequence,
+			},
+			{
+				Text: "Rejoin Saved Game",
+				Func: rejoinGameSequence,
+			},
 		})
 	}
 
+	if isSpectator {
+		util.LogGameInfo("[Client] Waiting for the game state...")
+		util.WaitForTrue(&spectateSuccess)
+		startSpectatorClient(con, ownID, spectatorState, client.NewClientSettingsFromFile("settings.json"))
+		return
+	}
+
 	util.LogGameInfo("[Client] Waiting for game to start...")
 	util.WaitForTrue(&gameStarted)
 	util.LogGameInfo("[Client] Game started!")
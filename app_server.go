@@ -3,7 +3,33 @@
 
 package main
 
+import (
+	"fmt"
+	"github.com/memmaker/battleground/game"
+	"os"
+)
+
 func main() {
-	server := NewBattleServer()
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		if err := runSimulation(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	server := NewBattleServer(loadMods())
+	if len(os.Args) == 3 && os.Args[1] == "replay" {
+		replay, err := game.LoadReplay(os.Args[2])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err = server.PlayReplay(replay); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Replay of game '%s' ends in the recorded state\n", replay.GameID)
+		return
+	}
 	server.ListenTCP("0.0.0.0:9999")
 }
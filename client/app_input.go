@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/go-gl/glfw/v3.3/glfw"
+	"github.com/memmaker/battleground/engine/util"
 	"github.com/memmaker/battleground/engine/voxel"
 	"log"
 	"os"
@@ -104,6 +105,9 @@ func (a *BattleClient) handleKeyEvents(key glfw.Key, scancode int, action glfw.A
 		}
 
 	*/
+	if key == glfw.KeyF5 && action == glfw.Press {
+		util.MustSend(a.server.SaveGame())
+	}
 	if key == glfw.KeyF6 && action == glfw.Press {
 		a.ToggleFullscren()
 	}
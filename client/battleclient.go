@@ -200,7 +200,7 @@ func NewBattleGame(con *game.ServerConnection, initInfos game.GameStartedMessage
 		},
 		aspectRatio: float32(usedWidth) / float32(usedHeight),
 	}
-	myApp.GameClient = game.NewGameClient[*Unit](initInfos, myApp.CreateClientUnit)
+	myApp.GameClient = game.NewGameClient[*Unit](initInfos, con.NewAssets(), myApp.CreateClientUnit)
 	myApp.GameClient.SetEnvironment("GL-Client")
 	myApp.GameClient.SetOnTargetedEffect(myApp.OnTargetedEffect)
 	myApp.GameClient.SetOnNotification(myApp.Print)
@@ -463,7 +463,7 @@ func (a *BattleClient) drawDefaultShader(cam util.Camera) {
 	a.defaultShader.SetUniformAttr(ShaderDrawMode, ShaderDrawTexturedQuads)
 
 	for _, unit := range a.GetAllClientUnits() { // TODO: view frustum culling
-		if a.UnitIsVisibleToPlayer(a.GetControllingUserID(), unit.UnitID()) {
+		if a.IsSpectating() || a.UnitIsVisibleToPlayer(a.GetControllingUserID(), unit.UnitID()) {
 			unit.Draw(a.defaultShader)
 
 		}
@@ -811,6 +811,11 @@ func (a *BattleClient) OnServerMessage(msgType, messageAsJson string) {
 		if util.FromJson(messageAsJson, &msg) {
 			a.OnTargetedUnitActionResponse(msg)
 		}
+	case "SaveGameResponse":
+		var msg game.ActionResponse
+		if util.FromJson(messageAsJson, &msg) {
+			a.Print(msg.Message)
+		}
 	case "NextPlayer":
 		var msg game.NextPlayerMessage
 		if util.FromJson(messageAsJson, &msg) {
@@ -821,6 +826,50 @@ func (a *BattleClient) OnServerMessage(msgType, messageAsJson string) {
 		if util.FromJson(messageAsJson, &msg) {
 			a.OnGameOver(msg)
 		}
+	case "GameResumed":
+		var msg game.GameResumedMessage
+		if util.FromJson(messageAsJson, &msg) {
+			a.OnGameResumed(msg)
+		}
+	case "SpectatorState":
+		var msg game.SpectatorStateMessage
+		if util.FromJson(messageAsJson, &msg) {
+			a.OnSpectatorState(msg)
+		}
+	case "BlockStatesChanged":
+		var msg game.BlockStatesChangedMessage
+		if util.FromJson(messageAsJson, &msg) {
+			a.afterProjectilesArrived(func(deltaTime float64) {
+				a.OnBlockStatesChanged(msg)
+			})
+		}
+	case "BlocksCollapsed":
+		var msg game.BlocksCollapsedMessage
+		if util.FromJson(messageAsJson, &msg) {
+			a.OnBlocksCollapsed(msg)
+		}
+	case "TurnTimeWarning":
+		var msg game.TurnTimeWarningMessage
+		if util.FromJson(messageAsJson, &msg) {
+			a.OnTurnTimeWarning(msg)
+		}
+	case "ChatLine":
+		var msg game.ChatLineMessage
+		if util.FromJson(messageAsJson, &msg) {
+			a.OnChatLine(msg)
+		}
+	case "ChatHistory":
+		var msg game.ChatHistoryMessage
+		if util.FromJson(messageAsJson, &msg) {
+			for _, line := range msg.Lines {
+				a.OnChatLine(line)
+			}
+		}
+	case "PlayerConnection":
+		var msg game.PlayerConnectionMessage
+		if util.FromJson(messageAsJson, &msg) {
+			a.OnPlayerConnection(msg)
+		}
 	case "Reload":
 		var msg game.UnitMessage
 		if util.FromJson(messageAsJson, &msg) {
@@ -992,9 +1041,9 @@ func (a *BattleClient) handleProjectileArrival(attackerUnit *game.UnitInstance,
 		a.GameInstance.ApplyTargetedEffectFromMessage(projectile.InsteadOfDamage)
 	}
 
-	for _, damagedBlock := range projectile.BlocksHit {
-		blockDef := a.GetBlockDefAt(damagedBlock)
-		blockDef.OnDamageReceived(damagedBlock, projectile.Damage)
+	for _, blockHit := range projectile.BlocksHit {
+		blockDef := a.GetBlockDefAt(blockHit.Position)
+		blockDef.OnDamageReceived(blockHit.Position, blockHit.Damage)
 	}
 	return
 }
@@ -1300,6 +1349,16 @@ func (a *BattleClient) OnNextPlayer(msg game.NextPlayerMessage) {
 
 	*/
 
+	if msg.PreviousTimedOut {
+		a.Print("The time for the last turn ran out")
+	}
+	if msg.SecondsLeft > 0 {
+		a.Print(fmt.Sprintf("%0.0f seconds for this turn", msg.SecondsLeft))
+	}
+	if a.IsSpectating() {
+		a.SwitchToWaitForEvents()
+		return
+	}
 	if msg.YourTurn {
 		a.smoker.NextTurn()
 
@@ -1322,6 +1381,41 @@ func (a *BattleClient) OnNextPlayer(msg game.NextPlayerMessage) {
 	}
 }
 
+func (a *BattleClient) OnGameResumed(msg game.GameResumedMessage) {
+	a.GameClient.OnGameResumed(msg)
+	if msg.AwaitingMapLoaded {
+		util.MustSend(a.server.MapLoaded())
+		a.SwitchToWaitForEvents()
+	} else if msg.AwaitingDeployment {
+		a.OnStartDeployment()
+	} else if msg.YourTurn {
+		a.SwitchToUnitNoCameraMovement(a.FirstUnit())
+	} else {
+		a.SwitchToWaitForEvents()
+	}
+	a.FlashText("RECONNECTED", 2)
+}
+
+func (a *BattleClient) OnTurnTimeWarning(msg game.TurnTimeWarningMessage) {
+	if msg.YourTurn {
+		a.FlashText(fmt.Sprintf("%0.0f SECONDS LEFT", msg.SecondsLeft), 2)
+	} else {
+		a.Print(fmt.Sprintf("%0.0f seconds left for the other player", msg.SecondsLeft))
+	}
+}
+
+func (a *BattleClient) OnChatLine(msg game.ChatLineMessage) {
+	a.Print(fmt.Sprintf("%s: %s", msg.SenderName, msg.Text))
+}
+
+func (a *BattleClient) OnPlayerConnection(msg game.PlayerConnectionMessage) {
+	if msg.Connected {
+		a.Print(fmt.Sprintf("%s reconnected", msg.Name))
+	} else {
+		a.Print(fmt.Sprintf("%s lost the connection\nwaiting %d seconds", msg.Name, msg.GracePeriodSeconds))
+	}
+}
+
 func (a *BattleClient) EndTurn() {
 	util.MustSend(a.server.EndTurn())
 	a.SwitchToWaitForEvents()
@@ -1375,6 +1469,48 @@ func (a *BattleClient) OnGameOver(msg game.GameOverMessage) {
 	a.FlashText(printedMessage, 3)
 }
 
+// OnBlocksCollapsed lets the structure come down once the projectiles that destroyed its support have arrived.
+func (a *BattleClient) OnBlocksCollapsed(msg game.BlocksCollapsedMessage) {
+	a.afterProjectilesArrived(func(deltaTime float64) {
+		a.collapseBlocks(msg)
+	})
+}
+
+// afterProjectilesArrived delays the changes of the map the server sent together with the shots that caused them.
+func (a *BattleClient) afterProjectilesArrived(f func(deltaTime float64)) {
+	timeSpent := float64(0)
+	a.scheduleWaitForCondition(func(deltaTime float64) bool {
+		timeSpent += deltaTime
+		return timeSpent >= 0.2 && len(a.flyingObjects) == 0
+	}, f)
+}
+
+func (a *BattleClient) collapseBlocks(msg game.BlocksCollapsedMessage) {
+	for _, pos := range msg.Blocks {
+		debrisProps := a.particleProps[ParticlesBulletImpact].WithOrigin(pos.ToBlockCenterVec3())
+		a.impactParticles.Emit(debrisProps, 3)
+	}
+	a.GameClient.OnBlocksCollapsed(msg)
+
+	fallDirection := mgl32.Vec3{0, -1, 0}
+	for _, hit := range msg.Units {
+		unit, known := a.GetClientUnit(hit.UnitID)
+		if !known || hit.Damage <= 0 {
+			continue
+		}
+		if hit.Lethal {
+			unit.PlayDeathAnimation(fallDirection, hit.BodyPart)
+			a.Print(fmt.Sprintf("%s was killed by the collapse.", unit.GetName()))
+		} else {
+			unit.PlayHitAnimation(fallDirection, hit.BodyPart)
+			a.Print(fmt.Sprintf("%s took %d damage from the collapse.", unit.GetName(), hit.Damage))
+		}
+		if a.selectedUnit == unit {
+			a.UpdateActionbarFor(unit)
+		}
+	}
+}
+
 func (a *BattleClient) IsUnitOwnedByClient(unitID uint64) bool {
 	unit, _ := a.GetClientUnit(unitID)
 	return unit != nil && unit.IsUserControlled()
@@ -35,7 +35,7 @@ func (g *GameStateDeployment) isPlacementAllowed(targetPos voxel.Int3, currentUn
 	vMap := g.engine.GetVoxelMap()
 	placeable, _ := vMap.IsUnitPlaceable(currentUnit, targetPos)
 
-	return placeable && isSpawnPos
+	return placeable && isSpawnPos && g.engine.HasGroundUnder(currentUnit.UnitInstance, targetPos)
 }
 
 func (g *GameStateDeployment) OnMouseReleased(x float64, y float64) {
@@ -36,10 +36,17 @@ func (g *GameStateEditMap) OnKeyPressed(key glfw.Key) {
 		g.PlaceBlockAtCurrentSelection()
 	} else if key == glfw.KeyR {
 		g.engine.RemoveBlockAndRemesh()
+	} else if key == glfw.KeyT {
+		g.turnBlockAtCurrentSelection()
 	} else if key == glfw.KeyF5 {
 		g.engine.SaveMapToDisk()
 	} else if key == glfw.KeyF9 {
-		g.engine.GetVoxelMap().LoadFromSource(g.engine.GetAssets().LoadMap("map"))
+		voxelMap := g.engine.GetVoxelMap()
+		if _, err := voxelMap.LoadFromSource(g.engine.GetAssets().LoadMap("map")); err != nil {
+			g.engine.Print(fmt.Sprintf("Could not load the map: %s", err))
+		} else {
+			voxelMap.SetBlockNames(g.engine.GetBlockLibrary().BlockNames())
+		}
 	} else if key == glfw.KeyF1 {
 		g.switchToBlocks()
 	} else if key == glfw.KeyF2 {
@@ -81,6 +88,20 @@ func (g *GameStateEditMap) PlaceBlockAtCurrentSelection() {
 	g.engine.PlaceBlock(previousGridPosition, voxel.NewBlock(g.blockTypeToPlace))
 }
 
+// turnBlockAtCurrentSelection rotates the block under the cursor a quarter turn clockwise.
+func (g *GameStateEditMap) turnBlockAtCurrentSelection() {
+	if g.engine.lastHitInfo == nil {
+		return
+	}
+	voxelMap := g.engine.GetVoxelMap()
+	pos := g.engine.lastHitInfo.CollisionGridPosition
+	block := voxelMap.GetGlobalBlock(pos.X, pos.Y, pos.Z)
+	if block == nil || block.IsAir() {
+		return
+	}
+	voxelMap.SetBlockState(pos, block.State.WithOrientation(block.State.Orientation()+1))
+}
+
 func (g *GameStateEditMap) placeBlocksAtRange(selection []voxel.Int3) {
 	for _, pos := range selection {
 		g.engine.PlaceBlock(pos, voxel.NewBlock(g.blockTypeToPlace))
@@ -79,7 +79,7 @@ func (g *GameStateFreeAim) updateTargetInfo() {
 	//rayStart := g.engine.fpsCamera.GetPosition()
 	//rayEnd := g.engine.fpsCamera.GetPosition().AddFlat(g.engine.fpsCamera.GetForward().Mul(100))
 
-	rayStart, rayEnd := g.engine.fpsCamera.GetRandomRayInCircleFrustum(1.0)
+	rayStart, rayEnd := g.engine.fpsCamera.GetRandomRayInCircleFrustum(g.engine.GetRandom(), 1.0)
 	hitInfo := g.engine.RayCastFreeAim(rayStart, rayEnd, g.engine.selectedUnit.UnitInstance)
 	//aimString := g.engine.fpsCamera.DebugAim()
 	if hitInfo.HitUnit() {
@@ -7,13 +7,16 @@ import (
 	"github.com/memmaker/battleground/engine/util"
 	"github.com/memmaker/battleground/engine/voxel"
 	"github.com/memmaker/battleground/game"
+	"slices"
 )
 
 type GameStateUnit struct {
 	IsoMovementState
 	noCameraMovement bool
 	moveAction       *game.ActionMove
+	waypoints        []voxel.Int3 // waypoints are added with shift + click, the route goes through them in order
 	lastCursorPos    voxel.Int3
+	warnedTargets    []voxel.Int3 // a route through hazards is only sent when it is clicked twice
 }
 
 func (g *GameStateUnit) OnMouseReleased(x float64, y float64) {
@@ -30,7 +33,7 @@ func NewGameStateUnit(engine *BattleClient, unit *Unit) *GameStateUnit {
 		IsoMovementState: IsoMovementState{
 			engine: engine,
 		},
-		moveAction: game.NewActionMove(engine.GetVoxelMap(), unit.UnitInstance),
+		moveAction: game.NewActionMove(engine.GetVoxelMap(), unit.UnitInstance, engine.GameInstance),
 	}
 }
 func NewGameStateUnitNoCamMove(engine *BattleClient, unit *Unit) *GameStateUnit {
@@ -39,7 +42,7 @@ func NewGameStateUnitNoCamMove(engine *BattleClient, unit *Unit) *GameStateUnit
 		IsoMovementState: IsoMovementState{
 			engine: engine,
 		},
-		moveAction:       game.NewActionMove(engine.GetVoxelMap(), unit.UnitInstance),
+		moveAction:       game.NewActionMove(engine.GetVoxelMap(), unit.UnitInstance, engine.GameInstance),
 		noCameraMovement: false,
 	}
 }
@@ -51,6 +54,11 @@ func (g *GameStateUnit) OnKeyPressed(key glfw.Key) {
 		g.nextUnit()
 		return
 	}
+	if key == glfw.KeyBackspace && len(g.waypoints) > 0 {
+		g.waypoints = g.waypoints[:len(g.waypoints)-1]
+		g.updateIndicators(g.lastCursorPos)
+		return
+	}
 	if key == glfw.KeyF1 {
 		g.engine.showDebugInfo = !g.engine.showDebugInfo
 		if !g.engine.showDebugInfo {
@@ -84,8 +92,10 @@ func (g *GameStateUnit) Init(wasPopped bool) {
 	g.engine.unitSelector.Show()
 
 	if !wasPopped {
+		g.waypoints = nil
+		g.warnedTargets = nil
 		if g.engine.selectedUnit.CanMove() {
-			g.moveAction = game.NewActionMove(g.engine.GetVoxelMap(), g.engine.selectedUnit.UnitInstance)
+			g.moveAction = game.NewActionMove(g.engine.GetVoxelMap(), g.engine.selectedUnit.UnitInstance, g.engine.GameInstance)
 			validTargets := g.moveAction.GetValidTargets()
 			if len(validTargets) > 0 {
 				g.engine.SetHighlightsForMovement(g.moveAction, g.engine.selectedUnit, validTargets)
@@ -115,11 +125,41 @@ func (g *GameStateUnit) OnMouseClicked(x float64, y float64) {
 			util.LogGlobalUnitDebug(fmt.Sprintf("[GameStateUnit] Selected unit at %s", g.engine.selectedUnit.GetBlockPosition().ToString()))
 			g.Init(false)
 		}
-	} else if g.moveAction.IsValidTarget(groundBlockPos) {
-		util.MustSend(g.engine.server.TargetedUnitAction(g.engine.selectedUnit.UnitID(), g.moveAction.GetName(), []voxel.Int3{groundBlockPos}))
+	} else if targets := g.routeTo(groundBlockPos); targets != nil {
+		if g.engine.Window.GetKey(glfw.KeyLeftShift) == glfw.Press && len(targets) < game.MaxMoveWaypoints {
+			g.waypoints = targets
+			return
+		}
+		if g.warnAboutHazards(targets) {
+			return
+		}
+		g.waypoints = nil
+		g.warnedTargets = nil
+		util.MustSend(g.engine.server.TargetedUnitAction(g.engine.selectedUnit.UnitID(), g.moveAction.GetName(), targets))
 	}
 }
 
+// routeTo returns the waypoints plus the target, if the unit can move there.
+func (g *GameStateUnit) routeTo(target voxel.Int3) []voxel.Int3 {
+	targets := append(slices.Clone(g.waypoints), target)
+	if _, _, problem := g.moveAction.GetRoute(targets); problem != "" {
+		return nil
+	}
+	return targets
+}
+
+// warnAboutHazards tells the player about the hazards on the route, the first time it is clicked.
+func (g *GameStateUnit) warnAboutHazards(targets []voxel.Int3) bool {
+	route, _, _ := g.moveAction.GetRoute(targets)
+	hazards := game.DescribeHazards(g.moveAction.GetHazards(route))
+	if hazards == "" || slices.Equal(targets, g.warnedTargets) {
+		return false
+	}
+	g.warnedTargets = targets
+	g.engine.Print(fmt.Sprintf("Route crosses %s - click again to move", hazards))
+	return true
+}
+
 func (g *GameStateUnit) OnMouseMoved(oldX float64, oldY float64, newX float64, newY float64) {
 	g.IsoMovementState.OnMouseMoved(oldX, oldY, newX, newY)
 	cursorPos := g.engine.selector.GetBlockPosition()
@@ -143,11 +183,15 @@ func (g *GameStateUnit) updateIndicators(cursorPos voxel.Int3) {
 }
 func (g *GameStateUnit) updatePathIndicator(cursorPos voxel.Int3) bool {
 	unit := g.engine.selectedUnit
-	if unit.GetBlockPosition() == cursorPos {
+	if unit.GetBlockPosition() == cursorPos && len(g.waypoints) == 0 {
 		return false
 	}
-	path := g.moveAction.GetPath(cursorPos)
-	if len(path) == 0 {
+	path, _, problem := g.moveAction.GetRoute(append(slices.Clone(g.waypoints), cursorPos))
+	if problem != "" {
+		// still show the planned part of the route
+		path, _, problem = g.moveAction.GetRoute(g.waypoints)
+	}
+	if problem != "" {
 		return false
 	}
 	// prepend current position
@@ -0,0 +1,64 @@
+package path
+
+import (
+	"container/heap"
+	"slices"
+)
+
+// AStarSource is a DijkstraSource that can also estimate the cost to the goal. The estimate must never be
+// higher than the real cost, otherwise the path found may not be the cheapest one.
+type AStarSource[T any] interface {
+	DijkstraSource[T]
+	GetHeuristic(node T, goal T) float64
+}
+
+// AStar finds the cheapest path from start to goal that costs at most maxCost. The path does not contain
+// the start, found is false if there is no such path.
+func AStar[T comparable](start, goal T, maxCost float64, dataSource AStarSource[T]) (path []T, cost float64, found bool) {
+	dist := map[T]float64{start: 0}
+	prev := make(map[T]T)
+	closed := make(map[T]bool)
+	existingNodes := make(map[T]*PqItem[T])
+
+	startNode := NewNode(start)
+	startNode.SetPriority(dataSource.GetHeuristic(start, goal))
+	existingNodes[start] = startNode
+	Q := NewPriorityQueue([]PathNode[T]{startNode})
+	for Q.Len() > 0 {
+		current := heap.Pop(&Q).(PathNode[T]).GetValue()
+		if current == goal {
+			return unwindPath(prev, start, goal), dist[goal], true
+		}
+		closed[current] = true
+		for _, neighbor := range dataSource.GetNeighbors(current) {
+			if closed[neighbor] {
+				continue
+			}
+			neighborDist := dist[current] + dataSource.GetCost(current, neighbor)
+			if oldDist, known := dist[neighbor]; neighborDist > maxCost || (known && neighborDist >= oldDist) {
+				continue
+			}
+			dist[neighbor] = neighborDist
+			prev[neighbor] = current
+			priority := neighborDist + dataSource.GetHeuristic(neighbor, goal)
+			if existingNode, queued := existingNodes[neighbor]; queued && existingNode.GetIndex() >= 0 {
+				Q.update(existingNode, priority)
+			} else {
+				neighborNode := NewNode(neighbor)
+				neighborNode.SetPriority(priority)
+				existingNodes[neighbor] = neighborNode
+				heap.Push(&Q, neighborNode)
+			}
+		}
+	}
+	return nil, 0, false
+}
+
+func unwindPath[T comparable](prev map[T]T, start, goal T) []T {
+	var path []T
+	for current := goal; current != start; current = prev[current] {
+		path = append(path, current)
+	}
+	slices.Reverse(path)
+	return path
+}
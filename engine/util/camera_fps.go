@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"github.com/go-gl/mathgl/mgl32"
 	"math"
-	"math/rand"
 )
 
 type FPSCamera struct {
@@ -94,12 +93,13 @@ func (c *FPSCamera) SetInvertedY(inverted bool) {
 	c.invertedY = inverted
 }
 
-func (c *FPSCamera) GetRandomRayInCircleFrustum(accuracy float64) (mgl32.Vec3, mgl32.Vec3) {
-	randX := rand.Float64()*2.0 - 1.0
-	randY := rand.Float64()*2.0 - 1.0
+// GetRandomRayInCircleFrustum returns a ray that deviates from the center of the view by up to 1 - accuracy.
+func (c *FPSCamera) GetRandomRayInCircleFrustum(random *Random, accuracy float64) (mgl32.Vec3, mgl32.Vec3) {
+	randX := random.Float64()*2.0 - 1.0
+	randY := random.Float64()*2.0 - 1.0
 	randDir := mgl32.Vec2{float32(randX), float32(randY)}.Normalize()
 	gapToPerfection := 1.0 - accuracy
-	randomPercent := rand.Float64()
+	randomPercent := random.Float64()
 	accuracyAchieved := accuracy + (gapToPerfection * randomPercent)
 	return c.GetRayInCircleFrustum(randDir, accuracyAchieved)
 }
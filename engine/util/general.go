@@ -2,6 +2,7 @@ package util
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 )
@@ -21,7 +22,16 @@ func WaitForTrue(success *bool) {
 	}
 }
 
+// ErrNotSent is wrapped by the errors of commands that could not be sent because the connection is down for the
+// moment. The client is trying to get its session back, the server then sends a fresh snapshot.
+var ErrNotSent = errors.New("not sent, the connection is down")
+
+// MustSend panics if a command could not be sent, unless the connection is only down for the moment.
 func MustSend(err error) {
+	if errors.Is(err, ErrNotSent) {
+		println(err.Error())
+		return
+	}
 	if err != nil {
 		panic(fmt.Sprintf("FATAL CONNECTION ERROR: %s", err.Error()))
 	}
@@ -3,7 +3,6 @@ package util
 import (
 	"github.com/memmaker/battleground/engine/voxel"
 	"math"
-	"math/rand"
 
 	"github.com/go-gl/mathgl/mgl32"
 )
@@ -190,8 +189,8 @@ func EaseOutSine(x float64) float64 {
 	return math.Sin((x * math.Pi) / 2)
 }
 
-func RandomChoice(choices []voxel.Int3) voxel.Int3 {
-	return choices[rand.Intn(len(choices))]
+func RandomChoice(random *Random, choices []voxel.Int3) voxel.Int3 {
+	return choices[random.Intn(len(choices))]
 }
 
 /*
@@ -0,0 +1,57 @@
+package util
+
+import (
+	"math/rand"
+)
+
+// countingSource remembers how many numbers were drawn, so a generator can be brought back to the same point.
+type countingSource struct {
+	source rand.Source64
+	draws  uint64
+}
+
+func (s *countingSource) Int63() int64 {
+	s.draws++
+	return s.source.Int63()
+}
+
+func (s *countingSource) Uint64() uint64 {
+	s.draws++
+	return s.source.Uint64()
+}
+
+func (s *countingSource) Seed(seed int64) {
+	s.source.Seed(seed)
+	s.draws = 0
+}
+
+// Random is a seeded random number generator. The same seed and the same calls always give the same numbers.
+// It is not safe for concurrent use.
+type Random struct {
+	*rand.Rand
+	seed   int64
+	source *countingSource
+}
+
+func NewRandom(seed int64) *Random {
+	source := &countingSource{source: rand.NewSource(seed).(rand.Source64)}
+	return &Random{Rand: rand.New(source), seed: seed, source: source}
+}
+
+// RestoreRandom returns a generator that continues where one with the same seed stopped after the given draws.
+func RestoreRandom(seed int64, draws uint64) *Random {
+	random := NewRandom(seed)
+	for i := uint64(0); i < draws; i++ {
+		random.source.source.Int63()
+	}
+	random.source.draws = draws
+	return random
+}
+
+func (r *Random) Seed() int64 {
+	return r.seed
+}
+
+func (r *Random) Draws() uint64 {
+	return r.source.draws
+}
@@ -0,0 +1,20 @@
+package util
+
+import "testing"
+
+func TestRestoredRandomContinuesTheSequence(t *testing.T) {
+	random := NewRandom(42)
+	for i := 0; i < 10; i++ {
+		random.Float64()
+		random.Intn(6)
+	}
+	restored := RestoreRandom(random.Seed(), random.Draws())
+	for i := 0; i < 10; i++ {
+		if want, got := random.Float64(), restored.Float64(); want != got {
+			t.Fatalf("draw %d: got %f, want %f", i, got, want)
+		}
+	}
+	if restored.Draws() != random.Draws() {
+		t.Errorf("got %d draws, want %d", restored.Draws(), random.Draws())
+	}
+}
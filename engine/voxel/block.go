@@ -4,6 +4,7 @@ type Block struct {
 	ID       byte
 	occupant MapObject
 	lightLevel byte
+	State    BlockState
 }
 
 const EMPTYBLOCK = 0
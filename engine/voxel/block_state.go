@@ -0,0 +1,64 @@
+package voxel
+
+// BlockState is the per-block state next to the block id. Bits 0-1 are the orientation in clockwise quarter
+// turns seen from above, bits 2-5 the damage level and bit 6 is set for open doors.
+type BlockState uint16
+
+const (
+	blockStateOrientationMask BlockState = 0x3
+	blockStateDamageShift                = 2
+	blockStateDamageMask      BlockState = 0xF << blockStateDamageShift
+	blockStateOpen            BlockState = 1 << 6
+)
+
+// MaxBlockDamage is the highest damage level a block state can hold.
+const MaxBlockDamage = 15
+
+func (s BlockState) Orientation() int {
+	return int(s & blockStateOrientationMask)
+}
+
+// WithOrientation returns the state turned by the given number of clockwise quarter turns from the default.
+func (s BlockState) WithOrientation(quarterTurns int) BlockState {
+	quarterTurns = ((quarterTurns % 4) + 4) % 4
+	return (s &^ blockStateOrientationMask) | BlockState(quarterTurns)
+}
+
+func (s BlockState) Damage() int {
+	return int((s & blockStateDamageMask) >> blockStateDamageShift)
+}
+
+// WithDamage returns the state with the damage level, clamped to 0..MaxBlockDamage.
+func (s BlockState) WithDamage(damage int) BlockState {
+	damage = min(max(damage, 0), MaxBlockDamage)
+	return (s &^ blockStateDamageMask) | BlockState(damage)<<blockStateDamageShift
+}
+
+func (s BlockState) IsOpen() bool {
+	return s&blockStateOpen != 0
+}
+
+func (s BlockState) WithOpen(open bool) BlockState {
+	if open {
+		return s | blockStateOpen
+	}
+	return s &^ blockStateOpen
+}
+
+// horizontalFaces are the sides in the order of a clockwise turn seen from above.
+var horizontalFaces = [4]FaceType{North, East, South, West}
+
+// SourceFace returns the face of the unrotated block that is shown on the given side of the rotated block.
+// The top and the bottom stay in place.
+func (s BlockState) SourceFace(side FaceType) FaceType {
+	turns := s.Orientation()
+	if turns == 0 {
+		return side
+	}
+	for index, face := range horizontalFaces {
+		if face == side {
+			return horizontalFaces[(index-turns+4)%4]
+		}
+	}
+	return side
+}
@@ -1,14 +1,10 @@
 package voxel
 
 import (
-	"bytes"
-	"compress/gzip"
-	"encoding/binary"
 	"fmt"
 	"github.com/go-gl/mathgl/mgl32"
 	"github.com/memmaker/battleground/engine/glhf"
 	"math"
-	"os"
 )
 
 type Map struct {
@@ -29,6 +25,10 @@ type Map struct {
 	spawnCounter          int
 	textureCallback       func(block *Block, side FaceType) byte
 	maxChunkHeightForDraw int32
+
+	generation uint64
+	changes    []mapChange
+	blockNames []string // blockNames are the names of the block ids, if known
 }
 
 func NewDefaultMap(width, height, depth int32) *Map {
@@ -63,15 +63,15 @@ func NewMapWithEmptyChunks(width, height, depth, chunkSizeHorizontal, chunkSizeH
 	return m
 }
 
-func NewMapFromSource(source []byte, shader *glhf.Shader, texture *glhf.Texture) *Map {
+func NewMapFromSource(source []byte, shader *glhf.Shader, texture *glhf.Texture) (*Map, MapFile, error) {
 	m := &Map{
 		chunks:             make([]*Chunk, 0),
 		knownUnitPositions: make(map[uint64][]Int3),
 		chunkShader:        shader,
 		terrainTexture:     texture,
 	}
-	m.LoadFromSource(source)
-	return m
+	file, err := m.LoadFromSource(source)
+	return m, file, err
 }
 
 func NewMapFromGenerator(biomeFunc func() *Map, shader *glhf.Shader, texture *glhf.Texture) *Map {
@@ -122,110 +122,9 @@ func (m *Map) SetSize(width, height, depth int32) {
 	}
 }
 
-func (m *Map) SaveToDisk(filename string) error {
-	// serialize this map manually to a byte array
-	outfile, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	// use a gzip writer to compress the byte array
-	// then write the compressed byte array to the file
-
-	gzipWriter := gzip.NewWriter(outfile)
-	// write 2xint32
-	binary.Write(gzipWriter, binary.LittleEndian, m.ChunkSizeHorizontal)
-	binary.Write(gzipWriter, binary.LittleEndian, m.ChunkSizeHeight)
-
-	// write 3xint32
-	binary.Write(gzipWriter, binary.LittleEndian, m.width)
-	binary.Write(gzipWriter, binary.LittleEndian, m.height)
-	binary.Write(gzipWriter, binary.LittleEndian, m.depth)
-	// write the map dimensions
-	m.logVoxelInfo(fmt.Sprintf("[Map] Saving map with dimensions %d %d %d", m.width, m.height, m.depth))
-
-	// write the number of chunks
-	chunkCount := int16(len(m.chunks))
-	binary.Write(gzipWriter, binary.LittleEndian, chunkCount)
-	m.logVoxelInfo(fmt.Sprintf("[Map] Saving %d chunks", chunkCount))
-
-	// write the chunks
-	for _, chunk := range m.chunks {
-		binary.Write(gzipWriter, binary.LittleEndian, chunk.chunkPosX)
-		binary.Write(gzipWriter, binary.LittleEndian, chunk.chunkPosY)
-		binary.Write(gzipWriter, binary.LittleEndian, chunk.chunkPosZ)
-		m.logVoxelInfo(fmt.Sprintf("[Map] Saving chunk %d %d %d", chunk.chunkPosX, chunk.chunkPosY, chunk.chunkPosZ))
-		for _, block := range chunk.data {
-			id := byte(0)
-			if block != nil {
-				id = block.ID
-			}
-			err = binary.Write(gzipWriter, binary.LittleEndian, id)
-			if err != nil {
-				return err
-			}
-		}
-		m.logVoxelInfo(fmt.Sprintf("[Map] Saved %d blocks", len(chunk.data)))
-	}
-
-	err = gzipWriter.Close()
-	if err != nil {
-		return err
-	}
-	err = outfile.Close()
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (m *Map) LoadFromSource(source []byte) {
-	reader := bytes.NewReader(source)
-	gzipReader, err := gzip.NewReader(reader)
-	if err != nil {
-		panic(err)
-	}
-	// read chunk size
-	binary.Read(gzipReader, binary.LittleEndian, &m.ChunkSizeHorizontal)
-	binary.Read(gzipReader, binary.LittleEndian, &m.ChunkSizeHeight)
-
-	m.ChunkSizeCube = m.ChunkSizeHorizontal * m.ChunkSizeHeight * m.ChunkSizeHorizontal
-
-	// read the map dimensions
-	binary.Read(gzipReader, binary.LittleEndian, &m.width)
-	binary.Read(gzipReader, binary.LittleEndian, &m.height)
-	binary.Read(gzipReader, binary.LittleEndian, &m.depth)
-	m.logVoxelInfo(fmt.Sprintf("[Map] Loading map with dimensions %d %d %d", m.width, m.height, m.depth))
-
-	// read the number of chunks
-	m.maxChunkHeightForDraw = m.height - 1
-
-	chunkCount := int16(0)
-	binary.Read(gzipReader, binary.LittleEndian, &chunkCount)
-	m.logVoxelInfo(fmt.Sprintf("[Map] Loading %d chunks", chunkCount))
-
-	m.chunks = make([]*Chunk, chunkCount)
-
-	// read the chunks
-	for i := int16(0); i < chunkCount; i++ {
-		var chunkPos [3]int32
-		binary.Read(gzipReader, binary.LittleEndian, &chunkPos[0])
-		binary.Read(gzipReader, binary.LittleEndian, &chunkPos[1])
-		binary.Read(gzipReader, binary.LittleEndian, &chunkPos[2])
-		m.logVoxelInfo(fmt.Sprintf("[Map] Loading chunk %d %d %d", chunkPos[0], chunkPos[1], chunkPos[2]))
-		chunk := NewChunk(m, chunkPos[0], chunkPos[1], chunkPos[2])
-		m.chunks[i] = chunk
-		for j := int32(0); j < m.ChunkSizeCube; j++ {
-			blockID := byte(0)
-			binary.Read(gzipReader, binary.LittleEndian, &blockID)
-			chunk.data[j] = NewBlock(blockID)
-		}
-		chunk.SetDirty()
-	}
-}
-
 func (m *Map) SetChunk(x, y, z int32, c *Chunk) {
 	m.chunks[x+y*m.width+z*m.width*m.height] = c
+	m.forgetChanges()
 }
 func (m *Map) ChangeMaxChunkHeightForDraw(change int32) int32 {
 	newValue := m.maxChunkHeightForDraw + change
@@ -316,9 +215,25 @@ func (m *Map) SetBlock(x int32, y int32, z int32, block *Block) {
 	chunk := m.GetChunk(chunkX, chunkY, chunkZ)
 	if chunk != nil {
 		chunk.SetBlock(x%m.ChunkSizeHorizontal, y%m.ChunkSizeHeight, z%m.ChunkSizeHorizontal, block)
+		m.noteChange(Int3{X: x, Y: y, Z: z})
 	}
 }
 
+// SetBlockState changes the state of the block at the position. The block is replaced by a copy, since blocks
+// may be shared between positions.
+func (m *Map) SetBlockState(blockPos Int3, state BlockState) bool {
+	block := m.GetGlobalBlock(blockPos.X, blockPos.Y, blockPos.Z)
+	if block == nil || block.IsAir() {
+		return false
+	}
+	if block.State == state {
+		return true
+	}
+	changed := &Block{ID: block.ID, occupant: block.occupant, lightLevel: block.lightLevel, State: state}
+	m.SetBlock(blockPos.X, blockPos.Y, blockPos.Z, changed)
+	return true
+}
+
 func (m *Map) SetAir(blockPos Int3) {
 	m.SetBlock(blockPos.X, blockPos.Y, blockPos.Z, NewAirBlock())
 }
@@ -402,6 +317,7 @@ func (m *Map) SetFloorAtHeight(yLevel int, block *Block) {
 			}
 		}
 	}
+	m.forgetChanges()
 }
 
 type MapObject interface {
@@ -420,7 +336,12 @@ func DirectionToGridInt3(dir mgl32.Vec3) Int3 {
 	return Int3{int32(math.Round(float64(dir.X()))), int32(math.Round(float64(dir.Y()))), int32(math.Round(float64(dir.Z())))}
 }
 func (m *Map) IsUnitPlaceable(unit MapObject, blockPos Int3) (bool, string) {
-	offsets := unit.GetOccupiedBlockOffsets(blockPos)
+	return m.IsFreeForOffsets(unit, blockPos, unit.GetOccupiedBlockOffsets(blockPos))
+}
+
+// IsFreeForOffsets checks that the blocks at the offsets are inside the world and neither solid nor occupied
+// by another unit.
+func (m *Map) IsFreeForOffsets(unit MapObject, blockPos Int3, offsets []Int3) (bool, string) {
 	for _, offset := range offsets {
 		occupiedBlockPos := blockPos.Add(offset)
 		outsideOfWorld := !m.ContainsGrid(occupiedBlockPos)
@@ -470,6 +391,7 @@ func (m *Map) RemoveUnit(unit MapObject) {
 		if block != nil && block.IsOccupied() {
 			block.RemoveUnit(unit)
 		}
+		m.noteChange(occupiedBlockPos)
 	}
 	delete(m.knownUnitPositions, unit.UnitID())
 }
@@ -489,6 +411,7 @@ func (m *Map) SetUnitWithOffsets(unit MapObject, blockPos Int3, offsets []Int3)
 			occupiedBlockPos := blockPos.Add(offset)
 			block := m.GetGlobalBlock(occupiedBlockPos.X, occupiedBlockPos.Y, occupiedBlockPos.Z)
 			block.AddUnit(unit)
+			m.noteChange(occupiedBlockPos)
 			//println(fmt.Sprintf("[Map] - %s", occupiedBlockPos.ToString()))
 			occupiedBlocks[index] = occupiedBlockPos
 		}
@@ -727,6 +650,7 @@ func (m *Map) ClearAllChunks() {
 			chunk.ClearAllBlocks()
 		}
 	}
+	m.forgetChanges()
 }
 
 func (m *Map) GetTerrainTexture() *glhf.Texture {
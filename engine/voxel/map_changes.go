@@ -0,0 +1,45 @@
+package voxel
+
+// mapChangeHistory is how many changes the map remembers for the caches that depend on a part of it.
+const mapChangeHistory = 4096
+
+type mapChange struct {
+	generation uint64
+	position   Int3
+}
+
+// Generation counts the changes to the blocks and the unit positions of the map.
+func (m *Map) Generation() uint64 {
+	return m.generation
+}
+
+// ChangedSince tells if one of the positions that changed after the given generation matches. If the map
+// doesn't remember back that far, everything counts as changed.
+func (m *Map) ChangedSince(generation uint64, matches func(position Int3) bool) bool {
+	if generation == m.generation {
+		return false
+	}
+	if len(m.changes) == 0 || m.changes[0].generation > generation+1 {
+		return true
+	}
+	for i := len(m.changes) - 1; i >= 0 && m.changes[i].generation > generation; i-- {
+		if matches(m.changes[i].position) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Map) noteChange(position Int3) {
+	m.generation++
+	if len(m.changes) >= mapChangeHistory {
+		m.changes = append(m.changes[:0], m.changes[mapChangeHistory/2:]...)
+	}
+	m.changes = append(m.changes, mapChange{generation: m.generation, position: position})
+}
+
+// forgetChanges is used when a lot of the map changed at once, so nothing that was cached still holds.
+func (m *Map) forgetChanges() {
+	m.generation++
+	m.changes = m.changes[:0]
+}
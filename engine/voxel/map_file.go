@@ -0,0 +1,414 @@
+package voxel
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// MapFormatVersion is the version of the map files written by SaveToDisk.
+//
+// Version 1 files are a gzip stream of the chunk sizes, the map dimensions, an int16 chunk count and the raw block
+// ids of every chunk. The ids are those of the block list the map was made with.
+//
+// Version 2 files start with the magic "VXMP" and the version inside of the gzip stream, followed by the chunk sizes,
+// the map dimensions, the metadata of the game, a palette with the names of the blocks and an uint32 chunk count.
+// Every chunk has a local palette of indices into the map palette and run-length encoded blocks.
+//
+// Version 3 files add the block state to the entries of the local palettes, see BlockState, and use uint16
+// indices into the local palette for the runs.
+const MapFormatVersion = 3
+
+var mapFileMagic = [4]byte{'V', 'X', 'M', 'P'}
+
+// AirBlockName is the name of the block id 0 in every palette.
+const AirBlockName = "air"
+
+// MapFile is what a map file holds next to the blocks.
+type MapFile struct {
+	Version  int
+	Metadata []byte // Metadata is kept for the game to decode, version 1 files keep it in a separate file
+}
+
+// SetBlockNames changes the block ids of the map to the index of their name in blockNames, where index 0 is air.
+// A map without block names, loaded from a version 1 file or built in code, is taken to use these ids already.
+// Blocks whose name is not in the list become air, their names are returned.
+func (m *Map) SetBlockNames(blockNames []string) (unknown []string) {
+	if m.blockNames == nil {
+		m.blockNames = blockNames
+		return nil
+	}
+	newIDs := make(map[string]byte, len(blockNames))
+	for id, name := range blockNames {
+		newIDs[name] = byte(id)
+	}
+	var remap [256]byte
+	for id, name := range m.blockNames {
+		newID, known := newIDs[name]
+		if !known && id != EMPTYBLOCK {
+			unknown = append(unknown, name)
+		}
+		remap[id] = newID
+	}
+	remapped := make(map[*Block]bool) // blocks may be shared, like the floor
+	for _, chunk := range m.chunks {
+		if chunk == nil {
+			continue
+		}
+		for _, block := range chunk.data {
+			if block == nil || remapped[block] {
+				continue
+			}
+			block.ID = remap[block.ID]
+			remapped[block] = true
+		}
+		chunk.SetDirty()
+	}
+	m.blockNames = blockNames
+	return unknown
+}
+
+// GetBlockNames returns the names of the block ids, nil if they are not known.
+func (m *Map) GetBlockNames() []string {
+	return m.blockNames
+}
+
+// SaveToDisk writes the map in the current format. The block names must be known.
+func (m *Map) SaveToDisk(filename string, metadata []byte) error {
+	outfile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	gzipWriter := gzip.NewWriter(outfile)
+	err = m.Save(gzipWriter, metadata)
+	return errors.Join(err, gzipWriter.Close(), outfile.Close())
+}
+
+// Save writes the uncompressed content of a map file.
+func (m *Map) Save(writer io.Writer, metadata []byte) error {
+	if m.blockNames == nil {
+		return errors.New("the block names of the map are not known")
+	}
+	palette, paletteIndex := m.usedPalette()
+	if int64(len(metadata)) > math.MaxUint32 {
+		return errors.New("the metadata is too large")
+	}
+	for _, name := range palette {
+		if len(name) > math.MaxUint8 {
+			return fmt.Errorf("the block name '%s' is longer than %d bytes", name, math.MaxUint8)
+		}
+	}
+	out := &mapWriter{writer: bufio.NewWriter(writer)}
+	out.write(mapFileMagic, uint16(MapFormatVersion))
+	out.write(m.ChunkSizeHorizontal, m.ChunkSizeHeight, m.width, m.height, m.depth)
+	out.write(uint32(len(metadata)))
+	out.writeBytes(metadata)
+	out.write(uint16(len(palette)))
+	for _, name := range palette {
+		out.write(uint8(len(name)))
+		out.writeBytes([]byte(name))
+	}
+	chunkCount := 0
+	for _, chunk := range m.chunks {
+		if chunk != nil {
+			chunkCount++
+		}
+	}
+	out.write(uint32(chunkCount))
+	m.logVoxelInfo(fmt.Sprintf("[Map] Saving %d chunks with %d block types", chunkCount, len(palette)))
+	for _, chunk := range m.chunks {
+		if chunk != nil {
+			out.writeChunk(chunk, paletteIndex)
+		}
+	}
+	if out.err != nil {
+		return out.err
+	}
+	return out.writer.Flush()
+}
+
+// usedPalette names the block ids that occur in the map, air is always the first entry.
+func (m *Map) usedPalette() ([]string, map[byte]uint16) {
+	palette := []string{AirBlockName}
+	paletteIndex := map[byte]uint16{EMPTYBLOCK: 0}
+	for _, chunk := range m.chunks {
+		if chunk == nil {
+			continue
+		}
+		for _, block := range chunk.data {
+			id := blockIDOf(block)
+			if _, known := paletteIndex[id]; known {
+				continue
+			}
+			name := fmt.Sprintf("#%d", id) // ids beyond the names survive at least a save and load
+			if int(id) < len(m.blockNames) {
+				name = m.blockNames[id]
+			}
+			paletteIndex[id] = uint16(len(palette))
+			palette = append(palette, name)
+		}
+	}
+	return palette, paletteIndex
+}
+
+func blockIDOf(block *Block) byte {
+	if block == nil {
+		return EMPTYBLOCK
+	}
+	return block.ID
+}
+
+// LoadFromSource reads a gzip compressed map file of any version. The block ids of version 2 files are
+// the indices of their palette, see GetBlockNames.
+func (m *Map) LoadFromSource(source []byte) (MapFile, error) {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(source))
+	if err != nil {
+		return MapFile{}, err
+	}
+	in := &mapReader{reader: bufio.NewReader(gzipReader)}
+	var magic [4]byte
+	in.read(&magic)
+	if magic != mapFileMagic {
+		// version 1 files start with the chunk size
+		return MapFile{Version: 1}, m.loadVersion1(io.MultiReader(bytes.NewReader(magic[:]), in.reader))
+	}
+	var version uint16
+	in.read(&version)
+	if in.err == nil && (version < 2 || version > MapFormatVersion) {
+		return MapFile{}, fmt.Errorf("unknown map format version %d", version)
+	}
+	file := MapFile{Version: int(version)}
+	in.read(&m.ChunkSizeHorizontal, &m.ChunkSizeHeight, &m.width, &m.height, &m.depth)
+	var metadataLength uint32
+	in.read(&metadataLength)
+	file.Metadata = in.readBytes(int(metadataLength))
+	var paletteLength uint16
+	in.read(&paletteLength)
+	if paletteLength > 256 {
+		return file, fmt.Errorf("the palette has %d blocks, at most 256 are allowed", paletteLength)
+	}
+	palette := make([]string, paletteLength)
+	for i := range palette {
+		var nameLength uint8
+		in.read(&nameLength)
+		palette[i] = string(in.readBytes(int(nameLength)))
+	}
+	var chunkCount uint32
+	in.read(&chunkCount)
+	if in.err != nil {
+		return file, in.err
+	}
+	if err = m.prepareForLoading(); err != nil {
+		return file, err
+	}
+	m.logVoxelInfo(fmt.Sprintf("[Map] Loading %d chunks of a map with dimensions %d %d %d", chunkCount, m.width, m.height, m.depth))
+	for i := uint32(0); i < chunkCount && in.err == nil; i++ {
+		in.readChunk(m, file.Version, len(palette))
+	}
+	if in.err != nil {
+		return file, fmt.Errorf("reading the chunks: %w", in.err)
+	}
+	m.blockNames = palette
+	return file, nil
+}
+
+// maxChunks keeps a broken file from allocating all memory.
+const maxChunks = 1 << 24
+
+func (m *Map) prepareForLoading() error {
+	if m.ChunkSizeHorizontal <= 0 || m.ChunkSizeHeight <= 0 || m.width <= 0 || m.height <= 0 || m.depth <= 0 ||
+		int64(m.width)*int64(m.height)*int64(m.depth) > maxChunks {
+		return fmt.Errorf("invalid map dimensions %dx%dx%d with chunks of %dx%d", m.width, m.height, m.depth, m.ChunkSizeHorizontal, m.ChunkSizeHeight)
+	}
+	m.ChunkSizeCube = m.ChunkSizeHorizontal * m.ChunkSizeHeight * m.ChunkSizeHorizontal
+	m.maxChunkHeightForDraw = m.height - 1
+	m.chunks = make([]*Chunk, m.width*m.height*m.depth)
+	m.blockNames = nil
+	m.forgetChanges()
+	return nil
+}
+
+// loadVersion1 reads the raw block ids, the map keeps the ids of the block list it was made with.
+func (m *Map) loadVersion1(reader io.Reader) error {
+	in := &mapReader{reader: reader}
+	in.read(&m.ChunkSizeHorizontal, &m.ChunkSizeHeight, &m.width, &m.height, &m.depth)
+	chunkCount := int16(0)
+	in.read(&chunkCount)
+	if in.err != nil {
+		return in.err
+	}
+	if err := m.prepareForLoading(); err != nil {
+		return err
+	}
+	m.logVoxelInfo(fmt.Sprintf("[Map] Loading %d chunks of a version 1 map with dimensions %d %d %d", chunkCount, m.width, m.height, m.depth))
+	blockIDs := make([]byte, m.ChunkSizeCube)
+	for i := int16(0); i < chunkCount && in.err == nil; i++ {
+		var chunkPos [3]int32
+		in.read(&chunkPos)
+		in.read(blockIDs)
+		if in.err != nil {
+			break
+		}
+		if !m.isChunkInside(chunkPos) || m.GetChunk(chunkPos[0], chunkPos[1], chunkPos[2]) != nil {
+			return fmt.Errorf("chunk %v is outside of the map or twice in the file", chunkPos)
+		}
+		chunk := m.NewChunk(chunkPos[0], chunkPos[1], chunkPos[2])
+		for j, blockID := range blockIDs {
+			chunk.data[j] = NewBlock(blockID)
+		}
+		chunk.SetDirty()
+	}
+	m.forgetChanges()
+	return in.err
+}
+
+type mapWriter struct {
+	writer *bufio.Writer
+	err    error
+}
+
+func (w *mapWriter) write(values ...any) {
+	for _, value := range values {
+		if w.err == nil {
+			w.err = binary.Write(w.writer, binary.LittleEndian, value)
+		}
+	}
+}
+
+func (w *mapWriter) writeBytes(data []byte) {
+	if w.err == nil {
+		_, w.err = w.writer.Write(data)
+	}
+}
+
+// localBlock is an entry of the local palette of a chunk.
+type localBlock struct {
+	Block uint16 // Block is the index into the map palette
+	State BlockState
+}
+
+// writeChunk stores the position, the local palette and the runs of equal blocks.
+func (w *mapWriter) writeChunk(chunk *Chunk, paletteIndex map[byte]uint16) {
+	w.write(chunk.chunkPosX, chunk.chunkPosY, chunk.chunkPosZ)
+	var localPalette []localBlock
+	localIndex := make(map[localBlock]uint16)
+	indices := make([]uint16, len(chunk.data))
+	for i, block := range chunk.data {
+		entry := localBlock{Block: paletteIndex[blockIDOf(block)]}
+		if block != nil {
+			entry.State = block.State
+		}
+		index, known := localIndex[entry]
+		if !known {
+			index = uint16(len(localPalette))
+			localIndex[entry] = index
+			localPalette = append(localPalette, entry)
+		}
+		indices[i] = index
+	}
+	w.write(uint16(len(localPalette)), localPalette)
+
+	type run struct {
+		Length uint16
+		Index  uint16
+	}
+	var runs []run
+	for _, index := range indices {
+		if last := len(runs) - 1; last >= 0 && runs[last].Index == index && runs[last].Length < math.MaxUint16 {
+			runs[last].Length++
+		} else {
+			runs = append(runs, run{Length: 1, Index: index})
+		}
+	}
+	w.write(uint32(len(runs)), runs)
+}
+
+type mapReader struct {
+	reader io.Reader
+	err    error
+}
+
+func (r *mapReader) read(targets ...any) {
+	for _, target := range targets {
+		if r.err == nil {
+			r.err = binary.Read(r.reader, binary.LittleEndian, target)
+		}
+	}
+}
+
+func (r *mapReader) readBytes(length int) []byte {
+	data := make([]byte, length)
+	if r.err == nil {
+		_, r.err = io.ReadFull(r.reader, data)
+	}
+	return data
+}
+
+func (r *mapReader) readChunk(m *Map, version int, paletteLength int) {
+	var chunkPos [3]int32
+	var localLength uint16
+	r.read(&chunkPos, &localLength)
+	localPalette := make([]localBlock, localLength)
+	if version == 2 {
+		// version 2 has no block states
+		blocks := make([]uint16, localLength)
+		r.read(blocks)
+		for i, block := range blocks {
+			localPalette[i].Block = block
+		}
+	} else {
+		r.read(localPalette)
+	}
+	var runCount uint32
+	r.read(&runCount)
+	if r.err != nil {
+		return
+	}
+	if !m.isChunkInside(chunkPos) || m.GetChunk(chunkPos[0], chunkPos[1], chunkPos[2]) != nil {
+		r.err = fmt.Errorf("chunk %v is outside of the map or twice in the file", chunkPos)
+		return
+	}
+	for _, entry := range localPalette {
+		if int(entry.Block) >= paletteLength {
+			r.err = fmt.Errorf("chunk %v uses block %d of a palette with %d blocks", chunkPos, entry.Block, paletteLength)
+			return
+		}
+	}
+	chunk := m.NewChunk(chunkPos[0], chunkPos[1], chunkPos[2])
+	position := 0
+	for i := uint32(0); i < runCount && r.err == nil; i++ {
+		var length, index uint16
+		if version == 2 {
+			var shortIndex uint8
+			r.read(&length, &shortIndex)
+			index = uint16(shortIndex)
+		} else {
+			r.read(&length, &index)
+		}
+		if r.err != nil {
+			return
+		}
+		if int(index) >= len(localPalette) || position+int(length) > len(chunk.data) {
+			r.err = fmt.Errorf("chunk %v has a broken run of blocks", chunkPos)
+			return
+		}
+		entry := localPalette[index]
+		for end := position + int(length); position < end; position++ {
+			chunk.data[position] = &Block{ID: byte(entry.Block), State: entry.State}
+		}
+	}
+	if r.err == nil && position != len(chunk.data) {
+		r.err = fmt.Errorf("chunk %v has %d blocks, expected %d", chunkPos, position, len(chunk.data))
+	}
+	chunk.SetDirty()
+}
+
+func (m *Map) isChunkInside(chunkPos [3]int32) bool {
+	return chunkPos[0] >= 0 && chunkPos[0] < m.width && chunkPos[1] >= 0 && chunkPos[1] < m.height && chunkPos[2] >= 0 && chunkPos[2] < m.depth
+}
@@ -1,13 +1,18 @@
 package game
 
 import (
+	"fmt"
 	"github.com/memmaker/battleground/engine/path"
 	"github.com/memmaker/battleground/engine/voxel"
 	"slices"
 )
 
+// MaxMoveWaypoints is how many targets one movement order may chain.
+const MaxMoveWaypoints = 8
+
 type ActionMove struct {
 	gameMap         *voxel.Map
+	hazards         PathHazards
 	selectedPath    []voxel.Int3
 	previousNodeMap map[voxel.Int3]voxel.Int3
 	distanceMap     map[voxel.Int3]float64
@@ -20,9 +25,11 @@ func (a *ActionMove) IsValidTarget(target voxel.Int3) bool {
 	return ok && distance <= float64(a.unit.MovesLeft())
 }
 
-func NewActionMove(gameMap *voxel.Map, unit *UnitInstance) *ActionMove {
+// NewActionMove finds the paths around the hazards where it can, hazards can be nil.
+func NewActionMove(gameMap *voxel.Map, unit *UnitInstance, hazards PathHazards) *ActionMove {
 	a := &ActionMove{
 		gameMap:         gameMap,
+		hazards:         hazards,
 		previousNodeMap: make(map[voxel.Int3]voxel.Int3),
 		distanceMap:     make(map[voxel.Int3]float64),
 		unit:            unit,
@@ -63,10 +70,65 @@ func (a *ActionMove) GetCost(target voxel.Int3) float64 {
 	return a.distanceMap[target]
 }
 
+// GetRoute chains the paths through the waypoints in their order, the last waypoint is the destination.
+// costs holds the movement cost from the current position to each step of the route.
+func (a *ActionMove) GetRoute(waypoints []voxel.Int3) (route []voxel.Int3, costs []float64, problem string) {
+	if len(waypoints) == 0 {
+		return nil, nil, "No movement target"
+	}
+	if len(waypoints) > MaxMoveWaypoints {
+		return nil, nil, fmt.Sprintf("Expected at most %d waypoints, got %d", MaxMoveWaypoints, len(waypoints))
+	}
+	movesLeft := a.unit.MovesLeft()
+	pather := NewPather(a.gameMap, a.unit, a.hazards)
+	current := a.unit.GetBlockPosition()
+	cost := 0.0
+	for index, waypoint := range waypoints {
+		var segment []voxel.Int3
+		if index == 0 {
+			if !a.IsValidTarget(waypoint) {
+				return nil, nil, fmt.Sprintf("Target %s is not valid", waypoint.ToString())
+			}
+			segment = a.GetPath(waypoint)
+		} else {
+			var found bool
+			segment, _, found = path.AStar[voxel.Int3](current, waypoint, float64(movesLeft)-cost, pather)
+			if !found {
+				return nil, nil, fmt.Sprintf("Waypoint %s can't be reached from %s (dist so far: %0.2f, moves left: %d)", waypoint.ToString(), current.ToString(), cost, movesLeft)
+			}
+		}
+		for _, step := range segment {
+			cost += pather.GetCost(current, step)
+			current = step
+			route = append(route, step)
+			costs = append(costs, cost)
+		}
+	}
+	if len(route) == 0 {
+		return nil, nil, "The route doesn't go anywhere"
+	}
+	if cost > float64(movesLeft) {
+		return nil, nil, fmt.Sprintf("Route to %s is too long (dist: %0.2f, moves left: %d)", current.ToString(), cost, movesLeft)
+	}
+	return route, costs, ""
+}
+
+// GetHazards lists the hazards on the steps of a route, so the player can be warned before the unit moves.
+func (a *ActionMove) GetHazards(route []voxel.Int3) []PathHazard {
+	if a.hazards == nil {
+		return nil
+	}
+	var hazards []PathHazard
+	for _, step := range route {
+		hazards = append(hazards, a.hazards.HazardsAt(a.unit, step)...)
+	}
+	return hazards
+}
+
 func (a *ActionMove) updateTargetData() {
 	footPosInt := a.unit.GetBlockPosition()
 	var valid []voxel.Int3
-	dist, prevNodeMap := path.Dijkstra[voxel.Int3](path.NewNode(footPosInt), float64(a.unit.MovesLeft()), NewPather(a.gameMap, a.unit))
+	dist, prevNodeMap := a.unit.Reachable(a.gameMap, a.hazards, float64(a.unit.MovesLeft()))
 	for node, distance := range dist {
 		if node == footPosInt {
 			continue
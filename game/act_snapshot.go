@@ -19,7 +19,7 @@ func (a *ActionSnapShot) GetAccuracyModifier() float64 {
 }
 
 func (a *ActionSnapShot) IsTurnEnding() bool {
-	return true
+	return a.engine.rules.IsRangedAttackTurnEnding
 }
 
 func NewActionShot(engine *GameInstance, unit *UnitInstance) *ActionSnapShot {
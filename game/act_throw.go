@@ -14,7 +14,7 @@ type ActionThrow struct {
 }
 
 func (a *ActionThrow) IsTurnEnding() bool {
-	return true
+	return a.engine.rules.IsThrowTurnEnding
 }
 
 func NewActionThrow(engine *GameInstance, unit *UnitInstance, item *Item) *ActionThrow {
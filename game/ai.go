@@ -3,11 +3,17 @@ package game
 import "C"
 import (
 	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
 	"github.com/memmaker/battleground/engine/util"
 	"github.com/memmaker/battleground/engine/voxel"
-	"math/rand"
+	"slices"
+	"time"
 )
 
+// aiTurnReserve is the time an action needs for the round trip to the server, the AI ends its turn itself
+// when it has less time than that left.
+const aiTurnReserve = 500 * time.Millisecond
+
 type DummyClientUnit struct {
 	*UnitInstance
 	isUserControlled bool
@@ -39,13 +45,26 @@ type DummyClient struct {
 	*GameClient[*DummyClientUnit]
 	connection     *ServerConnection
 	movedUnits     map[uint64]bool
+	actionsTaken   map[uint64]int
+	enemyOverwatch map[uint64][]voxel.Int3 // watcher -> watched locations, as far as we have seen them
 	waitingForUnit uint64
+	isMyTurn       bool
+	turnDeadline   time.Time // turnDeadline is zero without time controls
 	turnCounter    int
+	profile        AIProfile
 }
 
-func NewDummyClient(endpoint string) *DummyClient {
-	d := &DummyClient{connection: nil, movedUnits: make(map[uint64]bool), turnCounter: 0}
-	d.connection = NewTCPConnectionWithHandler(endpoint, d.OnServerMessage)
+func NewDummyClient(transport Transport, mods *ModSet) *DummyClient {
+	d := &DummyClient{
+		connection:     nil,
+		movedUnits:     make(map[uint64]bool),
+		actionsTaken:   make(map[uint64]int),
+		enemyOverwatch: make(map[uint64][]voxel.Int3),
+		turnCounter:    0,
+		profile:        NewDefaultAIProfile(),
+	}
+	d.connection = NewConnectionWithHandler(transport, d.OnServerMessage)
+	d.connection.SetModSet(mods)
 	return d
 }
 
@@ -55,13 +74,16 @@ func (c *DummyClient) OnServerMessage(incomingMessage StringMessage) {
 	case "GameStarted":
 		var gameInfo GameStartedMessage
 		util.FromJson(messageAsJson, &gameInfo)
-		c.GameClient = NewGameClient[*DummyClientUnit](gameInfo, c.createDummyUnit)
+		c.GameClient = NewGameClient[*DummyClientUnit](gameInfo, c.connection.NewAssets(), c.createDummyUnit)
 		c.GameClient.SetEnvironment("AI-Client")
+		if gameInfo.AIProfile != nil {
+			c.profile = *gameInfo.AIProfile
+		}
 		println("Game started!")
-		loadedMap := voxel.NewMapFromSource(c.GetAssets().LoadMap(gameInfo.MapFile), nil, nil)
+		loadedMap, _, _ := c.GetAssets().LoadMapFile(gameInfo.MapFile)
 		c.GameClient.SetVoxelMap(loadedMap)
-		blockList := GetDebugBlockNames()
-		indexMap := util.CreateIndexMapFromDirectory("assets/textures/blocks/star_odyssey", blockList)
+		blockList := append(GetDebugBlockNames(), c.GetAssets().modBlocks...)
+		indexMap := util.CreateIndexMapFromDirectory("assets/textures/blocks/star_odyssey", slices.Clone(blockList))
 		bl := NewBlockLibrary(blockList, indexMap)
 		bl.ApplyGameplayRules(c.GameInstance)
 		c.SetBlockLibrary(bl)
@@ -90,7 +112,6 @@ func (c *DummyClient) OnServerMessage(incomingMessage StringMessage) {
 		if util.FromJson(messageAsJson, &msg) {
 			c.OnOwnUnitMoved(msg)
 			//println(fmt.Sprintf("[DummyClient] Unit %d moved to %s", msg.Attacker, msg.EndPosition.ToString()))
-			c.movedUnits[msg.UnitID] = true
 			c.makeMove()
 		}
 	case "EnemyUnitMoved":
@@ -104,7 +125,6 @@ func (c *DummyClient) OnServerMessage(incomingMessage StringMessage) {
 			c.OnRangedAttack(msg)
 			if c.IsMyUnit(msg.Attacker) {
 				println(fmt.Sprintf("[DummyClient] Unit %d shot", msg.Attacker))
-				c.movedUnits[msg.Attacker] = true
 				c.makeMove()
 			}
 		}
@@ -114,10 +134,28 @@ func (c *DummyClient) OnServerMessage(incomingMessage StringMessage) {
 			c.OnThrow(msg)
 			if c.IsMyUnit(msg.Attacker) {
 				println(fmt.Sprintf("[DummyClient] Unit %d threw", msg.Attacker))
-				c.movedUnits[msg.Attacker] = true
 				c.makeMove()
 			}
 		}
+	case "BeginOverwatch":
+		var msg VisualBeginOverwatch
+		if util.FromJson(messageAsJson, &msg) {
+			if c.IsMyUnit(msg.Watcher) {
+				c.OnBeginOverwatch(msg)
+				c.movedUnits[msg.Watcher] = true
+				c.makeMove()
+			} else {
+				c.enemyOverwatch[msg.Watcher] = msg.WatchedLocations
+			}
+		}
+	case "Reload":
+		var msg UnitMessage
+		if util.FromJson(messageAsJson, &msg) {
+			if unit, exists := c.GetClientUnit(msg.UnitID()); exists {
+				unit.Reload()
+			}
+			c.makeMove()
+		}
 	case "ActionResponse":
 		var msg ActionResponse
 		if util.FromJson(messageAsJson, &msg) {
@@ -127,16 +165,57 @@ func (c *DummyClient) OnServerMessage(incomingMessage StringMessage) {
 		var msg NextPlayerMessage
 		if util.FromJson(messageAsJson, &msg) {
 			c.OnNextPlayer(msg)
+			c.forgetOverwatchOf(msg.CurrentPlayer)
+			for _, revealed := range msg.RevealedUnits {
+				c.AddOrUpdateUnit(revealed)
+			}
 			if msg.YourTurn {
-				util.MustSend(c.connection.EndTurn())
-				/*
-					c.resetTurn()
-					c.makeMove()
-					c.turnCounter++
-
-				*/
+				c.resetTurn()
+				c.setTurnDeadline(msg.SecondsLeft)
+				c.turnCounter++
+				c.makeMove()
+			}
+		}
+	case "TurnTimeWarning":
+		var msg TurnTimeWarningMessage
+		if util.FromJson(messageAsJson, &msg) {
+			c.OnTurnTimeWarning(msg)
+			if msg.YourTurn {
+				// the next action checks the deadline, the AI keeps playing while there is time left
+				c.setTurnDeadline(msg.SecondsLeft)
+			}
+		}
+	case "GameResumed":
+		var msg GameResumedMessage
+		if util.FromJson(messageAsJson, &msg) {
+			c.OnGameResumed(msg)
+			if msg.AwaitingMapLoaded {
+				util.MustSend(c.connection.MapLoaded())
+			} else if msg.AwaitingDeployment {
+				c.OnDeploy()
+			} else if msg.YourTurn {
+				c.isMyTurn = true
+				c.setTurnDeadline(msg.SecondsLeft)
+				c.makeMove()
 			}
 		}
+	case "PlayerConnection":
+		var msg PlayerConnectionMessage
+		if util.FromJson(messageAsJson, &msg) {
+			c.OnPlayerConnection(msg)
+		}
+	case "BlockStatesChanged":
+		var msg BlockStatesChangedMessage
+		if util.FromJson(messageAsJson, &msg) {
+			c.OnBlockStatesChanged(msg)
+		}
+	case "BlocksCollapsed":
+		var msg BlocksCollapsedMessage
+		if util.FromJson(messageAsJson, &msg) {
+			c.OnBlocksCollapsed(msg)
+		}
+	case "ChatLine", "ChatHistory":
+		// the AI does not talk
 	case "GameOver":
 		var msg GameOverMessage
 		if util.FromJson(messageAsJson, &msg) {
@@ -153,56 +232,82 @@ func (c *DummyClient) OnTargetedUnitActionResponse(msg ActionResponse) {
 	c.makeMove()
 }
 
+// makeMove lets the units act one after another, each of them until it has nothing sensible left to do.
+// Every action is answered by the server, the answer calls makeMove again.
 func (c *DummyClient) makeMove() {
-	unit, unitLeft := c.getNextUnit()
-
-	if !unitLeft {
-		// JUST END TURN FOR NOW
-		//println(fmt.Sprintf("[DummyClient] Ending turn..."))
-		util.MustSend(c.connection.EndTurn())
+	if !c.isMyTurn {
 		return
 	}
-	enemy, available := c.GetNearestEnemy(unit)
-	if available {
-		c.attackUnit(unit, enemy)
-	} else {
-		c.moveUnit(unit)
+	for {
+		unit, unitLeft := c.getNextUnit()
+		if !unitLeft || c.isOutOfTime(time.Now()) {
+			c.endTurn()
+			return
+		}
+		if c.actionsTaken[unit.UnitID()] >= maxAIActionsPerUnit {
+			c.movedUnits[unit.UnitID()] = true
+			continue
+		}
+		decision := c.decide(unit)
+		if decision.kind == aiDone {
+			util.LogGameInfo(fmt.Sprintf("[DummyClient] %s(%d) is done: %s", unit.GetName(), unit.UnitID(), decision))
+			c.movedUnits[unit.UnitID()] = true
+			continue
+		}
+		util.LogGameInfo(fmt.Sprintf("[DummyClient] %s(%d) is %s", unit.GetName(), unit.UnitID(), decision))
+		c.actionsTaken[unit.UnitID()]++
+		c.waitingForUnit = unit.UnitID()
+		c.execute(unit, decision)
+		return
 	}
 }
 
-func (c *DummyClient) attackUnit(attacker, target *DummyClientUnit) {
-	shotAction := NewActionShot(c.GameInstance, attacker.UnitInstance)
-	util.MustSend(c.connection.TargetedUnitAction(attacker.UnitID(), shotAction.GetName(), []voxel.Int3{target.GetBlockPosition()}))
-	c.waitingForUnit = attacker.UnitID()
+func (c *DummyClient) execute(unit *DummyClientUnit, decision aiDecision) {
+	switch decision.kind {
+	case aiMove:
+		moveAction := NewActionMove(c.voxelMap, unit.UnitInstance, c.GameInstance)
+		util.MustSend(c.connection.TargetedUnitAction(unit.UnitID(), moveAction.GetName(), []voxel.Int3{decision.target}))
+	case aiShoot:
+		shotAction := NewActionShot(c.GameInstance, unit.UnitInstance)
+		util.MustSend(c.connection.TargetedUnitAction(unit.UnitID(), shotAction.GetName(), []voxel.Int3{decision.target}))
+	case aiFreeAim:
+		shotAction := NewActionShot(c.GameInstance, unit.UnitInstance)
+		util.MustSend(c.connection.FreeAimAction(unit.UnitID(), shotAction.GetName(), unit.GetEyePosition(), decision.angles))
+	case aiOverwatch:
+		overwatchAction := NewActionOverwatch(c.GameInstance, unit.UnitInstance)
+		util.MustSend(c.connection.TargetedUnitAction(unit.UnitID(), overwatchAction.GetName(), decision.watched))
+	case aiThrow:
+		throwAction := NewActionThrow(c.GameInstance, unit.UnitInstance, unit.GetItem(decision.itemName))
+		util.MustSend(c.connection.ThrownUnitAction(unit.UnitID(), throwAction.GetName(), decision.itemName, []mgl32.Vec3{decision.throwAt}))
+	case aiReload:
+		util.MustSend(c.connection.ReloadAction(unit.UnitID()))
+	}
 }
 
-func (c *DummyClient) moveUnit(unit *DummyClientUnit) bool {
-	moveAction := NewActionMove(c.voxelMap, unit.UnitInstance)
-	validMoves := moveAction.GetValidTargets()
-	if len(validMoves) > 0 {
-		chosenDest := choseRandom(validMoves)
-		moves := int32(4)
-		if c.turnCounter%2 == 1 {
-			moves *= -1
-		}
-		chosenDest = unit.GetBlockPosition().Add(voxel.Int3{Z: moves})
-		util.LogGameInfo(fmt.Sprintf("[DummyClient] Moving unit %s(%d) to %s", unit.Name, unit.UnitID(), chosenDest.ToString()))
-		util.MustSend(c.connection.TargetedUnitAction(unit.UnitID(), moveAction.GetName(), []voxel.Int3{chosenDest}))
-		// HACK: assume this works
-		unit.SetBlockPositionAndUpdateStance(chosenDest)
-		c.waitingForUnit = unit.UnitID()
-		return true
-	} else {
-		return false
+// setTurnDeadline starts counting down the seconds the server gave us, 0 means the turn has no time limit.
+func (c *DummyClient) setTurnDeadline(secondsLeft float64) {
+	if secondsLeft <= 0 {
+		c.turnDeadline = time.Time{}
+		return
 	}
+	c.turnDeadline = time.Now().Add(time.Duration(secondsLeft * float64(time.Second)))
+}
+
+// isOutOfTime is true if the next action could not be answered before the server ends the turn.
+func (c *DummyClient) isOutOfTime(now time.Time) bool {
+	return !c.turnDeadline.IsZero() && c.turnDeadline.Sub(now) < aiTurnReserve
 }
 
-func choseRandom(moves []voxel.Int3) voxel.Int3 {
-	randIndex := rand.Intn(len(moves))
-	return moves[randIndex]
+func (c *DummyClient) endTurn() {
+	if !c.isMyTurn {
+		return
+	}
+	c.isMyTurn = false
+	util.MustSend(c.connection.EndTurn())
 }
 
-func (c *DummyClient) CreateGameSequence() {
+// CreateGameSequence creates the test game with the AI seat played with the given difficulty and personality.
+func (c *DummyClient) CreateGameSequence(seat AISeat) {
 	con := c.connection
 	loginSuccess := false
 	createSuccess := false
@@ -248,34 +353,34 @@ func (c *DummyClient) CreateGameSequence() {
 	println("[DummyClient] Starting create game sequence...")
 	util.MustSend(con.Login("creator"))
 	util.WaitForTrue(&loginSuccess)
-	util.MustSend(con.CreateGame("map", "fx's test game", NewRandomDeathmatch(), true))
+	util.MustSend(con.CreateGame("map", "fx's test game", NewRandomDeathmatch(), true, 0, DefaultRulesetName, &seat))
 	util.WaitForTrue(&createSuccess)
 	util.MustSend(con.SelectFaction("X-Com"))
 	util.WaitForTrue(&factionSuccess)
 	util.MustSend(con.SelectUnits([]UnitChoice{
 		{
-			UnitTypeID: 0,
-			Name:       "Jimmy",
-			Weapon:     "Mossberg 500",
-			Items:      []string{"Smoke Grenade"},
+			UnitType: "Soldier",
+			Name:     "Jimmy",
+			Weapon:   "Mossberg 500",
+			Items:    []string{"Smoke Grenade"},
 		},
 
 		{
-			UnitTypeID: 0,
-			Name:       "Bimmy",
-			Weapon:     "Steyr SSG 69",
-			Items:      []string{"Smoke Grenade"},
+			UnitType: "Soldier",
+			Name:     "Bimmy",
+			Weapon:   "Steyr SSG 69",
+			Items:    []string{"Smoke Grenade"},
 		},
 		/*
 			{
-				UnitTypeID: 0,
+				UnitType:   "Soldier",
 				name:       "Timmy",
 				Weapon:     "M16 Rifle",
 			},
 		*/
 		/*
 			{
-				UnitTypeID: 1,
+				UnitType:   "Walker",
 				name:       "Walker",
 				//Weapon:     "Sniper",
 			},
@@ -293,6 +398,8 @@ func (c *DummyClient) resetTurn() {
 		unit.NextTurn()
 	}
 	c.movedUnits = make(map[uint64]bool)
+	c.actionsTaken = make(map[uint64]int)
+	c.isMyTurn = true
 }
 
 func (c *DummyClient) getNextUnit() (*DummyClientUnit, bool) {
@@ -312,6 +419,10 @@ func (c *DummyClient) getNextUnit() (*DummyClientUnit, bool) {
 }
 
 func (c *DummyClient) createDummyUnit(instance *UnitInstance) *DummyClientUnit {
+	// the AI needs the colliders of the units to rate its shots, the same way the server loads them
+	model := c.GetAssets().LoadMeshWithAnimationMap(instance.Definition.ModelFile, instance.Definition.AnimationMap)
+	model.RootNode.CreateColliders()
+	instance.SetModel(model)
 	return NewDummyClientUnit(instance)
 }
 
@@ -329,10 +440,10 @@ func (c *DummyClient) OnDeploy() {
 }
 
 func (c *DummyClient) choseRandom(unit *DummyClientUnit, spawns []voxel.Int3) voxel.Int3 {
-	current := util.RandomChoice(spawns)
+	current := util.RandomChoice(c.GetRandom(), spawns)
 	placeable, _ := c.voxelMap.IsUnitPlaceable(unit, current)
-	for !placeable {
-		current = util.RandomChoice(spawns)
+	for !placeable || !c.HasGroundUnder(unit.UnitInstance, current) {
+		current = util.RandomChoice(c.GetRandom(), spawns)
 		placeable, _ = c.voxelMap.IsUnitPlaceable(unit, current)
 	}
 	return current
@@ -0,0 +1,96 @@
+package game
+
+import (
+	"fmt"
+	"github.com/memmaker/battleground/engine/util"
+	"sync"
+	"time"
+)
+
+// lobbyTimeout is how long an AI client waits for the server to answer a lobby request.
+const lobbyTimeout = 10 * time.Second
+
+// AISide is one side of a game between AI clients.
+type AISide struct {
+	Username string
+	Faction  string
+	Units    []UnitChoice
+	Seat     AISeat
+}
+
+type lobbyStep struct {
+	send     func() error
+	response string
+}
+
+// CreateMatch logs in, creates a public game and picks the squad of the side. It returns when the server
+// accepted the squad, the client plays on its own from then on.
+func (c *DummyClient) CreateMatch(mapName string, gameID string, details *MissionDetails, ruleset string, side AISide) error {
+	con := c.connection
+	seat := side.Seat
+	return c.runLobby([]lobbyStep{
+		{func() error { return con.Login(side.Username) }, "LoginResponse"},
+		{func() error { return con.CreateGame(mapName, gameID, details, true, 0, ruleset, &seat) }, "CreateGameResponse"},
+		{func() error { return con.SelectFaction(side.Faction) }, "SelectFactionResponse"},
+		{func() error { return con.SelectUnits(side.Units) }, "SelectUnitsResponse"},
+	})
+}
+
+// JoinMatch logs in, joins the game as an AI seat and picks the squad of the side.
+func (c *DummyClient) JoinMatch(gameID string, side AISide) error {
+	con := c.connection
+	return c.runLobby([]lobbyStep{
+		{func() error { return con.Login(side.Username) }, "LoginResponse"},
+		{func() error { return con.JoinGameAsAI(gameID, side.Seat) }, "JoinGameResponse"},
+		{func() error { return con.SelectFaction(side.Faction) }, "SelectFactionResponse"},
+		{func() error { return con.SelectUnits(side.Units) }, "SelectUnitsResponse"},
+	})
+}
+
+// Close disconnects the client from the server.
+func (c *DummyClient) Close() error {
+	return c.connection.Close()
+}
+
+// runLobby sends the steps one after another and waits for the answer to each of them. After the last answer
+// the game handler takes over, while still on the read loop, so the GameStarted message can't get lost.
+func (c *DummyClient) runLobby(steps []lobbyStep) error {
+	var lock sync.Mutex
+	expected := ""
+	isLastStep := false
+	answers := make(chan ActionResponse, 1)
+	c.connection.SetEventHandler(func(msgReceived StringMessage) {
+		lock.Lock()
+		defer lock.Unlock()
+		if msgReceived.MessageType != expected {
+			return
+		}
+		var msg ActionResponse
+		if !util.FromJson(msgReceived.Message, &msg) {
+			msg.Message = fmt.Sprintf("could not read the %s", expected)
+		}
+		if msg.Success && isLastStep {
+			c.connection.SetEventHandler(c.OnServerMessage)
+		}
+		expected = ""
+		answers <- msg
+	})
+	for index, step := range steps {
+		lock.Lock()
+		expected = step.response
+		isLastStep = index == len(steps)-1
+		lock.Unlock()
+		if err := step.send(); err != nil {
+			return err
+		}
+		select {
+		case answer := <-answers:
+			if !answer.Success {
+				return fmt.Errorf("%s: %s", step.response, answer.Message)
+			}
+		case <-time.After(lobbyTimeout):
+			return fmt.Errorf("no %s from the server", step.response)
+		}
+	}
+	return nil
+}
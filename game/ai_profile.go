@@ -0,0 +1,65 @@
+package game
+
+const (
+	DefaultAIDifficulty  = "normal"
+	DefaultAIPersonality = "balanced"
+)
+
+// AIDifficulty is how well the AI plays.
+type AIDifficulty struct {
+	MinHitChance       float64 // MinHitChance is the lowest hit chance the AI takes a shot with, if it has a choice
+	MaxAimErrorDegrees float64 // MaxAimErrorDegrees is how far the free aim of the AI may be off the spot it wants to hit
+	SeesThroughFog     bool    // SeesThroughFog tells the AI where all enemies are at the beginning of its turns
+}
+
+// AIPersonality is how the AI likes to play, as weights for rating a position.
+type AIPersonality struct {
+	Cover          float64 // per level of cover against each known enemy
+	Pressure       float64 // penalty per enemy within the pressure distance
+	Distance       float64 // penalty per block away from the preferred distance to the nearest enemy
+	PreferredRange float64 // preferred distance to the enemies, as a fraction of the effective range of the weapon
+	Objective      float64 // penalty per block away from the enemy spawn area, while no enemy is known
+	ShotReserve    float64 // bonus for having enough AP left for a shot after moving
+	Overwatched    float64 // penalty for moving into a location watched by an enemy
+	Movement       float64 // penalty per movement point spent
+}
+
+// AIProfile is the combination of a difficulty and a personality that an AI seat plays with.
+type AIProfile struct {
+	Difficulty  string
+	Personality string
+	AIDifficulty
+	Weights AIPersonality
+}
+
+// AISeat marks the seat of the creator of a game as played by the AI.
+type AISeat struct {
+	Difficulty  string // empty means DefaultAIDifficulty
+	Personality string // empty means DefaultAIPersonality
+}
+
+func NewAIProfile(difficultyName string, difficulty AIDifficulty, personalityName string, personality AIPersonality) AIProfile {
+	return AIProfile{
+		Difficulty:   difficultyName,
+		Personality:  personalityName,
+		AIDifficulty: difficulty,
+		Weights:      personality,
+	}
+}
+
+// NewDefaultAIProfile is used when there are no profiles in the game data.
+func NewDefaultAIProfile() AIProfile {
+	return NewAIProfile(DefaultAIDifficulty, AIDifficulty{
+		MinHitChance:       0.25,
+		MaxAimErrorDegrees: 2,
+	}, DefaultAIPersonality, AIPersonality{
+		Cover:          1.5,
+		Pressure:       2,
+		Distance:       0.3,
+		PreferredRange: 0.75,
+		Objective:      0.2,
+		ShotReserve:    1.5,
+		Overwatched:    5,
+		Movement:       0.05,
+	})
+}
@@ -0,0 +1,403 @@
+package game
+
+import (
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/memmaker/battleground/engine/util"
+	"github.com/memmaker/battleground/engine/voxel"
+	"math"
+	"sort"
+)
+
+type aiDecisionKind int
+
+const (
+	aiDone aiDecisionKind = iota
+	aiMove
+	aiShoot
+	aiFreeAim
+	aiOverwatch
+	aiThrow
+	aiReload
+)
+
+// aiDecision is the next thing one unit of the AI wants to do.
+type aiDecision struct {
+	kind      aiDecisionKind
+	target    voxel.Int3   // move destination or shot target
+	watched   []voxel.Int3 // overwatch locations
+	throwAt   mgl32.Vec3
+	angles    [][2]float32 // free aim angles, one per bullet
+	itemName  string
+	reasoning string
+}
+
+func (d aiDecision) String() string {
+	return d.reasoning
+}
+
+const (
+	// maxAIActionsPerUnit keeps a unit from looping when the server and the AI disagree about what is possible.
+	maxAIActionsPerUnit = 6
+	// maxOverwatchLocations is about the size of a doorway or a corridor seen from a distance.
+	maxOverwatchLocations = 12
+	// moveThreshold keeps units from shuffling around between positions that are about as good.
+	moveThreshold = 0.5
+)
+
+// decide looks at the situation of the unit like a player would: reload an empty weapon, deal with the enemies
+// in sight, otherwise advance from cover to cover and watch the direction the enemy is expected from.
+func (c *DummyClient) decide(unit *DummyClientUnit) aiDecision {
+	if !unit.CanAct() {
+		return aiDecision{kind: aiDone, reasoning: "no AP left"}
+	}
+	if !unit.GetWeapon().IsReady() {
+		if unit.CanReload() {
+			return aiDecision{kind: aiReload, reasoning: "weapon is empty"}
+		}
+		if move, found := c.bestMove(unit); found {
+			return move
+		}
+		return aiDecision{kind: aiDone, reasoning: "weapon is empty and no AP to reload"}
+	}
+
+	visibleEnemies := c.GetVisibleEnemyUnits(unit.UnitID())
+	if len(visibleEnemies) > 0 {
+		if throw, found := c.bestThrow(unit, visibleEnemies); found {
+			return throw
+		}
+		shot, hitChance, found := c.bestShot(unit, visibleEnemies)
+		if found && hitChance >= c.profile.MinHitChance {
+			return shot
+		}
+		if aimed, foundAim := c.bestFreeAim(unit, visibleEnemies); foundAim {
+			return aimed
+		}
+		if move, foundMove := c.bestMove(unit); foundMove {
+			return move
+		}
+		if found {
+			return shot // nowhere better to go, take the chance
+		}
+		if smoke, foundSmoke := c.smokeCover(unit); foundSmoke {
+			return smoke
+		}
+		return c.overwatchOrDone(unit)
+	}
+
+	if move, found := c.bestMove(unit); found {
+		return move
+	}
+	if unit.GetWeapon().AmmoCount < unit.GetWeapon().Definition.MagazineSize/2 && unit.CanReload() {
+		return aiDecision{kind: aiReload, reasoning: "reloading while nobody is looking"}
+	}
+	return c.overwatchOrDone(unit)
+}
+
+// knownEnemies are the enemies the AI has seen at some point, at the position they were last seen.
+func (c *DummyClient) knownEnemies() []*UnitInstance {
+	var result []*UnitInstance
+	for _, other := range c.GetAllUnits() {
+		if other.IsActive() && !c.IsMyUnit(other.UnitID()) {
+			result = append(result, other)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].UnitID() < result[j].UnitID() })
+	return result
+}
+
+// objective is where the AI goes when it doesn't know where the enemy is: the nearest spawn area of the others.
+func (c *DummyClient) objective(unit *DummyClientUnit) (voxel.Int3, bool) {
+	var best voxel.Int3
+	found := false
+	bestDistance := int32(math.MaxInt32)
+	for index, spawns := range c.mapMeta.SpawnPositions {
+		if uint64(index) == c.GetSpawnIndex() {
+			continue
+		}
+		for _, spawn := range spawns {
+			distance := voxel.ManhattanDistance3(unit.GetBlockPosition(), spawn)
+			if distance < bestDistance {
+				best, bestDistance, found = spawn, distance, true
+			}
+		}
+	}
+	return best, found
+}
+
+// coverAgainst returns 2 for full cover, 1 for half cover and 0 if the position is open towards the threat.
+func coverAgainst(voxelMap *voxel.Map, position, threat voxel.Int3) int {
+	direction := threat.Sub(position).ToCardinalDirection()
+	if direction == (voxel.Int3{}) {
+		return 0
+	}
+	inFront := position.Add(direction)
+	if voxelMap.IsSolidBlockAt(inFront.X, inFront.Y+1, inFront.Z) {
+		return 2
+	}
+	if voxelMap.IsSolidBlockAt(inFront.X, inFront.Y, inFront.Z) {
+		return 1
+	}
+	return 0
+}
+
+// scorePosition rates a position for the unit after spending the given movement cost to get there.
+func (c *DummyClient) scorePosition(unit *DummyClientUnit, position voxel.Int3, cost float64, enemies []*UnitInstance) float64 {
+	rules := c.GetRules()
+	weights := c.profile.Weights
+	weapon := unit.GetWeapon().Definition
+	preferredDistance := math.Min(float64(weapon.EffectiveRange), float64(rules.MaxOverwatchRange)) * weights.PreferredRange
+	apLeft := unit.ActionPoints - cost*unit.APPerMovement()
+
+	score := -weights.Movement * cost
+	if apLeft >= float64(weapon.BaseAPForShot) {
+		score += weights.ShotReserve
+	}
+	if c.isWatchedByEnemy(position) {
+		score -= weights.Overwatched
+	}
+	if len(enemies) == 0 {
+		if goal, found := c.objective(unit); found {
+			score -= float64(voxel.ManhattanDistance3(position, goal)) * weights.Objective
+		}
+		return score
+	}
+
+	nearest := math.MaxFloat64
+	for _, enemy := range enemies {
+		enemyPosition := enemy.GetBlockPosition()
+		distance := position.Sub(enemyPosition).Length()
+		nearest = math.Min(nearest, distance)
+		score += float64(coverAgainst(c.voxelMap, position, enemyPosition)) * weights.Cover
+		if distance <= float64(rules.MaxPressureDistance) {
+			score -= weights.Pressure // that enemy gets a bonus on us and we are in grenade range
+		}
+	}
+	score -= math.Abs(nearest-preferredDistance) * weights.Distance
+	return score
+}
+
+// bestMove picks the reachable position with the best score, if it is clearly better than staying.
+func (c *DummyClient) bestMove(unit *DummyClientUnit) (aiDecision, bool) {
+	if !unit.CanMove() {
+		return aiDecision{}, false
+	}
+	enemies := c.knownEnemies()
+	moveAction := NewActionMove(c.voxelMap, unit.UnitInstance, c.GameInstance)
+	targets := moveAction.GetValidTargets()
+	sort.Slice(targets, func(i, j int) bool { return targets[i].ToString() < targets[j].ToString() }) // deterministic choice for replays
+
+	currentScore := c.scorePosition(unit, unit.GetBlockPosition(), 0, enemies)
+	bestScore := currentScore + moveThreshold
+	var best voxel.Int3
+	found := false
+	for _, target := range targets {
+		score := c.scorePosition(unit, target, moveAction.GetCost(target), enemies)
+		if score > bestScore {
+			best, bestScore, found = target, score, true
+		}
+	}
+	if !found {
+		return aiDecision{}, false
+	}
+	return aiDecision{kind: aiMove, target: best, reasoning: fmt.Sprintf("moving to %s (%0.1f -> %0.1f)", best.ToString(), currentScore, bestScore)}, true
+}
+
+// bestShot rates the visible enemies by the damage to expect and prefers the ones it can finish off.
+func (c *DummyClient) bestShot(unit *DummyClientUnit, enemies []*UnitInstance) (aiDecision, float64, bool) {
+	if !unit.CanSnapshot() {
+		return aiDecision{}, 0, false
+	}
+	weapon := unit.GetWeapon()
+	shotAction := NewActionShot(c.GameInstance, unit.UnitInstance)
+	var best *UnitInstance
+	bestValue, bestHitChance := 0.0, 0.0
+	for _, enemy := range enemies {
+		distance := unit.GetEyePosition().Sub(enemy.GetEyePosition()).Len()
+		if distance > float32(weapon.Definition.MaxRange) || !shotAction.IsValidTarget(enemy.GetBlockPosition()) {
+			continue
+		}
+		hitChance := c.CalculateBaseHitCoverage(unit.UnitInstance, enemy, shotAction)
+		damage := weapon.GetEstimatedDamage(distance)
+		value := hitChance * float64(damage)
+		if damage >= enemy.Health {
+			value *= 2
+		}
+		if value > bestValue {
+			best, bestValue, bestHitChance = enemy, value, hitChance
+		}
+	}
+	if best == nil {
+		return aiDecision{}, 0, false
+	}
+	return aiDecision{kind: aiShoot, target: best.GetBlockPosition(), reasoning: fmt.Sprintf("shooting at %s (%0.0f%%)", best.GetName(), bestHitChance*100)}, bestHitChance, true
+}
+
+// bestFreeAim aims at whatever part of an enemy can be seen, when the snap shot at the center of mass is
+// too likely to hit the cover. The aim is off by up to the MaxAimErrorDegrees of the profile.
+func (c *DummyClient) bestFreeAim(unit *DummyClientUnit, enemies []*UnitInstance) (aiDecision, bool) {
+	if !unit.CanFreeAim() {
+		return aiDecision{}, false
+	}
+	eye := unit.GetEyePosition()
+	maxRange := float32(unit.GetWeapon().Definition.MaxRange)
+	for _, enemy := range enemies {
+		for _, aimPoint := range []mgl32.Vec3{enemy.GetCenterOfMassPosition(), enemy.GetEyePosition()} {
+			direction := aimPoint.Sub(eye)
+			if direction.Len() > maxRange {
+				continue
+			}
+			hit := c.RayCastFreeAim(eye, eye.Add(direction.Normalize().Mul(maxRange)), unit.UnitInstance)
+			if !hit.HitUnit() || hit.UnitHit != enemy {
+				continue
+			}
+			camera := util.NewFPSCamera(eye, 100, 100, 0)
+			camera.SetLookTarget(aimPoint)
+			rotX, rotY := camera.GetRotation()
+			angles := make([][2]float32, unit.GetWeapon().Definition.BulletsPerShot)
+			for i := range angles {
+				angles[i] = [2]float32{rotX + c.aimError(), rotY + c.aimError()}
+			}
+			return aiDecision{kind: aiFreeAim, angles: angles, reasoning: fmt.Sprintf("aiming at %s (%s)", enemy.GetName(), hit.BodyPart)}, true
+		}
+	}
+	return aiDecision{}, false
+}
+
+func (c *DummyClient) aimError() float32 {
+	return float32((c.GetRandom().Float64()*2 - 1) * c.profile.MaxAimErrorDegrees)
+}
+
+// bestThrow throws an explosive at a group of enemies, as long as none of our own units is close to the impact.
+func (c *DummyClient) bestThrow(unit *DummyClientUnit, enemies []*UnitInstance) (aiDecision, bool) {
+	item := c.throwableWith(unit, TargetedEffectExplosion, TargetedEffectPoisonCloud)
+	if item == nil {
+		return aiDecision{}, false
+	}
+	radius := float32(item.Definition.Radius)
+	throwAction := NewActionThrow(c.GameInstance, unit.UnitInstance, item)
+	for _, enemy := range enemies {
+		impact := enemy.GetBlockPosition().ToBlockCenterVec3D()
+		if unit.GetBlockPosition().ToBlockCenterVec3D().Sub(impact).Len() <= radius+1 {
+			continue
+		}
+		hits := 0
+		for _, other := range enemies {
+			if other.GetBlockPosition().ToBlockCenterVec3D().Sub(impact).Len() <= radius {
+				hits++
+			}
+		}
+		if hits < 2 || c.wouldHitOwnUnit(impact, radius+1) || len(throwAction.GetTrajectory(impact)) == 0 {
+			continue
+		}
+		return aiDecision{kind: aiThrow, throwAt: impact, itemName: item.Definition.UniqueName, reasoning: fmt.Sprintf("throwing %s at %d enemies", item.Definition.UniqueName, hits)}, true
+	}
+	return aiDecision{}, false
+}
+
+// smokeCover blinds the enemies when the unit is pinned down in the open.
+func (c *DummyClient) smokeCover(unit *DummyClientUnit) (aiDecision, bool) {
+	if c.GetTotalPressure(unit.UnitID()) == 0 {
+		return aiDecision{}, false
+	}
+	item := c.throwableWith(unit, TargetedEffectSmokeCloud)
+	if item == nil {
+		return aiDecision{}, false
+	}
+	enemies := c.GetVisibleEnemyUnits(unit.UnitID())
+	// the smoke goes between us and the nearest enemy
+	between := unit.GetBlockPosition().ToBlockCenterVec3D().Add(enemies[0].GetBlockPosition().ToBlockCenterVec3D()).Mul(0.5)
+	if len(NewActionThrow(c.GameInstance, unit.UnitInstance, item).GetTrajectory(between)) == 0 {
+		return aiDecision{}, false
+	}
+	return aiDecision{kind: aiThrow, throwAt: between, itemName: item.Definition.UniqueName, reasoning: "throwing smoke for cover"}, true
+}
+
+func (c *DummyClient) throwableWith(unit *DummyClientUnit, effects ...TargetedEffect) *Item {
+	if unit.GetIntegerAP() < int(unit.Definition.CoreStats.BaseAPForThrow) {
+		return nil
+	}
+	for _, item := range unit.GetItems() {
+		if item.Definition.ItemType != ItemTypeGrenade {
+			continue
+		}
+		for _, effect := range effects {
+			if item.Definition.Effect == effect {
+				return item
+			}
+		}
+	}
+	return nil
+}
+
+func (c *DummyClient) wouldHitOwnUnit(impact mgl32.Vec3, radius float32) bool {
+	for _, own := range c.GetMyUnits() {
+		if own.IsActive() && own.GetBlockPosition().ToBlockCenterVec3D().Sub(impact).Len() <= radius {
+			return true
+		}
+	}
+	return false
+}
+
+// overwatchOrDone watches the locations closest to where the enemy is expected, if the unit can afford it.
+func (c *DummyClient) overwatchOrDone(unit *DummyClientUnit) aiDecision {
+	weapon := unit.GetWeapon()
+	if !weapon.IsReady() || unit.GetIntegerAP() < int(weapon.Definition.BaseAPForShot)+1 {
+		return aiDecision{kind: aiDone, reasoning: "not enough AP for overwatch"}
+	}
+	threat, found := c.expectedThreat(unit)
+	if !found {
+		return aiDecision{kind: aiDone, reasoning: "nothing to watch"}
+	}
+	locations := NewActionOverwatch(c.GameInstance, unit.UnitInstance).GetValidTargets()
+	sort.Slice(locations, func(i, j int) bool {
+		distanceI, distanceJ := voxel.ManhattanDistance3(locations[i], threat), voxel.ManhattanDistance3(locations[j], threat)
+		if distanceI != distanceJ {
+			return distanceI < distanceJ
+		}
+		return locations[i].ToString() < locations[j].ToString()
+	})
+	if len(locations) > maxOverwatchLocations {
+		locations = locations[:maxOverwatchLocations]
+	}
+	if len(locations) == 0 {
+		return aiDecision{kind: aiDone, reasoning: "no line of sight to watch"}
+	}
+	return aiDecision{kind: aiOverwatch, watched: locations, reasoning: fmt.Sprintf("watching %d locations towards %s", len(locations), threat.ToString())}
+}
+
+// expectedThreat is the nearest known enemy, or the objective if no enemy has been seen yet.
+func (c *DummyClient) expectedThreat(unit *DummyClientUnit) (voxel.Int3, bool) {
+	enemies := c.knownEnemies()
+	if len(enemies) == 0 {
+		return c.objective(unit)
+	}
+	nearest := enemies[0]
+	for _, enemy := range enemies[1:] {
+		if voxel.ManhattanDistance3(unit.GetBlockPosition(), enemy.GetBlockPosition()) < voxel.ManhattanDistance3(unit.GetBlockPosition(), nearest.GetBlockPosition()) {
+			nearest = enemy
+		}
+	}
+	return nearest.GetBlockPosition(), true
+}
+
+func (c *DummyClient) isWatchedByEnemy(position voxel.Int3) bool {
+	for _, locations := range c.enemyOverwatch {
+		for _, location := range locations {
+			if location == position {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// forgetOverwatchOf drops the overwatch of the units of a player, it ends when that player's turn begins.
+func (c *DummyClient) forgetOverwatchOf(playerID uint64) {
+	for watcherID := range c.enemyOverwatch {
+		watcher, exists := c.GetUnit(watcherID)
+		if !exists || !watcher.IsActive() || watcher.ControlledBy() == playerID {
+			delete(c.enemyOverwatch, watcherID)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package game
+
+import (
+	"github.com/memmaker/battleground/engine/voxel"
+	"testing"
+	"time"
+)
+
+func TestCoverAgainst(t *testing.T) {
+	voxelMap := voxel.NewMapWithEmptyChunks(1, 1, 1, 16, 16)
+	position := voxel.Int3{X: 8, Y: 1, Z: 8}
+	// a wall to the north and a low wall to the east
+	voxelMap.SetBlock(8, 1, 7, voxel.NewBlock(1))
+	voxelMap.SetBlock(8, 2, 7, voxel.NewBlock(1))
+	voxelMap.SetBlock(9, 1, 8, voxel.NewBlock(1))
+
+	tests := []struct {
+		name   string
+		threat voxel.Int3
+		want   int
+	}{
+		{"behind the wall", voxel.Int3{X: 8, Y: 1, Z: 1}, 2},
+		{"mostly north", voxel.Int3{X: 10, Y: 1, Z: 1}, 2},
+		{"behind the low wall", voxel.Int3{X: 15, Y: 1, Z: 8}, 1},
+		{"in the open", voxel.Int3{X: 1, Y: 1, Z: 8}, 0},
+		{"same position", position, 0},
+	}
+	for _, test := range tests {
+		if got := coverAgainst(voxelMap, position, test.threat); got != test.want {
+			t.Errorf("%s: got cover %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAIKeepsPlayingAfterTheTimeWarning(t *testing.T) {
+	c := &DummyClient{}
+	if c.isOutOfTime(time.Now()) {
+		t.Error("a turn without time controls ran out")
+	}
+	c.setTurnDeadline(20)
+	if c.isOutOfTime(time.Now()) {
+		t.Error("the AI gave up its turn with 20 seconds left")
+	}
+	if !c.isOutOfTime(time.Now().Add(20 * time.Second)) {
+		t.Error("the AI kept acting after the deadline")
+	}
+}
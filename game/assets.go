@@ -1,6 +1,8 @@
 package game
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/go-gl/mathgl/mgl32"
 	"github.com/memmaker/battleground/engine/glhf"
 	"github.com/memmaker/battleground/engine/util"
@@ -11,7 +13,9 @@ import (
 )
 
 type Assets struct {
-	paths map[AssetType]string
+	paths          map[AssetType]string
+	modDirectories []string
+	modBlocks      []string
 }
 
 type AssetType int
@@ -35,17 +39,74 @@ func NewAssets() *Assets {
 		},
 	}
 }
+
+// NewAssetsWithMods searches the mod directories for models, maps and skins and adds the blocks of the mods
+// to every block library it loads.
+func NewAssetsWithMods(modDirectories []string, modBlocks []string) *Assets {
+	assets := NewAssets()
+	assets.modDirectories = modDirectories
+	assets.modBlocks = modBlocks
+	return assets
+}
+
+// modAssetPaths are the places of the asset types inside a mod directory.
+var modAssetPaths = map[AssetType]string{
+	AssetTypeMeshes: "models",
+	AssetTypeMaps:   "maps",
+	AssetTypeSkins:  "textures/skins",
+}
+
+// findModFile looks for a file in the active mods, the mod loaded last wins.
+func (a *Assets) findModFile(assetType AssetType, filename string) (string, bool) {
+	subDirectory, moddable := modAssetPaths[assetType]
+	if !moddable {
+		return "", false
+	}
+	for i := len(a.modDirectories) - 1; i >= 0; i-- {
+		filePath := path.Join(a.modDirectories[i], subDirectory, filename)
+		if util.DoesFileExist(filePath) {
+			return filePath, true
+		}
+	}
+	return "", false
+}
+
+func (a *Assets) getFile(assetType AssetType, filename string) string {
+	if filePath, found := a.findModFile(assetType, filename); found {
+		return filePath
+	}
+	return path.Join(a.paths[assetType], filename)
+}
 func (a *Assets) LoadMapWithDetails(mapFile string, details *MissionDetails) *DefaultMapInfo {
-	mapMetadata := a.LoadMapMetadata(mapFile)
+	loadedMap, mapMetadata, library := a.LoadMapFile(mapFile)
 	details.SyncFromMap(mapMetadata)
-	library := a.LoadBlockLibrary(mapMetadata.Blocks)
 	return &DefaultMapInfo{
 		mapFile:      mapFile,
 		details:      details,
 		metaData:     &mapMetadata,
 		blockLibrary: library,
-		loadedMap:    voxel.NewMapFromSource(a.LoadMap(mapFile), nil, nil),
+		loadedMap:    loadedMap,
+	}
+}
+
+// LoadMapFile loads a map with its metadata and block library. Maps of format version 1 get their metadata
+// from the .meta file next to them, they are upgraded to the current format when saved again.
+func (a *Assets) LoadMapFile(mapFile string) (*voxel.Map, MapMetadata, *BlockLibrary) {
+	loadedMap, file, err := voxel.NewMapFromSource(a.LoadMap(mapFile), nil, nil)
+	if err != nil {
+		panic(fmt.Errorf("loading map %s: %w", mapFile, err))
+	}
+	var mapMetadata MapMetadata
+	if file.Version < 2 {
+		mapMetadata = a.LoadMapMetadata(mapFile)
+	} else if err = json.Unmarshal(file.Metadata, &mapMetadata); err != nil {
+		panic(fmt.Errorf("loading the metadata of map %s: %w", mapFile, err))
 	}
+	library := a.LoadBlockLibrary(mapMetadata.Blocks)
+	if unknown := loadedMap.SetBlockNames(library.BlockNames()); len(unknown) > 0 {
+		println(fmt.Sprintf("[Assets] The blocks %v of map %s are unknown and were replaced by air", unknown, mapFile))
+	}
+	return loadedMap, mapMetadata, library
 }
 
 func (a *Assets) LoadBiomeWithDetails(biome Biome, details *MissionDetails) MapInfo {
@@ -72,6 +133,7 @@ func (a *Assets) LoadBlockTextureAtlas(filename string) (*glhf.Texture, *BlockLi
 	indexMap := util.NewBlockIndexFromFile(filePath + ".idx")
 	blockList := util.NewBlockListFromFile(filePath + ".txt")
 	bl := NewBlockLibrary(blockList, indexMap)
+	bl.AddBlocks(a.modBlocks, indexMap)
 	return texture, bl
 }
 
@@ -80,6 +142,7 @@ func (a *Assets) LoadBlockLibrary(filename string) *BlockLibrary {
 	indexMap := util.NewBlockIndexFromFile(filePath + ".idx")
 	blockList := util.NewBlockListFromFile(filePath + ".txt")
 	bl := NewBlockLibrary(blockList, indexMap)
+	bl.AddBlocks(a.modBlocks, indexMap)
 	return bl
 }
 
@@ -121,6 +184,11 @@ func (a *Assets) LoadMeshWithColor(name string, forcedColor mgl32.Vec3) *util.Co
 }
 
 func (a *Assets) getModelFile(name string) string {
+	for _, extension := range []string{".glb", ".gltf"} {
+		if filePath, found := a.findModFile(AssetTypeMeshes, name+extension); found {
+			return filePath
+		}
+	}
 	binPath := path.Join(a.paths[AssetTypeMeshes], name+".glb")
 	if util.DoesFileExist(binPath) {
 		return binPath
@@ -129,7 +197,7 @@ func (a *Assets) getModelFile(name string) string {
 }
 
 func (a *Assets) LoadMap(filename string) []byte {
-	filePath := path.Join(a.paths[AssetTypeMaps], filename+".bin")
+	filePath := a.getFile(AssetTypeMaps, filename+".bin")
 	file, err := os.Open(filePath)
 	if err != nil {
 		panic(err)
@@ -143,16 +211,16 @@ func (a *Assets) LoadMap(filename string) []byte {
 }
 
 func (a *Assets) LoadMapMetadata(filename string) MapMetadata {
-	filePath := path.Join(a.paths[AssetTypeMaps], filename+".bin.meta")
+	filePath := a.getFile(AssetTypeMaps, filename+".bin.meta")
 	return NewMapMetadataFromFile(filePath)
 }
 func (a *Assets) LoadSkin(file string) *glhf.Texture {
-	filePath := path.Join(a.paths[AssetTypeSkins], file+".png")
+	filePath := a.getFile(AssetTypeSkins, file+".png")
 	return mustLoadTexture(filePath)
 }
 
 func (a *Assets) GetMapPath(mapName string) string {
-	return path.Join(a.paths[AssetTypeMaps], mapName+".bin")
+	return a.getFile(AssetTypeMaps, mapName+".bin")
 }
 
 func mustLoadTexture(filePath string) *glhf.Texture {
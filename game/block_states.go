@@ -0,0 +1,78 @@
+package game
+
+import (
+	"github.com/memmaker/battleground/engine/voxel"
+	"sort"
+)
+
+// BlockStateChange is the state of a block together with its location, so it can be sent over the wire.
+type BlockStateChange struct {
+	Position voxel.Int3
+	State    voxel.BlockState
+}
+
+// SetBlockState changes the state of a solid block and remembers it for the players that join later.
+func (g *GameInstance) SetBlockState(pos voxel.Int3, state voxel.BlockState) bool {
+	if !g.voxelMap.SetBlockState(pos, state) {
+		return false
+	}
+	if g.blockStates == nil {
+		g.blockStates = make(map[voxel.Int3]voxel.BlockState)
+		g.pendingBlockStates = make(map[voxel.Int3]voxel.BlockState)
+	}
+	g.blockStates[pos] = state
+	g.pendingBlockStates[pos] = state
+	return true
+}
+
+// GetBlockState returns the state of the block at the position, the zero state for air.
+func (g *GameInstance) GetBlockState(pos voxel.Int3) voxel.BlockState {
+	block := g.voxelMap.GetGlobalBlock(pos.X, pos.Y, pos.Z)
+	if block == nil {
+		return 0
+	}
+	return block.State
+}
+
+// GetChangedBlockStates lists the states of all blocks that changed since the map was loaded.
+func (g *GameInstance) GetChangedBlockStates() []BlockStateChange {
+	return sortedBlockStates(g.blockStates)
+}
+
+// TakeBlockStateChanges returns the block states that changed since the last call, the server sends them to
+// the players after every action.
+func (g *GameInstance) TakeBlockStateChanges() []BlockStateChange {
+	changes := sortedBlockStates(g.pendingBlockStates)
+	clear(g.pendingBlockStates)
+	return changes
+}
+
+// ApplyBlockStates sets the states sent by the server, blocks that are already gone are skipped.
+func (g *GameInstance) ApplyBlockStates(changes []BlockStateChange) {
+	for _, change := range changes {
+		g.SetBlockState(change.Position, change.State)
+	}
+}
+
+func (g *GameInstance) forgetBlockState(pos voxel.Int3) {
+	delete(g.blockStates, pos)
+	delete(g.pendingBlockStates, pos)
+}
+
+func sortedBlockStates(states map[voxel.Int3]voxel.BlockState) []BlockStateChange {
+	changes := make([]BlockStateChange, 0, len(states))
+	for pos, state := range states {
+		changes = append(changes, BlockStateChange{Position: pos, State: state})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i].Position, changes[j].Position
+		if a.X != b.X {
+			return a.X < b.X
+		}
+		if a.Y != b.Y {
+			return a.Y < b.Y
+		}
+		return a.Z < b.Z
+	})
+	return changes
+}
@@ -0,0 +1,84 @@
+package game
+
+import (
+	"github.com/memmaker/battleground/engine/voxel"
+	"slices"
+	"testing"
+)
+
+func TestBlockStatesSurviveTheMapFile(t *testing.T) {
+	voxelMap := voxel.NewMapWithEmptyChunks(1, 1, 1, 16, 16)
+	voxelMap.SetFloorAtHeight(0, voxel.NewBlock(1))
+	voxelMap.SetBlock(3, 1, 3, voxel.NewBlock(2))
+	voxelMap.SetBlockNames([]string{voxel.AirBlockName, "bricks", "door"})
+
+	door := voxel.Int3{X: 3, Y: 1, Z: 3}
+	doorState := voxel.BlockState(0).WithOrientation(1).WithOpen(true)
+	cracked := voxel.Int3{X: 5, Z: 5}
+	if !voxelMap.SetBlockState(door, doorState) || !voxelMap.SetBlockState(cracked, voxel.BlockState(0).WithDamage(3)) {
+		t.Fatal("could not set the block states")
+	}
+	if voxelMap.SetBlockState(voxel.Int3{X: 1, Y: 5, Z: 1}, doorState) {
+		t.Error("air got a block state")
+	}
+	if floor := voxelMap.GetGlobalBlock(6, 0, 6); floor.State != 0 {
+		t.Errorf("the shared floor block changed to %d", floor.State)
+	}
+
+	loadedMap, _ := saveAndLoadMap(t, voxelMap, nil)
+	for _, test := range []struct {
+		position voxel.Int3
+		state    voxel.BlockState
+	}{{door, doorState}, {cracked, voxel.BlockState(0).WithDamage(3)}, {voxel.Int3{X: 6, Z: 6}, 0}} {
+		if block := loadedMap.GetBlockFromVec(test.position); block == nil || block.State != test.state {
+			t.Errorf("the block at %s is %v, want state %d", test.position.ToString(), block, test.state)
+		}
+	}
+	if loaded := loadedMap.GetBlockFromVec(door).State; loaded.Orientation() != 1 || !loaded.IsOpen() || loaded.Damage() != 0 {
+		t.Errorf("the door has orientation %d, open %v and damage %d", loaded.Orientation(), loaded.IsOpen(), loaded.Damage())
+	}
+}
+
+func TestRotatedBlockTextures(t *testing.T) {
+	library := NewBlockLibrary(nil, nil)
+	library.AddBlockDefinition(1, "crate", map[voxel.FaceType]byte{
+		voxel.North: 1, voxel.East: 2, voxel.South: 3, voxel.West: 4, voxel.Top: 5, voxel.Bottom: 6,
+	})
+	crate := voxel.NewBlock(1)
+	crate.State = crate.State.WithOrientation(1)
+	for side, want := range map[voxel.FaceType]byte{
+		voxel.East: 1, voxel.South: 2, voxel.West: 3, voxel.North: 4, voxel.Top: 5, voxel.Bottom: 6,
+	} {
+		if got := library.GetTextureIndexForFaces(crate, side); got != want {
+			t.Errorf("side %d shows texture %d, want %d", side, got, want)
+		}
+	}
+}
+
+func TestBlockStateChangesAreSentOnce(t *testing.T) {
+	voxelMap := voxel.NewMapWithEmptyChunks(1, 1, 1, 16, 16)
+	voxelMap.SetFloorAtHeight(0, voxel.NewBlock(1))
+	g := &GameInstance{voxelMap: voxelMap}
+	g.rules = NewDefaultRuleset(g)
+
+	wall := voxel.Int3{X: 2, Z: 2}
+	g.DamageBlock(wall, 2)
+	g.DamageBlock(wall, 1)
+	want := []BlockStateChange{{Position: wall, State: voxel.BlockState(0).WithDamage(3)}}
+	if changes := g.TakeBlockStateChanges(); !slices.Equal(changes, want) {
+		t.Fatalf("got changes %v, want %v", changes, want)
+	}
+	if changes := g.TakeBlockStateChanges(); len(changes) != 0 {
+		t.Errorf("got changes %v twice", changes)
+	}
+
+	// a player joining later gets the state, unless the block is gone
+	if states := g.GetChangedBlockStates(); !slices.Equal(states, want) {
+		t.Errorf("got states %v, want %v", states, want)
+	}
+	g.rules.IsGroundLayerDestructible = true
+	g.DestroyBlock(wall)
+	if states := g.GetChangedBlockStates(); len(states) != 0 {
+		t.Errorf("the destroyed block kept the state %v", states)
+	}
+}
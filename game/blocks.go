@@ -21,6 +21,7 @@ type BlockDefinition struct {
 	TextureIndicesForFaces map[voxel.FaceType]byte
 	OnDamageReceived       func(blockPos voxel.Int3, damage int)
 	IsBlockingProjectile   func() bool
+	TriggersOnCollapse     bool // the block gets OnDamageReceived when it falls instead of just being removed
 }
 
 func (b *BlockDefinition) IsVoid() bool {
@@ -52,6 +53,18 @@ func NewBlockLibrary(blockNames []string, indexMap util.NameIndex) *BlockLibrary
 func (b *BlockLibrary) LastBlockID() byte {
 	return byte(len(b.blocks) - 1)
 }
+
+// BlockNames returns the names of the blocks indexed by their id, maps use them to store the blocks by name.
+func (b *BlockLibrary) BlockNames() []string {
+	names := make([]string, int(b.LastBlockID())+1)
+	for id, definition := range b.blocks {
+		if int(id) < len(names) {
+			names[id] = definition.UniqueName
+		}
+	}
+	return names
+}
+
 func (b *BlockLibrary) GetTextureIndexForFaces(block *voxel.Block, side voxel.FaceType) byte {
 	if block == nil {
 		return 0
@@ -63,7 +76,7 @@ func (b *BlockLibrary) GetTextureIndexForFaces(block *voxel.Block, side voxel.Fa
 	if blockDefinition == nil {
 		return 0
 	}
-	return blockDefinition.TextureIndicesForFaces[side]
+	return blockDefinition.TextureIndicesForFaces[block.State.SourceFace(side)]
 }
 
 func (b *BlockLibrary) loadFromIndexMap(blockNames []string, indexMap map[string]byte) {
@@ -76,6 +89,19 @@ func (b *BlockLibrary) loadFromIndexMap(blockNames []string, indexMap map[string
 	}
 }
 
+// AddBlocks appends the blocks the library does not know yet, after the ones it already has.
+func (b *BlockLibrary) AddBlocks(blockNames []string, indexMap util.NameIndex) {
+	for _, name := range blockNames {
+		if _, exists := b.nameToId[name]; exists {
+			continue
+		}
+		if b.LastBlockID() == 254 {
+			panic("Too many blocks")
+		}
+		b.AddBlockDefinition(b.LastBlockID()+1, name, getFaceMapForBlock(name, indexMap))
+	}
+}
+
 func (b *BlockLibrary) AddBlockDefinition(blockID byte, name string, indexMap map[voxel.FaceType]byte) {
 	if _, exists := b.blocks[blockID]; exists {
 		panic("Block already exists")
@@ -116,19 +142,23 @@ func (b *BlockLibrary) GetBlockDefinitionByName(name string) *BlockDefinition {
 
 func (b *BlockLibrary) ApplyGameplayRules(a *GameInstance) {
 
+	// the materials decide how much the other blocks can take
+	for _, definition := range b.blocks {
+		if definition.BlockID != 0 {
+			definition.OnDamageReceived = func(block voxel.Int3, damage int) {
+				a.DamageBlock(block, damage)
+			}
+		}
+	}
+
 	tntDef := b.GetBlockDefinitionByName("tnt")
+	tntDef.TriggersOnCollapse = true
 	tntDef.OnDamageReceived = func(block voxel.Int3, damage int) {
 		a.CreateExplodeEffect(block, 4)
 	}
 
-	destroyableDef := b.GetBlockDefinitionByName("bricks")
-	destroyableDef.OnDamageReceived = func(block voxel.Int3, damage int) {
-		if damage > 4 {
-			a.DestroyBlock(block)
-		}
-	}
-
 	destroyableObjectiveDef := b.GetBlockDefinitionByName("target")
+	destroyableObjectiveDef.TriggersOnCollapse = true
 	destroyableObjectiveDef.OnDamageReceived = func(blockPos voxel.Int3, damage int) {
 		missionDetails := a.GetMissionDetails()
 		if missionDetails.TryDamageObjective(blockPos, damage) {
@@ -6,7 +6,11 @@ import (
 )
 
 type LoginMessage struct {
-	Username string
+	Username        string
+	ProtocolVersion int
+	Capabilities    []Capability
+	SessionToken    string // SessionToken is set when resuming a session after a dropped connection
+	ContentHash     string // ContentHash is the ModSet.ContentHash of the client
 }
 
 type SelectFactionMessage struct {
@@ -14,10 +18,10 @@ type SelectFactionMessage struct {
 }
 
 type UnitChoice struct {
-	UnitTypeID uint64
-	Name       string
-	Weapon     string
-	Items      []string
+	UnitType string // UnitType is the name of a unit of the chosen faction
+	Name     string
+	Weapon   string
+	Items    []string
 }
 
 type SelectUnitsMessage struct {
@@ -68,10 +72,48 @@ type CreateGameMessage struct {
 	GameIdentifier string
 	IsPublic       bool
 	MissionDetails *MissionDetails
+	// SpectatorTurnDelay holds back everything spectators see by this many turns
+	SpectatorTurnDelay int
+	Ruleset            string  // Ruleset names one of the rule presets of the server, empty means DefaultRulesetName
+	AI                 *AISeat // AI is set when the creator is an AI client
+}
+
+type ChatChannel string
+
+const (
+	ChatChannelLobby ChatChannel = "lobby" // everyone who is not in a game
+	ChatChannelAll   ChatChannel = "all"   // all players of the game
+	ChatChannelTeam  ChatChannel = "team"  // refused, every player is a side of their own
+)
+
+// MaxChatMessageLength is counted in characters, not bytes.
+const MaxChatMessageLength = 200
+
+type ChatMessage struct {
+	Channel ChatChannel
+	Text    string
+}
+
+type ListGamesMessage struct {
+	Subscribe bool // Subscribe keeps the client updated about changes until it joins a game
+}
+
+type SpectateGameMessage struct {
+	GameID string
 }
 
 type JoinGameMessage struct {
 	GameID string
+	AI     *AISeat // AI is set when the joining client is an AI client
+}
+
+// SaveGameMessage asks the server to write the running game to disk.
+type SaveGameMessage struct {
+}
+
+// LoadGameMessage continues a saved game. The other players get their seats back by joining it under their old names.
+type LoadGameMessage struct {
+	GameID string
 }
 
 type DebugGetServerStateMessage struct {
@@ -0,0 +1,262 @@
+package game
+
+import (
+	"fmt"
+	"github.com/memmaker/battleground/engine/util"
+	"github.com/memmaker/battleground/engine/voxel"
+	"math"
+)
+
+// maxStructureSearch is the number of blocks a structure can have before it is taken to be supported without
+// looking further, so a single explosion can not make the server search the whole map.
+const maxStructureSearch = 20000
+
+// collapsedBlockDamage is the damage a falling block with its own rules takes, enough to set off any of them.
+const collapsedBlockDamage = math.MaxInt32
+
+// CollapsedUnit is a unit that was hit by a collapse, it fell to Position or was buried under the debris.
+type CollapsedUnit struct {
+	UnitID   uint64
+	Position voxel.Int3
+	Damage   int
+	BodyPart util.DamageZone
+	Lethal   bool
+}
+
+// CollapseUnsupportedBlocks looks at the blocks destroyed since the last call. The block groups that are no
+// longer connected to the ground layer fall down, the units standing on them fall with them and the units
+// under them are hit by the debris. Only the server calls this, the clients get the result as a message.
+// The message has all units hit, CollapseSeenBy makes the one for a single player.
+func (g *GameInstance) CollapseUnsupportedBlocks() BlocksCollapsedMessage {
+	var collapse BlocksCollapsedMessage
+	fallen := make(map[uint64]*UnitInstance)
+	for g.structureChecked < len(g.destroyedBlocks) { // explosives set off by the collapse can bring down more
+		destroyed := g.destroyedBlocks[g.structureChecked:]
+		g.structureChecked = len(g.destroyedBlocks)
+		blocks := g.findUnsupportedBlocks(destroyed)
+		if len(blocks) == 0 {
+			continue
+		}
+		collapse.Blocks = append(collapse.Blocks, blocks...)
+		standing, buried := g.unitsHitByCollapse(blocks)
+		for _, pos := range blocks {
+			g.triggerCollapsedBlock(pos)
+			if g.voxelMap.IsSolidBlockAt(pos.X, pos.Y, pos.Z) {
+				g.removeCollapsedBlock(pos)
+			}
+		}
+
+		for _, unit := range standing {
+			if !unit.IsActive() {
+				continue
+			}
+			from := unit.GetBlockPosition()
+			to := g.landingPosition(unit)
+			damage := int(from.Y-to.Y) * g.rules.FallDamagePerBlock
+			if to != from {
+				unit.SetBlockPositionAndUpdateStance(to)
+				fallen[unit.UnitID()] = unit
+			}
+			collapse.Units = append(collapse.Units, g.applyCollapseDamage(unit, damage, util.ZoneLeftLeg))
+		}
+		for _, unit := range buried {
+			if unit.IsActive() {
+				collapse.Units = append(collapse.Units, g.applyCollapseDamage(unit, g.rules.DebrisDamage, util.ZoneTorso))
+			}
+		}
+	}
+	for _, unit := range fallen {
+		if unit.IsActive() {
+			g.UpdateLOSAfterMove(unit)
+		}
+	}
+	if len(collapse.Blocks) > 0 {
+		g.logGameInfo(fmt.Sprintf("[GameInstance] %d blocks collapsed, %d units hit", len(collapse.Blocks), len(collapse.Units)))
+	}
+	return collapse
+}
+
+// CollapseSeenBy is the part of the collapse the player may know about: all the blocks, but only the hits on
+// units the player can see after the fall. It carries the line of sight of the player, the fallen units may
+// have come into view or left it.
+func (g *GameInstance) CollapseSeenBy(playerID uint64, collapse BlocksCollapsedMessage) BlocksCollapsedMessage {
+	seen := BlocksCollapsedMessage{Blocks: collapse.Blocks}
+	for _, hit := range collapse.Units {
+		if g.UnitIsVisibleToPlayer(playerID, hit.UnitID) {
+			seen.Units = append(seen.Units, hit)
+		}
+	}
+	seen.LOSMatrix, seen.Spotted = g.GetLOSState(playerID)
+	seen.PressureMatrix = g.GetPressureMatrix()
+	return seen
+}
+
+// ApplyCollapse repeats a collapse of the server on a client.
+func (g *GameInstance) ApplyCollapse(blocks []voxel.Int3, units []CollapsedUnit) {
+	for _, pos := range blocks {
+		if g.voxelMap.IsSolidBlockAt(pos.X, pos.Y, pos.Z) {
+			g.removeCollapsedBlock(pos)
+		}
+	}
+	for _, hit := range units {
+		unit, exists := g.GetUnit(hit.UnitID)
+		if !exists {
+			continue
+		}
+		if unit.GetBlockPosition() != hit.Position {
+			unit.SetBlockPositionAndUpdateStance(hit.Position)
+		}
+		if hit.Damage > 0 {
+			g.ApplyDamage(nil, unit, hit.Damage, hit.BodyPart)
+		}
+	}
+}
+
+// findUnsupportedBlocks searches from every solid neighbor of the destroyed blocks for a way down to the
+// ground layer. The searches that find none have found a group that has to collapse.
+func (g *GameInstance) findUnsupportedBlocks(destroyed []voxel.Int3) []voxel.Int3 {
+	supported := make(map[voxel.Int3]bool)
+	falling := make(map[voxel.Int3]bool)
+	var unsupported []voxel.Int3
+	for _, pos := range destroyed {
+		for _, start := range g.solidNeighbors(pos) {
+			if supported[start] || falling[start] {
+				continue
+			}
+			group, isSupported := g.searchForGround(start, supported)
+			for _, member := range group {
+				if isSupported {
+					supported[member] = true
+				} else {
+					falling[member] = true
+				}
+			}
+			if !isSupported {
+				unsupported = append(unsupported, group...)
+			}
+		}
+	}
+	return unsupported
+}
+
+// searchForGround walks through the solid blocks connected to start, going down first. It stops when it reaches
+// the ground layer, a block known to be supported or the search limit.
+func (g *GameInstance) searchForGround(start voxel.Int3, supported map[voxel.Int3]bool) ([]voxel.Int3, bool) {
+	visited := map[voxel.Int3]bool{start: true}
+	group := []voxel.Int3{start}
+	stack := []voxel.Int3{start}
+	for len(stack) > 0 {
+		pos := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if pos.Y == 0 || supported[pos] || len(group) > maxStructureSearch {
+			return group, true
+		}
+		for _, neighbor := range g.solidNeighbors(pos) {
+			if !visited[neighbor] {
+				visited[neighbor] = true
+				group = append(group, neighbor)
+				stack = append(stack, neighbor)
+			}
+		}
+	}
+	return group, false
+}
+
+// solidNeighbors lists the solid blocks around the position, the one below comes last so it is searched first.
+func (g *GameInstance) solidNeighbors(pos voxel.Int3) []voxel.Int3 {
+	var neighbors []voxel.Int3
+	for _, offset := range []voxel.Int3{voxel.Up, voxel.NorthDir, voxel.SouthDir, voxel.EastDir, voxel.WestDir, voxel.Up.Mul(-1)} {
+		neighbor := pos.Add(offset)
+		if g.voxelMap.Contains(neighbor.X, neighbor.Y, neighbor.Z) && g.voxelMap.IsSolidBlockAt(neighbor.X, neighbor.Y, neighbor.Z) {
+			neighbors = append(neighbors, neighbor)
+		}
+	}
+	return neighbors
+}
+
+// unitsHitByCollapse finds the units standing on the collapsing blocks and the ones below them.
+// It has to be called before the blocks are removed.
+func (g *GameInstance) unitsHitByCollapse(blocks []voxel.Int3) (standing, buried []*UnitInstance) {
+	collapsing := make(map[voxel.Int3]bool, len(blocks))
+	for _, pos := range blocks {
+		collapsing[pos] = true
+	}
+	hit := make(map[uint64]bool)
+	for _, unit := range g.GetAllUnits() {
+		if !unit.IsActive() {
+			continue
+		}
+		position := unit.GetBlockPosition()
+		for _, offset := range unit.GetOccupiedBlockOffsets(position) {
+			if offset.Y == 0 && collapsing[position.Add(offset).Sub(voxel.Up)] {
+				standing = append(standing, unit)
+				hit[unit.UnitID()] = true
+				break
+			}
+		}
+	}
+	for _, pos := range blocks {
+		if collapsing[pos.Sub(voxel.Up)] {
+			continue // only the lowest block of a column falls on someone
+		}
+		for below := pos.Sub(voxel.Up); below.Y >= 0 && !g.voxelMap.IsSolidBlockAt(below.X, below.Y, below.Z); below = below.Sub(voxel.Up) {
+			block := g.voxelMap.GetGlobalBlock(below.X, below.Y, below.Z)
+			if block == nil || !block.IsOccupied() {
+				continue
+			}
+			unit, isUnit := block.GetOccupant().(*UnitInstance)
+			if isUnit && unit.IsActive() && !hit[unit.UnitID()] {
+				buried = append(buried, unit)
+				hit[unit.UnitID()] = true
+			}
+			break
+		}
+	}
+	return standing, buried
+}
+
+// landingPosition is the first position below the unit with solid ground where it fits, the unit stays where it
+// is if there is none.
+func (g *GameInstance) landingPosition(unit *UnitInstance) voxel.Int3 {
+	position := unit.GetBlockPosition()
+	for landing := position.Sub(voxel.Up); landing.Y > 0; landing = landing.Sub(voxel.Up) {
+		if g.voxelMap.IsSolidBlockAt(landing.X, landing.Y, landing.Z) {
+			return position
+		}
+		if g.voxelMap.IsSolidBlockAt(landing.X, landing.Y-1, landing.Z) {
+			if placeable, _ := g.voxelMap.IsUnitPlaceable(unit, landing); placeable {
+				return landing
+			}
+			return position
+		}
+	}
+	return position
+}
+
+func (g *GameInstance) applyCollapseDamage(unit *UnitInstance, damage int, zone util.DamageZone) CollapsedUnit {
+	hit := CollapsedUnit{UnitID: unit.UnitID(), Position: unit.GetBlockPosition(), Damage: damage, BodyPart: zone}
+	if damage > 0 {
+		hit.Lethal = g.ApplyDamage(nil, unit, damage, zone)
+	}
+	return hit
+}
+
+// triggerCollapsedBlock lets the blocks with rules of their own, like explosives and mission objectives, react to
+// the collapse as if they were destroyed.
+func (g *GameInstance) triggerCollapsedBlock(pos voxel.Int3) {
+	if g.blockLibrary == nil {
+		return
+	}
+	definition := g.GetBlockDefAt(pos)
+	if definition != nil && definition.TriggersOnCollapse && definition.OnDamageReceived != nil {
+		definition.OnDamageReceived(pos, collapsedBlockDamage)
+	}
+}
+
+// removeCollapsedBlock takes the block out of the map without the rules of DestroyBlock, a collapse can take
+// the ground layer with it only if it was not connected to it.
+func (g *GameInstance) removeCollapsedBlock(pos voxel.Int3) {
+	g.voxelMap.SetAir(pos)
+	g.forgetBlockState(pos)
+	g.destroyedBlocks = append(g.destroyedBlocks, pos)
+}
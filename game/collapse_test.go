@@ -0,0 +1,136 @@
+package game
+
+import (
+	"github.com/memmaker/battleground/engine/util"
+	"github.com/memmaker/battleground/engine/voxel"
+	"testing"
+)
+
+// newCollapseGame is a floor of 5x5 blocks at height 4, resting on a single pillar in its middle.
+func newCollapseGame(t *testing.T) *GameInstance {
+	t.Helper()
+	voxelMap := voxel.NewMapWithEmptyChunks(1, 1, 1, 16, 16)
+	voxelMap.SetFloorAtHeight(0, voxel.NewBlock(1))
+	for y := int32(1); y <= 3; y++ {
+		voxelMap.SetBlock(5, y, 5, voxel.NewBlock(1))
+	}
+	for x := int32(3); x <= 7; x++ {
+		for z := int32(3); z <= 7; z++ {
+			voxelMap.SetBlock(x, 4, z, voxel.NewBlock(1))
+		}
+	}
+	voxelMap.SetBlock(12, 1, 12, voxel.NewBlock(1))
+	g := &GameInstance{voxelMap: voxelMap, units: make(map[uint64]*UnitInstance)}
+	g.rules = NewDefaultRuleset(g)
+	return g
+}
+
+func addCollapseUnit(g *GameInstance, id uint64, position voxel.Int3) *UnitInstance {
+	unit := newPathingUnit(g.voxelMap, id, position)
+	unit.DamageZones = make(map[util.DamageZone]int)
+	g.units[id] = unit
+	return unit
+}
+
+func TestUnsupportedFloorCollapses(t *testing.T) {
+	g := newCollapseGame(t)
+	onTop := addCollapseUnit(g, 0, voxel.Int3{X: 4, Y: 5, Z: 4})
+	below := addCollapseUnit(g, 1, voxel.Int3{X: 7, Y: 1, Z: 3})
+	aside := addCollapseUnit(g, 2, voxel.Int3{X: 10, Y: 1, Z: 10})
+
+	g.DestroyBlock(voxel.Int3{X: 12, Y: 1, Z: 12})
+	if collapse := g.CollapseUnsupportedBlocks(); len(collapse.Blocks) != 0 {
+		t.Fatalf("destroying a lone block collapsed %v", collapse.Blocks)
+	}
+
+	g.DestroyBlock(voxel.Int3{X: 5, Y: 2, Z: 5})
+	collapse := g.CollapseUnsupportedBlocks()
+	if len(collapse.Blocks) != 26 {
+		t.Fatalf("%d blocks collapsed, want the floor and the top of the pillar", len(collapse.Blocks))
+	}
+	if g.voxelMap.IsSolidBlockAt(5, 3, 5) || g.voxelMap.IsSolidBlockAt(3, 4, 7) || !g.voxelMap.IsSolidBlockAt(5, 1, 5) {
+		t.Error("the wrong blocks collapsed")
+	}
+	if position := onTop.GetBlockPosition(); position != (voxel.Int3{X: 4, Y: 1, Z: 4}) {
+		t.Errorf("the unit on the floor landed at %s", position.ToString())
+	}
+	if onTop.Health != 10-4*g.rules.FallDamagePerBlock {
+		t.Errorf("the fall left the unit with %d health", onTop.Health)
+	}
+	if below.Health != 10-g.rules.DebrisDamage {
+		t.Errorf("the debris left the unit below with %d health", below.Health)
+	}
+	if aside.Health != 10 || len(collapse.Units) != 2 {
+		t.Errorf("%d units were hit by the collapse", len(collapse.Units))
+	}
+	if again := g.CollapseUnsupportedBlocks(); len(again.Blocks) != 0 {
+		t.Errorf("the collapse happened twice: %v", again.Blocks)
+	}
+
+	// a client repeats the collapse from the message
+	client := newCollapseGame(t)
+	clientUnit := addCollapseUnit(client, 0, voxel.Int3{X: 4, Y: 5, Z: 4})
+	client.DestroyBlock(voxel.Int3{X: 5, Y: 2, Z: 5})
+	client.ApplyCollapse(collapse.Blocks, collapse.Units)
+	if client.voxelMap.IsSolidBlockAt(6, 4, 6) || clientUnit.GetBlockPosition() != onTop.GetBlockPosition() || clientUnit.Health != onTop.Health {
+		t.Errorf("the client did not repeat the collapse, the unit is at %s with %d health", clientUnit.GetBlockPosition().ToString(), clientUnit.Health)
+	}
+}
+
+func TestPlayersOnlyLearnAboutTheUnitsTheyCanSee(t *testing.T) {
+	g := newCollapseGame(t)
+	for z := int32(0); z < 16; z++ {
+		for y := int32(1); y <= 3; y++ {
+			g.voxelMap.SetBlock(9, y, z, voxel.NewBlock(1))
+		}
+	}
+	onTop := addCollapseUnit(g, 0, voxel.Int3{X: 4, Y: 5, Z: 4})
+	below := addCollapseUnit(g, 1, voxel.Int3{X: 7, Y: 1, Z: 3})
+	observer := addCollapseUnit(g, 2, voxel.Int3{X: 11, Y: 1, Z: 4})
+	onTop.SetControlledBy(2)
+	below.SetControlledBy(2)
+	observer.SetControlledBy(1)
+	g.players = []uint64{1, 2}
+	g.playerUnits = map[uint64][]uint64{1: {2}, 2: {0, 1}}
+	g.losMatrix = map[uint64]map[uint64]bool{2: {0: true, 1: false}} // the observer saw the unit on the floor
+	g.pressureMatrix = make(map[uint64]map[uint64]float64)
+
+	g.DestroyBlock(voxel.Int3{X: 5, Y: 2, Z: 5})
+	collapse := g.CollapseUnsupportedBlocks()
+	if len(collapse.Units) != 2 {
+		t.Fatalf("%d units were hit by the collapse", len(collapse.Units))
+	}
+	if g.losMatrix[observer.UnitID()][onTop.UnitID()] {
+		t.Error("the observer still sees the unit that fell behind the wall")
+	}
+
+	seenByObserver := g.CollapseSeenBy(1, collapse)
+	if len(seenByObserver.Units) != 0 || len(seenByObserver.Spotted) != 0 {
+		t.Errorf("the observer learned about %d hidden units", len(seenByObserver.Units)+len(seenByObserver.Spotted))
+	}
+	if len(seenByObserver.Blocks) != len(collapse.Blocks) || seenByObserver.LOSMatrix[observer.UnitID()][onTop.UnitID()] {
+		t.Error("the observer did not get the blocks and its new line of sight")
+	}
+	if seenByOwner := g.CollapseSeenBy(2, collapse); len(seenByOwner.Units) != 2 {
+		t.Errorf("the owner of the units learned about %d of them", len(seenByOwner.Units))
+	}
+}
+
+func TestCollapsingObjectiveIsDestroyed(t *testing.T) {
+	g := newCollapseGame(t)
+	library := NewBlockLibrary([]string{"bricks", "tnt", "target"}, nil)
+	objective := voxel.Int3{X: 3, Y: 4, Z: 7}
+	g.voxelMap.SetBlock(objective.X, objective.Y, objective.Z, library.NewBlockFromName("target"))
+	g.blockLibrary = library
+	g.missionDetails = &MissionDetails{Scenario: MissionScenarioDefend, DestroyableObjectives: []voxel.Int3{objective}, ObjectiveLife: 10}
+	library.ApplyGameplayRules(g)
+
+	g.DestroyBlock(voxel.Int3{X: 5, Y: 2, Z: 5})
+	collapse := g.CollapseUnsupportedBlocks()
+	if len(collapse.Blocks) != 26 || g.voxelMap.IsSolidBlockAt(objective.X, objective.Y, objective.Z) {
+		t.Fatalf("%d blocks collapsed, the objective is still there: %v", len(collapse.Blocks), g.voxelMap.IsSolidBlockAt(objective.X, objective.Y, objective.Z))
+	}
+	if !g.missionDetails.AllObjectivesDestroyed() {
+		t.Error("the objective fell down without being destroyed")
+	}
+}
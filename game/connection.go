@@ -3,17 +3,31 @@ package game
 import (
 	"bufio"
 	"encoding/json"
+	"fmt"
 	"github.com/go-gl/mathgl/mgl32"
+	"github.com/memmaker/battleground/engine/util"
 	"github.com/memmaker/battleground/engine/voxel"
 	"log"
 	"net"
-	"strings"
+	"sync"
+	"time"
 )
 
+// ReconnectAttempts and ReconnectInterval decide how long a client tries to get its session back
+// after the connection dropped. Together they should stay below the grace period of the server.
+const ReconnectAttempts = 30
+const ReconnectInterval = 2 * time.Second
+
 type ServerConnection struct {
 	connection        net.Conn
+	connectionLock    sync.Mutex // connectionLock guards the connection, the session token and the capabilities
+	transport         Transport
+	username          string
+	sessionToken      string
 	eventHandler      func(msg StringMessage)
 	mainthreadChannel chan StringMessage
+	capabilities      []Capability
+	mods              *ModSet // mods decide the content hash of the login and the files of the games, nil is the base game
 }
 
 type StringMessage struct {
@@ -22,76 +36,141 @@ type StringMessage struct {
 }
 
 func NewTCPConnection(endpoint string) *ServerConnection {
-	con, err := net.Dial("tcp", endpoint)
-	if err != nil {
-		log.Fatalln(err)
-	}
-	println("Connected to server")
-	s := &ServerConnection{connection: con}
-	go s.readLoop(bufio.NewReader(con))
-	return s
+	return NewConnection(TCPTransport{Endpoint: endpoint})
 }
 
 func NewTCPConnectionWithHandler(endpoint string, handler func(msg StringMessage)) *ServerConnection {
-	con, err := net.Dial("tcp", endpoint)
+	return NewConnectionWithHandler(TCPTransport{Endpoint: endpoint}, handler)
+}
+
+// NewConnection connects to the server through the transport, a MemoryTransport for a server in the same process.
+func NewConnection(transport Transport) *ServerConnection {
+	return NewConnectionWithHandler(transport, nil)
+}
+
+func NewConnectionWithHandler(transport Transport, handler func(msg StringMessage)) *ServerConnection {
+	con, err := transport.Dial()
 	if err != nil {
 		log.Fatalln(err)
 	}
 	println("Connected to server")
-	s := &ServerConnection{connection: con}
-	s.SetEventHandler(handler)
+	s := &ServerConnection{connection: con, transport: transport}
+	if handler != nil {
+		s.SetEventHandler(handler)
+	}
 	go s.readLoop(bufio.NewReader(con))
 	return s
 }
 func (c *ServerConnection) Login(username string) error {
-	message := LoginMessage{Username: username}
+	c.username = username
+	message := LoginMessage{Username: username, ProtocolVersion: ProtocolVersion, Capabilities: SupportedCapabilities, ContentHash: c.contentHash()}
 	return c.send("Login", message)
 }
 
+// SetModSet has to be called before the login, the server only lets in clients with the same content.
+func (c *ServerConnection) SetModSet(mods *ModSet) {
+	c.mods = mods
+}
+
+func (c *ServerConnection) contentHash() string {
+	if c.mods == nil {
+		return ""
+	}
+	return c.mods.ContentHash
+}
+
+// NewAssets finds the files of the mods of this connection before the ones of the base game.
+func (c *ServerConnection) NewAssets() *Assets {
+	if c.mods == nil {
+		return NewAssets()
+	}
+	return NewAssetsWithMods(c.mods.Directories, c.mods.Blocks)
+}
+
+// HasCapability is only meaningful after the server has answered the login request.
+func (c *ServerConnection) HasCapability(capability Capability) bool {
+	c.connectionLock.Lock()
+	defer c.connectionLock.Unlock()
+	return HasCapability(c.capabilities, capability)
+}
+
 func (c *ServerConnection) SelectFaction(factionName string) error {
 	message := SelectFactionMessage{FactionName: factionName}
 	return c.send("SelectFaction", message)
 }
 
-func (c *ServerConnection) CreateGame(mapName string, gameID string, details *MissionDetails, isPublic bool) error {
-	message := CreateGameMessage{Map: mapName, GameIdentifier: gameID, IsPublic: isPublic, MissionDetails: details}
+func (c *ServerConnection) CreateGame(mapName string, gameID string, details *MissionDetails, isPublic bool, spectatorTurnDelay int, ruleset string, ai *AISeat) error {
+	message := CreateGameMessage{Map: mapName, GameIdentifier: gameID, IsPublic: isPublic, MissionDetails: details, SpectatorTurnDelay: spectatorTurnDelay, Ruleset: ruleset, AI: ai}
 	return c.send("CreateGame", message)
 }
 
+func (c *ServerConnection) SendChat(channel ChatChannel, text string) error {
+	message := ChatMessage{Channel: channel, Text: text}
+	return c.send("Chat", message)
+}
+
+func (c *ServerConnection) ListGames(subscribe bool) error {
+	message := ListGamesMessage{Subscribe: subscribe}
+	return c.send("ListGames", message)
+}
+
+func (c *ServerConnection) SpectateGame(gameID string) error {
+	message := SpectateGameMessage{GameID: gameID}
+	return c.send("SpectateGame", message)
+}
+
 func (c *ServerConnection) JoinGame(gameID string) error {
 	message := JoinGameMessage{GameID: gameID}
 	return c.send("JoinGame", message)
 }
 
+// JoinGameAsAI takes a seat that is played by the AI with the given difficulty and personality.
+func (c *ServerConnection) JoinGameAsAI(gameID string, seat AISeat) error {
+	message := JoinGameMessage{GameID: gameID, AI: &seat}
+	return c.send("JoinGame", message)
+}
+
+func (c *ServerConnection) SaveGame() error {
+	return c.send("SaveGame", SaveGameMessage{})
+}
+
+func (c *ServerConnection) LoadGame(gameID string) error {
+	message := LoadGameMessage{GameID: gameID}
+	return c.send("LoadGame", message)
+}
+
 func (c *ServerConnection) send(messageType string, message any) error {
 	dataAsJson, err := json.Marshal(message)
 	if err != nil {
 		return err
 	}
 	//println(fmt.Sprintf("[ServerConnection] Sending message: %s", messageType))
-	_, err = c.connection.Write(append([]byte(messageType), '\n'))
-	_, err = c.connection.Write(append(dataAsJson, '\n'))
+	c.connectionLock.Lock()
+	defer c.connectionLock.Unlock()
+	err = WriteFrame(c.connection, messageType, dataAsJson)
+	if err != nil && c.sessionToken != "" {
+		// the read loop is already trying to get the session back, the caller can send the command again later
+		return fmt.Errorf("%s %w: %s", messageType, util.ErrNotSent, err)
+	}
 	return err
 }
 
 func (c *ServerConnection) readLoop(serverReader *bufio.Reader) {
 	for {
-		// our protocol is: messageType (string) + \n + data as json (string) + \n
-		messageType, err := serverReader.ReadString('\n')
-		if err != nil {
-			log.Println(err)
-			return
-		}
-		message, err := serverReader.ReadString('\n')
+		messageType, message, err := ReadFrame(serverReader)
 		if err != nil {
 			log.Println(err)
-			return
+			if !c.reconnect() {
+				return
+			}
+			serverReader = bufio.NewReader(c.connection)
+			continue
 		}
-
-		message = strings.TrimSpace(message)
-		messageType = strings.TrimSpace(messageType)
 		//println(fmt.Sprintf("[ServerConnection] Received message: %s", messageType))
-		msg := StringMessage{MessageType: messageType, Message: message}
+		msg := StringMessage{MessageType: messageType, Message: string(message)}
+		if messageType == "LoginResponse" {
+			c.onLoginResponse(msg.Message)
+		}
 		if c.eventHandler != nil {
 			c.eventHandler(msg)
 		} else if c.mainthreadChannel != nil {
@@ -102,6 +181,85 @@ func (c *ServerConnection) readLoop(serverReader *bufio.Reader) {
 	}
 }
 
+func (c *ServerConnection) onLoginResponse(message string) {
+	var response LoginResponse
+	if !util.FromJson(message, &response) {
+		return
+	}
+	if !response.Success {
+		log.Printf("Login rejected: %s", response.Message)
+		c.setSessionToken("")
+		return
+	}
+	if response.ProtocolVersion != ProtocolVersion {
+		log.Printf("Server speaks protocol version %d, we speak %d", response.ProtocolVersion, ProtocolVersion)
+	}
+	c.connectionLock.Lock()
+	c.capabilities = response.Capabilities
+	c.sessionToken = response.SessionToken
+	c.connectionLock.Unlock()
+}
+
+func (c *ServerConnection) getSessionToken() string {
+	c.connectionLock.Lock()
+	defer c.connectionLock.Unlock()
+	return c.sessionToken
+}
+
+func (c *ServerConnection) setSessionToken(token string) {
+	c.connectionLock.Lock()
+	c.sessionToken = token
+	c.connectionLock.Unlock()
+}
+
+// reconnect dials the server again and logs in with the session token, if the server gave us one.
+func (c *ServerConnection) reconnect() bool {
+	c.connectionLock.Lock()
+	if c.sessionToken == "" {
+		c.connectionLock.Unlock()
+		return false
+	}
+	c.connection.Close()
+	c.connectionLock.Unlock()
+	for attempt := 1; attempt <= ReconnectAttempts; attempt++ {
+		time.Sleep(ReconnectInterval)
+		sessionToken := c.getSessionToken()
+		if sessionToken == "" {
+			return false // closed while we were waiting
+		}
+		con, err := c.transport.Dial()
+		if err != nil {
+			log.Printf("Reconnect attempt %d/%d failed: %s", attempt, ReconnectAttempts, err)
+			continue
+		}
+		message := LoginMessage{Username: c.username, ProtocolVersion: ProtocolVersion, Capabilities: SupportedCapabilities, SessionToken: sessionToken, ContentHash: c.contentHash()}
+		dataAsJson, _ := json.Marshal(message)
+		if err = WriteFrame(con, "Login", dataAsJson); err != nil {
+			con.Close()
+			continue
+		}
+		c.connectionLock.Lock()
+		if c.sessionToken == "" {
+			c.connectionLock.Unlock()
+			con.Close()
+			return false
+		}
+		c.connection = con
+		c.connectionLock.Unlock()
+		println("Reconnected to server")
+		return true
+	}
+	return false
+}
+
+// Close ends the connection for good, without trying to get the session back.
+func (c *ServerConnection) Close() error {
+	c.connectionLock.Lock()
+	defer c.connectionLock.Unlock()
+	c.sessionToken = ""
+	return c.connection.Close()
+}
+
 func (c *ServerConnection) SetEventHandler(handler func(msg StringMessage)) {
 	c.eventHandler = handler
 	c.mainthreadChannel = nil
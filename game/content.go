@@ -0,0 +1,422 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/memmaker/battleground/engine/util"
+	"github.com/memmaker/battleground/engine/voxel"
+	"os"
+	"path"
+)
+
+// ContentDefinitions are the factions, unit types, weapons, items, rule presets, AI profiles and block materials a server offers.
+// They are read from the JSON files of a data directory, see LoadContentDefinitions.
+type ContentDefinitions struct {
+	AnimationPresets map[string]map[string]string // preset name -> animation map
+	Factions         []FactionDefinition
+	Weapons          []WeaponDefinition
+	Items            []ItemDefinition
+	RulePresets      map[string]Ruleset // preset name -> rules, there is always a DefaultRulesetName preset
+	AIDifficulties   map[string]AIDifficulty
+	AIPersonalities  map[string]AIPersonality
+	BlockMaterials   map[string]BlockMaterial // block name -> material, there is always a DefaultMaterialName entry
+}
+
+// aiEntries is the content of ai.json.
+type aiEntries struct {
+	Difficulties  map[string]AIDifficulty
+	Personalities map[string]AIPersonality
+}
+
+// unitEntry is a unit definition as it is written in factions.json.
+// Instead of a full AnimationMap, it can name one of the presets from animations.json.
+type unitEntry struct {
+	UnitDefinition
+	AnimationPreset string
+}
+
+type factionEntry struct {
+	Name  string
+	Color mgl32.Vec3
+	Units []unitEntry
+}
+
+const (
+	animationsFile = "animations.json"
+	factionsFile   = "factions.json"
+	weaponsFile    = "weapons.json"
+	itemsFile      = "items.json"
+	rulesFile      = "rules.json"
+	aiFile         = "ai.json"
+	materialsFile  = "materials.json"
+)
+
+// contentFiles is the raw content of a data directory, before the presets are resolved.
+type contentFiles struct {
+	animationPresets map[string]map[string]string
+	factions         []factionEntry
+	weapons          []WeaponDefinition
+	items            []ItemDefinition
+	rulePresets      map[string]Ruleset
+	ai               aiEntries
+	blockMaterials   map[string]BlockMaterial
+}
+
+// LoadContentDefinitions reads animations.json, factions.json, weapons.json, items.json, rules.json, ai.json and materials.json
+// from the directory.
+// Unknown fields are rejected and every definition is checked, all problems are reported together.
+func LoadContentDefinitions(directory string) (*ContentDefinitions, error) {
+	files, err := readContentFiles(directory, false)
+	if err != nil {
+		return nil, err
+	}
+	return files.resolve()
+}
+
+// readContentFiles reads the content files of a directory. With optional set, missing files are skipped.
+func readContentFiles(directory string, optional bool) (*contentFiles, error) {
+	files := &contentFiles{}
+	targets := []struct {
+		filename string
+		target   any
+	}{
+		{animationsFile, &files.animationPresets},
+		{factionsFile, &files.factions},
+		{weaponsFile, &files.weapons},
+		{itemsFile, &files.items},
+		{rulesFile, &files.rulePresets},
+		{aiFile, &files.ai},
+		{materialsFile, &files.blockMaterials},
+	}
+	for _, file := range targets {
+		if optional && !util.DoesFileExist(path.Join(directory, file.filename)) {
+			continue
+		}
+		if err := decodeContentFile(directory, file.filename, file.target); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func (f *contentFiles) resolve() (*ContentDefinitions, error) {
+	content := &ContentDefinitions{
+		AnimationPresets: f.animationPresets,
+		Weapons:          f.weapons,
+		Items:            f.items,
+		RulePresets:      f.rulePresets,
+		AIDifficulties:   f.ai.Difficulties,
+		AIPersonalities:  f.ai.Personalities,
+		BlockMaterials:   f.blockMaterials,
+	}
+	var problems []error
+	problems = append(problems, validateAnimationPresets(content.AnimationPresets)...)
+	content.Factions, problems = resolveFactions(f.factions, content.AnimationPresets, problems)
+	problems = append(problems, validateWeapons(content.Weapons)...)
+	problems = append(problems, validateItems(content.Items)...)
+	problems = append(problems, validateRulePresets(content.RulePresets)...)
+	problems = append(problems, validateAIProfiles(content.AIDifficulties, content.AIPersonalities)...)
+	problems = append(problems, validateBlockMaterials(content.BlockMaterials)...)
+	if len(problems) > 0 {
+		return nil, errors.Join(problems...)
+	}
+	return content, nil
+}
+
+func decodeContentFile(directory, filename string, target any) error {
+	file, err := os.Open(path.Join(directory, filename))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(target); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
+}
+
+func contentError(filename, context, format string, args ...any) error {
+	return fmt.Errorf("%s: %s: %s", filename, context, fmt.Sprintf(format, args...))
+}
+
+func isKnownAnimation(animation string) bool {
+	switch HumanoidAnimation(animation) {
+	case AnimationIdle, AnimationWeaponIdle, AnimationWallIdleLeft, AnimationWallIdleRight, AnimationWalk,
+		AnimationWeaponWalk, AnimationClimb, AnimationDrop, AnimationDeath, AnimationHit, AnimationWeaponFire, AnimationDebug:
+		return true
+	}
+	return false
+}
+
+// isKnownHazard leaves out HazardTerrain, the terrain costs are set per block.
+func isKnownHazard(kind HazardKind) bool {
+	switch kind {
+	case HazardFire, HazardPoison, HazardSmoke, HazardOverwatch:
+		return true
+	}
+	return false
+}
+
+func isKnownEffect(effect TargetedEffect) bool {
+	switch effect {
+	case TargetedEffectNone, TargetedEffectSmokeCloud, TargetedEffectPoisonCloud, TargetedEffectFire, TargetedEffectExplosion:
+		return true
+	}
+	return false
+}
+
+func validateAnimationMap(filename, context string, animationMap map[string]string) []error {
+	var problems []error
+	for clip, animation := range animationMap {
+		if !isKnownAnimation(animation) {
+			problems = append(problems, contentError(filename, context, "clip '%s' is mapped to unknown animation '%s'", clip, animation))
+		}
+	}
+	return problems
+}
+
+func validateAnimationPresets(presets map[string]map[string]string) []error {
+	var problems []error
+	for name, animationMap := range presets {
+		problems = append(problems, validateAnimationMap(animationsFile, fmt.Sprintf("preset '%s'", name), animationMap)...)
+	}
+	return problems
+}
+
+// resolveFactions replaces the preset names by their animation maps. The clients choose their units by name
+// inside their faction, so a mod can replace one faction without touching the others.
+func resolveFactions(entries []factionEntry, presets map[string]map[string]string, problems []error) ([]FactionDefinition, []error) {
+	var factions []FactionDefinition
+	factionNames := make(map[string]bool)
+	for i, entry := range entries {
+		context := fmt.Sprintf("faction #%d '%s'", i+1, entry.Name)
+		if entry.Name == "" {
+			problems = append(problems, contentError(factionsFile, context, "name is missing"))
+		} else if factionNames[entry.Name] {
+			problems = append(problems, contentError(factionsFile, context, "name is used twice"))
+		}
+		factionNames[entry.Name] = true
+
+		faction := FactionDefinition{Name: entry.Name, Color: entry.Color}
+		unitNames := make(map[string]bool)
+		for j, unit := range entry.Units {
+			unitContext := fmt.Sprintf("%s, unit #%d '%s'", context, j+1, unit.Name)
+			if unit.Name == "" {
+				problems = append(problems, contentError(factionsFile, unitContext, "name is missing"))
+			} else if unitNames[unit.Name] {
+				problems = append(problems, contentError(factionsFile, unitContext, "name is used twice in the faction"))
+			}
+			unitNames[unit.Name] = true
+			unit.Faction = entry.Name
+			if unit.AnimationPreset != "" {
+				animationMap, exists := presets[unit.AnimationPreset]
+				if !exists {
+					problems = append(problems, contentError(factionsFile, unitContext, "unknown animation preset '%s'", unit.AnimationPreset))
+				} else if unit.AnimationMap != nil {
+					problems = append(problems, contentError(factionsFile, unitContext, "has both an AnimationMap and an AnimationPreset"))
+				}
+				unit.AnimationMap = animationMap
+			} else {
+				problems = append(problems, validateAnimationMap(factionsFile, unitContext, unit.AnimationMap)...)
+			}
+			problems = append(problems, validateUnit(unitContext, unit.UnitDefinition)...)
+			faction.Units = append(faction.Units, unit.UnitDefinition)
+		}
+		factions = append(factions, faction)
+	}
+	return factions, problems
+}
+
+func validateUnit(context string, unit UnitDefinition) []error {
+	var problems []error
+	if unit.ModelFile == "" {
+		problems = append(problems, contentError(factionsFile, context, "ModelFile is missing"))
+	}
+	stats := unit.CoreStats
+	if stats.Health <= 0 {
+		problems = append(problems, contentError(factionsFile, context, "Health must be positive"))
+	}
+	if stats.Accuracy < 0 || stats.Accuracy > 1 {
+		problems = append(problems, contentError(factionsFile, context, "Accuracy must be between 0 and 1"))
+	}
+	if stats.MovementPerAP <= 0 {
+		problems = append(problems, contentError(factionsFile, context, "MovementPerAP must be positive"))
+	}
+	if stats.MaxActionPoints <= 0 {
+		problems = append(problems, contentError(factionsFile, context, "MaxActionPoints must be positive"))
+	}
+	if stats.ThrowVelocity < 0 || stats.BaseAPForThrow < 0 {
+		problems = append(problems, contentError(factionsFile, context, "ThrowVelocity and BaseAPForThrow must not be negative"))
+	}
+	if footprint := unit.Footprint; footprint != (Footprint{}) {
+		for _, size := range []int32{footprint.Width, footprint.Length, footprint.Height} {
+			if size < 1 || size > MaxFootprintSize {
+				problems = append(problems, contentError(factionsFile, context, "Footprint sizes must be between 1 and %d, got %dx%dx%d", MaxFootprintSize, footprint.Width, footprint.Length, footprint.Height))
+				break
+			}
+		}
+	}
+	return problems
+}
+
+func validateWeapons(weapons []WeaponDefinition) []error {
+	var problems []error
+	names := make(map[string]bool)
+	for i, weapon := range weapons {
+		context := fmt.Sprintf("weapon #%d '%s'", i+1, weapon.UniqueName)
+		if weapon.UniqueName == "" {
+			problems = append(problems, contentError(weaponsFile, context, "UniqueName is missing"))
+		} else if names[weapon.UniqueName] {
+			problems = append(problems, contentError(weaponsFile, context, "UniqueName is used twice"))
+		}
+		names[weapon.UniqueName] = true
+
+		switch weapon.WeaponType {
+		case WeaponAutomatic, WeaponShotgun, WeaponSniper, WeaponPistol, WeaponRocketLauncher:
+		default:
+			problems = append(problems, contentError(weaponsFile, context, "unknown WeaponType '%s'", weapon.WeaponType))
+		}
+		if weapon.Model == "" {
+			problems = append(problems, contentError(weaponsFile, context, "Model is missing"))
+		}
+		if weapon.AccuracyModifier <= 0 || weapon.AccuracyModifier > 1 {
+			problems = append(problems, contentError(weaponsFile, context, "AccuracyModifier must be greater than 0 and at most 1"))
+		}
+		if weapon.BulletsPerShot == 0 || weapon.MagazineSize == 0 {
+			problems = append(problems, contentError(weaponsFile, context, "BulletsPerShot and MagazineSize must be positive"))
+		}
+		if weapon.MaxRange == 0 || weapon.EffectiveRange > weapon.MaxRange {
+			problems = append(problems, contentError(weaponsFile, context, "MaxRange must be positive and not shorter than EffectiveRange"))
+		}
+		if weapon.BaseDamagePerBullet < 0 {
+			problems = append(problems, contentError(weaponsFile, context, "BaseDamagePerBullet must not be negative"))
+		}
+		if !isKnownEffect(weapon.InsteadOfDamage) {
+			problems = append(problems, contentError(weaponsFile, context, "unknown InsteadOfDamage effect '%s'", weapon.InsteadOfDamage))
+		} else if weapon.InsteadOfDamage != TargetedEffectNone && weapon.Radius <= 0 {
+			problems = append(problems, contentError(weaponsFile, context, "Radius must be positive for the '%s' effect", weapon.InsteadOfDamage))
+		}
+	}
+	return problems
+}
+
+func validateItems(items []ItemDefinition) []error {
+	var problems []error
+	names := make(map[string]bool)
+	for i, item := range items {
+		context := fmt.Sprintf("item #%d '%s'", i+1, item.UniqueName)
+		if item.UniqueName == "" {
+			problems = append(problems, contentError(itemsFile, context, "UniqueName is missing"))
+		} else if names[item.UniqueName] {
+			problems = append(problems, contentError(itemsFile, context, "UniqueName is used twice"))
+		}
+		names[item.UniqueName] = true
+
+		if item.ItemType != ItemTypeGrenade {
+			problems = append(problems, contentError(itemsFile, context, "unknown ItemType '%s'", item.ItemType))
+		}
+		if item.Model == "" {
+			problems = append(problems, contentError(itemsFile, context, "Model is missing"))
+		}
+		if item.Effect == TargetedEffectNone || !isKnownEffect(item.Effect) {
+			problems = append(problems, contentError(itemsFile, context, "unknown Effect '%s'", item.Effect))
+		}
+		if item.Radius <= 0 || item.TurnsToLive <= 0 {
+			problems = append(problems, contentError(itemsFile, context, "Radius and TurnsToLive must be positive"))
+		}
+	}
+	return problems
+}
+
+// validateRulePresets also names the presets after their keys.
+func validateRulePresets(presets map[string]Ruleset) []error {
+	var problems []error
+	if _, exists := presets[DefaultRulesetName]; !exists {
+		problems = append(problems, fmt.Errorf("%s: the preset '%s' is missing", rulesFile, DefaultRulesetName))
+	}
+	for name, rules := range presets {
+		context := fmt.Sprintf("preset '%s'", name)
+		if rules.Name != "" && rules.Name != name {
+			problems = append(problems, contentError(rulesFile, context, "Name is taken from the key and can be left out"))
+		}
+		rules.Name = name
+		presets[name] = rules
+		if rules.MaxPressureDistance <= 0 || rules.MaxOverwatchRange == 0 {
+			problems = append(problems, contentError(rulesFile, context, "MaxPressureDistance and MaxOverwatchRange must be positive"))
+		}
+		if rules.OverwatchAccuracyModifier <= 0 || rules.OverwatchDamageModifier <= 0 {
+			problems = append(problems, contentError(rulesFile, context, "OverwatchAccuracyModifier and OverwatchDamageModifier must be positive"))
+		}
+		if rules.FallDamagePerBlock < 0 || rules.DebrisDamage < 0 {
+			problems = append(problems, contentError(rulesFile, context, "FallDamagePerBlock and DebrisDamage must not be negative"))
+		}
+		for kind, cost := range rules.HazardCosts {
+			if !isKnownHazard(kind) {
+				problems = append(problems, contentError(rulesFile, context, "unknown hazard '%s' in HazardCosts", kind))
+			}
+			if cost < 0 {
+				problems = append(problems, contentError(rulesFile, context, "the cost of '%s' must not be negative", kind))
+			}
+		}
+		for blockName, cost := range rules.TerrainCosts {
+			if cost < 0 {
+				problems = append(problems, contentError(rulesFile, context, "the cost of '%s' must not be negative", blockName))
+			}
+		}
+	}
+	return problems
+}
+
+func validateAIProfiles(difficulties map[string]AIDifficulty, personalities map[string]AIPersonality) []error {
+	var problems []error
+	if _, exists := difficulties[DefaultAIDifficulty]; !exists {
+		problems = append(problems, fmt.Errorf("%s: the difficulty '%s' is missing", aiFile, DefaultAIDifficulty))
+	}
+	if _, exists := personalities[DefaultAIPersonality]; !exists {
+		problems = append(problems, fmt.Errorf("%s: the personality '%s' is missing", aiFile, DefaultAIPersonality))
+	}
+	for name, difficulty := range difficulties {
+		context := fmt.Sprintf("difficulty '%s'", name)
+		if difficulty.MinHitChance < 0 || difficulty.MinHitChance > 1 {
+			problems = append(problems, contentError(aiFile, context, "MinHitChance must be between 0 and 1"))
+		}
+		if difficulty.MaxAimErrorDegrees < 0 {
+			problems = append(problems, contentError(aiFile, context, "MaxAimErrorDegrees must not be negative"))
+		}
+	}
+	for name, personality := range personalities {
+		context := fmt.Sprintf("personality '%s'", name)
+		if personality.PreferredRange <= 0 {
+			problems = append(problems, contentError(aiFile, context, "PreferredRange must be positive"))
+		}
+		if personality.Cover < 0 || personality.Pressure < 0 || personality.Distance < 0 || personality.Objective < 0 ||
+			personality.ShotReserve < 0 || personality.Overwatched < 0 || personality.Movement < 0 {
+			problems = append(problems, contentError(aiFile, context, "the weights must not be negative"))
+		}
+	}
+	return problems
+}
+
+func validateBlockMaterials(materials map[string]BlockMaterial) []error {
+	var problems []error
+	if _, exists := materials[DefaultMaterialName]; !exists {
+		problems = append(problems, fmt.Errorf("%s: the material '%s' is missing", materialsFile, DefaultMaterialName))
+	}
+	for name, material := range materials {
+		context := fmt.Sprintf("material '%s'", name)
+		if material.HitPoints < 0 || material.HitPoints > voxel.MaxBlockDamage {
+			problems = append(problems, contentError(materialsFile, context, "HitPoints must be between 0 and %d", voxel.MaxBlockDamage))
+		}
+		if material.Armor < 0 || material.PenetrationLoss < 0 || material.Flammability < 0 || material.ExplosionResistance < 0 {
+			problems = append(problems, contentError(materialsFile, context, "Armor, PenetrationLoss, Flammability and ExplosionResistance must not be negative"))
+		}
+		if material.PenetrationLoss > 0 && !material.Penetrable {
+			problems = append(problems, contentError(materialsFile, context, "PenetrationLoss is set, but the block is not Penetrable"))
+		}
+	}
+	return problems
+}
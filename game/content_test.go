@@ -0,0 +1,95 @@
+package game
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestLoadContentDefinitions(t *testing.T) {
+	content, err := LoadContentDefinitions("../assets/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(content.Factions) != 2 || len(content.Weapons) != 5 || len(content.Items) != 3 {
+		t.Fatalf("unexpected content: %d factions, %d weapons, %d items", len(content.Factions), len(content.Weapons), len(content.Items))
+	}
+	if content.BlockMaterials[DefaultMaterialName].HitPoints == 0 || !content.BlockMaterials["birch_planks"].Penetrable {
+		t.Errorf("unexpected materials: %+v", content.BlockMaterials)
+	}
+	if content.RulePresets[DefaultRulesetName].Name != DefaultRulesetName || !content.RulePresets["tactical"].IsThrowTurnEnding {
+		t.Errorf("unexpected rule presets: %+v", content.RulePresets)
+	}
+	if !content.AIDifficulties["hard"].SeesThroughFog || content.AIPersonalities["defensive"].Cover <= content.AIPersonalities["aggressive"].Cover {
+		t.Errorf("unexpected AI profiles: %+v %+v", content.AIDifficulties, content.AIPersonalities)
+	}
+	soldier := content.Factions[0].Units[0]
+	if soldier.AnimationMap["fire"] != AnimationWeaponFire.Str() {
+		t.Errorf("animation preset was not applied: %v", soldier.AnimationMap)
+	}
+}
+
+// copyContent copies the shipped data files, so a test can break one of them.
+func copyContent(t *testing.T) string {
+	directory := t.TempDir()
+	for _, filename := range []string{animationsFile, factionsFile, weaponsFile, itemsFile, rulesFile, aiFile, materialsFile} {
+		data, err := os.ReadFile(path.Join("../assets/data", filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(path.Join(directory, filename), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return directory
+}
+
+func replaceInContentFile(t *testing.T, directory, filename, old, new string) {
+	filePath := path.Join(directory, filename)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), old) {
+		t.Fatalf("%s does not contain %q", filename, old)
+	}
+	if err = os.WriteFile(filePath, []byte(strings.Replace(string(data), old, new, 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadContentDefinitionsRejectsBadData(t *testing.T) {
+	tests := []struct {
+		filename string
+		old      string
+		new      string
+		expected string
+	}{
+		{weaponsFile, `"MagazineSize"`, `"MagazinSize"`, `unknown field "MagazinSize"`},
+		{factionsFile, `"AnimationPreset": "soldier"`, `"AnimationPreset": "alien"`, "unknown animation preset 'alien'"},
+		{weaponsFile, `"WeaponType": "Shotgun"`, `"WeaponType": "Flamer"`, "weapon #3 'Mossberg 500': unknown WeaponType 'Flamer'"},
+		{itemsFile, `"Effect": "SmokeCloud"`, `"Effect": "Smoke"`, "unknown Effect 'Smoke'"},
+		{factionsFile, `"Name": "Deep Monster"`, `"Name": "Deep One"`, "unit #2 'Deep One': name is used twice in the faction"},
+		{factionsFile, `"Width": 3`, `"Width": 9`, "Footprint sizes must be between 1 and 5, got 9x3x3"},
+		{rulesFile, `"default"`, `"normal"`, "the preset 'default' is missing"},
+		{rulesFile, `"poison": 2`, `"acid": 2`, "preset 'default': unknown hazard 'acid' in HazardCosts"},
+		{rulesFile, `"sand": 0.5`, `"sand": -1`, "preset 'tactical': the cost of 'sand' must not be negative"},
+		{aiFile, `"MinHitChance": 0.1`, `"MinHitChance": 10`, "difficulty 'easy': MinHitChance must be between 0 and 1"},
+		{aiFile, `"balanced"`, `"calm"`, "the personality 'balanced' is missing"},
+		{materialsFile, `"default"`, `"stone"`, "the material 'default' is missing"},
+		{materialsFile, `"HitPoints": 5`, `"HitPoints": 20`, "material 'bricks': HitPoints must be between 0 and 15"},
+		{materialsFile, `"Penetrable": true,
+    "PenetrationLoss": 1,
+    "Flammability": 3`, `"PenetrationLoss": 1,
+    "Flammability": 3`, "PenetrationLoss is set, but the block is not Penetrable"},
+	}
+	for _, test := range tests {
+		directory := copyContent(t)
+		replaceInContentFile(t, directory, test.filename, test.old, test.new)
+		_, err := LoadContentDefinitions(directory)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%s with %s: expected an error containing %q, got %v", test.filename, test.new, test.expected, err)
+		}
+	}
+}
@@ -126,7 +126,9 @@ func (s CompleteUnitState) Equals(other CompleteUnitState) (bool, string) {
 }
 
 type CompleteGameState struct {
-	AllUnits map[uint64]CompleteUnitState
+	AllUnits    map[uint64]CompleteUnitState
+	Seed        int64
+	RandomDraws uint64
 }
 
 func (g *GameInstance) DebugGetCompleteState() CompleteGameState {
@@ -146,5 +148,26 @@ func (g *GameInstance) DebugGetCompleteState() CompleteGameState {
 		allUnits[unit.UnitID()] = us
 	}
 	gs.AllUnits = allUnits
+	gs.Seed = g.GetRandom().Seed()
+	gs.RandomDraws = g.GetRandom().Draws()
 	return gs
 }
+
+func (s CompleteGameState) Equals(other CompleteGameState) (bool, string) {
+	if s.Seed != other.Seed || s.RandomDraws != other.RandomDraws {
+		return false, fmt.Sprintf("Random: %d draws from seed %d != %d draws from seed %d", s.RandomDraws, s.Seed, other.RandomDraws, other.Seed)
+	}
+	if len(s.AllUnits) != len(other.AllUnits) {
+		return false, fmt.Sprintf("Units: %d != %d", len(s.AllUnits), len(other.AllUnits))
+	}
+	for unitID, unitState := range s.AllUnits {
+		otherUnitState, exists := other.AllUnits[unitID]
+		if !exists {
+			return false, fmt.Sprintf("Unit %d is missing", unitID)
+		}
+		if equal, reason := unitState.Equals(otherUnitState); !equal {
+			return false, fmt.Sprintf("Unit %d: %s", unitID, reason)
+		}
+	}
+	return true, ""
+}
@@ -0,0 +1,33 @@
+package game
+
+import (
+	"github.com/memmaker/battleground/engine/voxel"
+	"testing"
+)
+
+func TestDeploymentStaysInTheSpawnAreaOnSolidGround(t *testing.T) {
+	voxelMap := voxel.NewMapWithEmptyChunks(1, 1, 1, 16, 16)
+	voxelMap.SetFloorAtHeight(0, voxel.NewBlock(1))
+	voxelMap.SetAir(voxel.Int3{X: 6, Y: 0, Z: 2})
+	g := &GameInstance{
+		voxelMap: voxelMap,
+		units:    make(map[uint64]*UnitInstance),
+		players:  []uint64{1, 2},
+		mapMeta: &MapMetadata{SpawnPositions: [][]voxel.Int3{
+			{{X: 2, Y: 1, Z: 2}, {X: 4, Y: 1, Z: 2}, {X: 6, Y: 1, Z: 2}, {X: 4, Y: 2, Z: 4}},
+			{{X: 12, Y: 1, Z: 12}},
+		}},
+	}
+	unit := newPathingUnit(voxelMap, 0, voxel.Int3{X: 2, Y: 1, Z: 2})
+	unit.SetControlledBy(1)
+	g.units[0] = unit
+
+	for _, pos := range []voxel.Int3{{X: 12, Y: 1, Z: 12}, {X: 8, Y: 1, Z: 8}, {X: 6, Y: 1, Z: 2}, {X: 4, Y: 2, Z: 4}} {
+		if g.TryDeploy(1, map[uint64]voxel.Int3{0: pos}) {
+			t.Errorf("the unit was deployed at %s", pos.ToString())
+		}
+	}
+	if !g.TryDeploy(1, map[uint64]voxel.Int3{0: {X: 4, Y: 1, Z: 2}}) || unit.GetBlockPosition() != (voxel.Int3{X: 4, Y: 1, Z: 2}) {
+		t.Errorf("the unit could not be deployed in the spawn area, it is at %s", unit.GetBlockPosition().ToString())
+	}
+}
@@ -1,5 +1,7 @@
 package game
 
+import "github.com/memmaker/battleground/engine/voxel"
+
 type EffectDefinition struct {
 	Effect      TargetedEffect
 	TurnsToLive int
@@ -19,6 +21,13 @@ type BlockStatusEffectInstance struct {
 	Effect BlockEffect
 	Turns  int
 }
+
+// BlockEffectState is a BlockStatusEffectInstance together with its location, so it can be sent over the wire.
+type BlockEffectState struct {
+	Position voxel.Int3
+	Effect   BlockEffect
+	Turns    int
+}
 type BlockStatusEffect int
 
 const (
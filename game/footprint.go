@@ -0,0 +1,89 @@
+package game
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/memmaker/battleground/engine/voxel"
+)
+
+// MaxFootprintSize is the largest width, length or height of a unit in blocks.
+const MaxFootprintSize = 5
+
+// Footprint is the size of a unit that is bigger than a humanoid, in blocks. The length runs along the forward
+// direction of the unit, the width across it. The block position of the unit is the center of the lowest layer.
+// Units without a footprint use the blocks of their humanoid stance.
+type Footprint struct {
+	Width  int32
+	Length int32
+	Height int32
+}
+
+func (f Footprint) IsSet() bool {
+	return f.Width > 0 && f.Length > 0 && f.Height > 0
+}
+
+// Offsets returns the occupied blocks relative to the block position, for a unit facing forward.
+// It expects the forward vector to be one of (0,0,1), (0,0,-1), (1,0,0), (-1,0,0).
+func (f Footprint) Offsets(forward voxel.Int3) []voxel.Int3 {
+	right := voxel.Int3{X: forward.Z, Z: -forward.X}
+	offsets := make([]voxel.Int3, 0, f.Width*f.Length*f.Height)
+	for across := -(f.Width - 1) / 2; across <= f.Width/2; across++ {
+		for along := -(f.Length - 1) / 2; along <= f.Length/2; along++ {
+			for y := int32(0); y < f.Height; y++ {
+				offsets = append(offsets, right.Mul(across).Add(forward.Mul(along)).Add(voxel.Int3{Y: y}))
+			}
+		}
+	}
+	return offsets
+}
+
+// Orientations returns the directions a unit can face to fit in, starting with the preferred one.
+// A square footprint fits the same way in every direction.
+func (f Footprint) Orientations(preferred voxel.Int3) []voxel.Int3 {
+	if f.Width == f.Length {
+		return []voxel.Int3{preferred}
+	}
+	right := voxel.Int3{X: preferred.Z, Z: -preferred.X}
+	return []voxel.Int3{preferred, right, preferred.Mul(-1), right.Mul(-1)}
+}
+
+// CornerOffsets are the centers of the corner columns of the footprint at half its height, relative to the
+// position of the unit.
+func (f Footprint) CornerOffsets(forward voxel.Int3) []mgl32.Vec3 {
+	right := voxel.Int3{X: forward.Z, Z: -forward.X}
+	var corners []mgl32.Vec3
+	for _, across := range []int32{-(f.Width - 1) / 2, f.Width / 2} {
+		for _, along := range []int32{-(f.Length - 1) / 2, f.Length / 2} {
+			corner := right.Mul(across).Add(forward.Mul(along)).ToVec3()
+			corners = append(corners, corner.Add(mgl32.Vec3{0, float32(f.Height) / 2, 0}))
+		}
+	}
+	return corners
+}
+
+// Reach is how far the footprint extends horizontally from the block position.
+func (f Footprint) Reach() int32 {
+	return max(f.Width, f.Length) / 2
+}
+
+// EyeOffset looks out of the top layer of the footprint.
+func (f Footprint) EyeOffset() mgl32.Vec3 {
+	return mgl32.Vec3{0, float32(f.Height) - 0.25, 0}
+}
+
+// HasFootprint is true for the units that occupy a block volume instead of the blocks of a humanoid stance.
+func (u *UnitInstance) HasFootprint() bool {
+	return u.Definition != nil && u.Definition.Footprint.IsSet()
+}
+
+// footprintForwardAt picks the first orientation in which the footprint fits at the position, the unit keeps
+// facing its current direction if there is none.
+func (u *UnitInstance) footprintForwardAt(position voxel.Int3) voxel.Int3 {
+	footprint := u.Definition.Footprint
+	current := u.GetForward2DCardinal()
+	for _, forward := range footprint.Orientations(current) {
+		if fits, _ := u.voxelMap.IsFreeForOffsets(u, position, footprint.Offsets(forward)); fits {
+			return forward
+		}
+	}
+	return current
+}
@@ -27,16 +27,23 @@ type GameClient[U ClientUnit] struct {
 	clientUnitMap     map[uint64]U
 	newClientUnit     func(*UnitInstance) U
 	deploymentQueue   []U
+	spectating        bool
 }
 
-func NewGameClient[U ClientUnit](infos GameStartedMessage, newClientUnit func(*UnitInstance) U) *GameClient[U] {
-	return &GameClient[U]{
-		GameInstance: NewGameInstanceWithDetails(infos.GameID, infos.MapFile, infos.MissionDetails),
+func NewGameClient[U ClientUnit](infos GameStartedMessage, assetLoader *Assets, newClientUnit func(*UnitInstance) U) *GameClient[U] {
+	client := &GameClient[U]{
+		GameInstance: NewGameInstanceWithDetails(infos.GameID, assetLoader, infos.MapFile, infos.MissionDetails),
 		newClientUnit:     newClientUnit,
 		controllingUserID: infos.OwnID,
 		spawnIndex:        infos.SpawnIndex,
 		clientUnitMap:     make(map[uint64]U),
 	}
+	if infos.Rules != nil {
+		client.SetRules(*infos.Rules) // the previews have to use the numbers of the server
+	}
+	client.SetBlockMaterials(infos.BlockMaterials)
+	client.isClient = true
+	return client
 }
 func (a *GameClient[U]) GetDeploymentQueue() []U {
 	return a.deploymentQueue
@@ -241,6 +248,92 @@ func (a *GameClient[U]) ResetUnitsForNextTurn() {
 	}
 }
 
+// OnGameResumed brings the local state back in line with the server after a reconnect.
+// Units keep the AP they had on the server, so the turn is not reset.
+func (a *GameClient[U]) OnGameResumed(msg GameResumedMessage) {
+	println(fmt.Sprintf("[%s] Resumed game %s, current player is %d", a.environment, msg.GameID, msg.CurrentPlayer))
+	if !msg.AwaitingDeployment {
+		for _, unit := range msg.OwnUnits {
+			a.AddOrUpdateUnit(unit)
+		}
+	}
+	for _, unit := range msg.VisibleUnits {
+		a.AddOrUpdateUnit(unit)
+	}
+	a.applyMapChanges(msg.DestroyedBlocks, msg.BlockEffects, msg.BlockStates)
+	a.SetLOSAndPressure(msg.LOSMatrix, msg.PressureMatrix)
+}
+
+// applyMapChanges brings a freshly loaded map up to date, blocks that are already gone are skipped.
+func (a *GameClient[U]) applyMapChanges(destroyedBlocks []voxel.Int3, blockEffects []BlockEffectState, blockStates []BlockStateChange) {
+	for _, pos := range destroyedBlocks {
+		if a.GetVoxelMap().IsSolidBlockAt(pos.X, pos.Y, pos.Z) {
+			a.DestroyBlock(pos)
+		}
+	}
+	a.ApplyBlockStates(blockStates)
+	a.TakeBlockStateChanges() // only the server sends them
+	a.SetActiveBlockEffects(blockEffects)
+}
+
+// OnBlockStatesChanged applies the block damage of the server, the clients never damage blocks themselves.
+func (a *GameClient[U]) OnBlockStatesChanged(msg BlockStatesChangedMessage) {
+	for _, pos := range msg.Destroyed {
+		if a.GetVoxelMap().IsSolidBlockAt(pos.X, pos.Y, pos.Z) {
+			a.DestroyBlock(pos)
+		}
+	}
+	a.ApplyBlockStates(msg.Changes)
+	a.TakeBlockStateChanges()
+}
+
+func (a *GameClient[U]) OnBlocksCollapsed(msg BlocksCollapsedMessage) {
+	a.ApplyCollapse(msg.Blocks, msg.Units)
+	if msg.LOSMatrix == nil {
+		return
+	}
+	a.SetLOSAndPressure(msg.LOSMatrix, msg.PressureMatrix)
+	for _, spottedUnit := range msg.Spotted {
+		a.AddOrUpdateUnit(spottedUnit)
+	}
+}
+
+// SetSpectating turns the client into an observer that controls no units and sees every unit.
+func (a *GameClient[U]) SetSpectating() {
+	a.spectating = true
+}
+
+func (a *GameClient[U]) IsSpectating() bool {
+	return a.spectating
+}
+
+// OnSpectatorState replaces the local state with the complete state sent to spectators.
+func (a *GameClient[U]) OnSpectatorState(msg SpectatorStateMessage) {
+	for _, unit := range msg.Units {
+		a.AddOrUpdateUnit(unit)
+	}
+	a.applyMapChanges(msg.DestroyedBlocks, msg.BlockEffects, msg.BlockStates)
+	a.SetLOSAndPressure(msg.LOSMatrix, msg.PressureMatrix)
+}
+
+func (a *GameClient[U]) OnTurnTimeWarning(msg TurnTimeWarningMessage) {
+	if msg.YourTurn {
+		a.Print(fmt.Sprintf("%0.0f seconds left in this turn", msg.SecondsLeft))
+	}
+}
+
+func (a *GameClient[U]) OnChatLine(msg ChatLineMessage) {
+	a.Print(fmt.Sprintf("[%s] %s: %s", msg.Channel, msg.SenderName, msg.Text))
+}
+
+func (a *GameClient[U]) OnPlayerConnection(msg PlayerConnectionMessage) {
+	if msg.Connected {
+		a.Print(fmt.Sprintf("%s reconnected", msg.Name))
+	} else {
+		a.Print(fmt.Sprintf("%s lost the connection, waiting %d seconds", msg.Name, msg.GracePeriodSeconds))
+	}
+}
+
 func (a *GameClient[U]) OnBeginOverwatch(msg VisualBeginOverwatch) {
 	unit, exists := a.GetClientUnit(msg.Watcher)
 	if !exists {
@@ -249,6 +342,10 @@ func (a *GameClient[U]) OnBeginOverwatch(msg VisualBeginOverwatch) {
 	}
 	unit.ConsumeAP(msg.APCost)
 	unit.EndTurn()
+	// the watched positions are known to all players, our paths avoid them like on the server
+	if watcher, known := a.GetUnit(msg.Watcher); known {
+		a.RegisterOverwatch(watcher, msg.WatchedLocations)
+	}
 }
 
 func (a *GameClient[U]) OnEnemyUnitMoved(msg VisualEnemyUnitMoved) {
@@ -340,9 +437,9 @@ func (a *GameClient[U]) OnRangedAttack(msg VisualRangedAttack) {
 			println(fmt.Sprintf("[%s] Projectile hit unit %s(%d)", a.environment, victim.GetName(), victim.UnitID()))
 		}
 
-		for _, damagedBlock := range projectile.BlocksHit {
-			blockDef := a.GetBlockDefAt(damagedBlock)
-			blockDef.OnDamageReceived(damagedBlock, projectile.Damage)
+		for _, blockHit := range projectile.BlocksHit {
+			blockDef := a.GetBlockDefAt(blockHit.Position)
+			blockDef.OnDamageReceived(blockHit.Position, blockHit.Damage)
 		}
 
 		if projectile.InsteadOfDamage.Effect != TargetedEffectNone {
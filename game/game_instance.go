@@ -1,12 +1,14 @@
 package game
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/go-gl/mathgl/mgl32"
 	"github.com/go-gl/mathgl/mgl64"
 	"github.com/memmaker/battleground/engine/util"
 	"github.com/memmaker/battleground/engine/voxel"
 	"math"
+	"time"
 )
 
 type DefaultMapInfo struct {
@@ -45,13 +47,11 @@ type MapInfo interface {
 	GetBlockLibrary() *BlockLibrary
 }
 
-func NewGameInstanceWithDetails(gameID string, mapFile string, details *MissionDetails) *GameInstance {
-	assetLoader := NewAssets()
+func NewGameInstanceWithDetails(gameID string, assetLoader *Assets, mapFile string, details *MissionDetails) *GameInstance {
 	return NewGameInstanceWithMap(gameID, assetLoader, assetLoader.LoadMapWithDetails(mapFile, details))
 }
 
-func NewGameInstanceWithBiome(gameID string, biome Biome, details *MissionDetails) *GameInstance {
-	assetLoader := NewAssets()
+func NewGameInstanceWithBiome(gameID string, assetLoader *Assets, biome Biome, details *MissionDetails) *GameInstance {
 	return NewGameInstanceWithMap(gameID, assetLoader, assetLoader.LoadBiomeWithDetails(biome, details))
 }
 func NewGameInstanceWithMap(gameID string, assetLoader *Assets, mapInfo MapInfo) *GameInstance {
@@ -80,8 +80,14 @@ func NewGameInstanceWithMap(gameID string, assetLoader *Assets, mapInfo MapInfo)
 	return g
 }
 
+// DefaultRulesetName is the preset used when a game does not ask for another one.
+const DefaultRulesetName = "default"
+
+// Ruleset holds the numbers and switches of the game rules. The server sends its rules to the players,
+// because the clients run the same rules for their previews.
 type Ruleset struct {
 	engine                    *GameInstance
+	Name                      string
 	MaxPressureDistance       int32
 	MaxOverwatchRange         uint
 	OverwatchAccuracyModifier float64
@@ -89,17 +95,32 @@ type Ruleset struct {
 	IsRangedAttackTurnEnding  bool
 	IsGroundLayerDestructible bool
 	IsThrowTurnEnding         bool
+	// FallDamagePerBlock is dealt for every block a unit falls when the floor under it collapses,
+	// DebrisDamage to the units hit by a collapsing structure.
+	FallDamagePerBlock int
+	DebrisDamage       int
+	// HazardCosts and TerrainCosts are the extra movement a step costs, so units walk around hazards if they can.
+	HazardCosts  map[HazardKind]float64
+	TerrainCosts map[string]float64 // block name -> extra cost of walking on it
 }
 
 func NewDefaultRuleset(engine *GameInstance) *Ruleset {
 	return &Ruleset{
 		engine:                    engine,
+		Name:                      DefaultRulesetName,
 		MaxPressureDistance:       4,
 		MaxOverwatchRange:         20,
 		OverwatchAccuracyModifier: 0.8, // 20% penalty for overwatch shots
 		OverwatchDamageModifier:   1.1, // 10% bonus damage for overwatch shots
 		IsRangedAttackTurnEnding:  true,
 		IsGroundLayerDestructible: false,
+		FallDamagePerBlock:        1,
+		DebrisDamage:              3,
+		HazardCosts: map[HazardKind]float64{
+			HazardFire:      2,
+			HazardPoison:    2,
+			HazardOverwatch: 1,
+		},
 	}
 }
 
@@ -134,8 +155,10 @@ type GameInstance struct {
 	public  bool
 
 	rules          *Ruleset
+	aiProfiles     map[uint64]AIProfile // player id -> profile, for the seats played by the AI
 	assets         *Assets
 	missionDetails *MissionDetails
+	random         *util.Random // every roll of the server goes through here, so a game can be played again
 
 	// game instance state
 	currentPlayerIndex int
@@ -156,6 +179,8 @@ type GameInstance struct {
 	overwatch            map[voxel.Int3][]*UnitInstance
 	pressureMatrix       map[uint64]map[uint64]float64
 	waitForDeployment    bool
+	deploymentRunning    bool
+	started              bool
 	onTargetedEffect     func(voxel.Int3, TargetedEffect, float64, int)
 	onNotification       func(string)
 	onBlockEffectAdded   func(voxel.Int3, BlockEffect)
@@ -164,7 +189,33 @@ type GameInstance struct {
 
 	turnCounter        int
 	activeBlockEffects map[voxel.Int3]BlockStatusEffectInstance
+	destroyedBlocks    []voxel.Int3
+	blockStates        map[voxel.Int3]voxel.BlockState // blockStates are the states that changed since the map was loaded
+	pendingBlockStates map[voxel.Int3]voxel.BlockState // pendingBlockStates are not yet sent to the players
+	blockMaterials     map[string]BlockMaterial
+	structureChecked   int  // structureChecked is the number of destroyed blocks the structural check has seen
+	destroyedSent      int  // destroyedSent is the number of destroyed blocks the players were told about
+	isClient           bool // isClient leaves the damage of blocks to the server, it sends the block states
+	hazardGeneration   uint64
+
+}
 
+// SetSeed restarts the random numbers of the game from the seed.
+func (g *GameInstance) SetSeed(seed int64) {
+	g.random = util.NewRandom(seed)
+}
+
+func (g *GameInstance) GetSeed() int64 {
+	return g.GetRandom().Seed()
+}
+
+// GetRandom seeds the game from the clock, unless a seed was set before the first roll. Saved games and replays
+// record the seed either way, but two runs of the same game only roll the same numbers with SetSeed.
+func (g *GameInstance) GetRandom() *util.Random {
+	if g.random == nil {
+		g.random = util.NewRandom(time.Now().UnixNano())
+	}
+	return g.random
 }
 
 func (g *GameInstance) SetEnvironment(environment string) {
@@ -213,6 +264,10 @@ func (g *GameInstance) currentPlayerFaction() *Faction {
 	return g.playerFactions[g.currentPlayerID()]
 }
 
+func (g *GameInstance) GetCurrentPlayerID() uint64 {
+	return g.currentPlayerID()
+}
+
 func (g *GameInstance) currentPlayerID() uint64 {
 	return g.players[g.currentPlayerIndex]
 }
@@ -222,6 +277,48 @@ func (g *GameInstance) AddPlayer(id uint64) {
 	g.players = append(g.players, id)
 }
 
+func (g *GameInstance) SetOwner(userID uint64) {
+	g.owner = userID
+}
+
+func (g *GameInstance) GetOwner() uint64 {
+	return g.owner
+}
+
+// SetAIProfile marks the seat of the player as played by the AI.
+func (g *GameInstance) SetAIProfile(playerID uint64, profile AIProfile) {
+	if g.aiProfiles == nil {
+		g.aiProfiles = make(map[uint64]AIProfile)
+	}
+	g.aiProfiles[playerID] = profile
+}
+
+// GetAIProfile returns nil for the seats of human players.
+func (g *GameInstance) GetAIProfile(playerID uint64) *AIProfile {
+	profile, isAI := g.aiProfiles[playerID]
+	if !isAI {
+		return nil
+	}
+	return &profile
+}
+
+func (g *GameInstance) SetPublic(public bool) {
+	g.public = public
+}
+
+func (g *GameInstance) IsPublic() bool {
+	return g.public
+}
+
+func (g *GameInstance) GetPlayersNeeded() int {
+	return g.playersNeeded
+}
+
+// IsFull is true once every seat is taken. Spectators never take a seat.
+func (g *GameInstance) IsFull() bool {
+	return len(g.players) >= g.playersNeeded
+}
+
 func (g *GameInstance) IsReady() bool {
 	return len(g.players) == g.playersNeeded && len(g.playerFactions) == g.playersNeeded && len(g.playerUnits) == g.playersNeeded
 }
@@ -237,6 +334,7 @@ func (g *GameInstance) AllUnitsDeployed() bool {
 	return true
 }
 func (g *GameInstance) Start() uint64 {
+	g.started = true
 	firstPlayer := g.players[0]
 	return firstPlayer
 }
@@ -259,16 +357,16 @@ func (g *GameInstance) ServerSpawnUnit(userID uint64, unit *UnitInstance) uint64
 	teamIndex := g.IndexOfPlayer(userID) // 0..n
 	spawnsForTeam := g.mapMeta.SpawnPositions[teamIndex]
 
-	randomChoice := util.RandomChoice(spawnsForTeam)
+	randomChoice := util.RandomChoice(g.GetRandom(), spawnsForTeam)
 	for canBePlaced, _ := g.voxelMap.IsUnitPlaceable(unit, randomChoice); !canBePlaced; {
-		randomChoice = util.RandomChoice(spawnsForTeam)
+		randomChoice = util.RandomChoice(g.GetRandom(), spawnsForTeam)
 		canBePlaced, _ = g.voxelMap.IsUnitPlaceable(unit, randomChoice)
 	}
 	unit.SetBlockPositionAndUpdateStance(randomChoice)
 	unit.UpdateMapPosition()
 	unit.StartStanceAnimation()
 
-	g.logGameInfo(fmt.Sprintf("[ServerSpawnUnit] Adding unit %d -> %s of type %d for player %d", unitInstanceID, unit.Name, unit.Definition.ID, userID))
+	g.logGameInfo(fmt.Sprintf("[ServerSpawnUnit] Adding unit %d -> %s of type '%s' for player %d", unitInstanceID, unit.Name, unit.Definition.Name, userID))
 
 	return unitInstanceID
 }
@@ -277,7 +375,7 @@ func (g *GameInstance) ClientAddUnit(userID uint64, unit *UnitInstance) uint64 {
 		g.playerUnits[userID] = make([]uint64, 0)
 	}
 	unitInstanceID := unit.UnitID()
-	g.logGameInfo(fmt.Sprintf("[ClientAddUnit] Adding unit %d -> %s of type %d for player %d", unitInstanceID, unit.Name, unit.Definition.ID, userID))
+	g.logGameInfo(fmt.Sprintf("[ClientAddUnit] Adding unit %d -> %s of type '%s' for player %d", unitInstanceID, unit.Name, unit.Definition.Name, userID))
 	g.playerUnits[userID] = append(g.playerUnits[userID], unitInstanceID)
 	g.units[unitInstanceID] = unit
 
@@ -420,8 +518,14 @@ func (g *GameInstance) SetVoxelMap(loadedMap *voxel.Map) {
 
 func (g *GameInstance) SaveMapToDisk() {
 	mapFileName := g.assets.GetMapPath(g.mapFile)
-	errMap := g.voxelMap.SaveToDisk(mapFileName)
-	metaErr := g.mapMeta.SaveToDisk(mapFileName)
+	if g.voxelMap.GetBlockNames() == nil && g.blockLibrary != nil {
+		g.voxelMap.SetBlockNames(g.blockLibrary.BlockNames())
+	}
+	metadata, metaErr := json.Marshal(g.mapMeta)
+	var errMap error
+	if metaErr == nil {
+		errMap = g.voxelMap.SaveToDisk(mapFileName, metadata)
+	}
 	if errMap != nil || metaErr != nil {
 		g.logGameError(fmt.Sprintf("[GameInstance] ERR - SaveMapToDisk - %v %v", errMap, metaErr))
 		g.onNotification("ERROR saving map")
@@ -486,6 +590,7 @@ func (g *GameInstance) AddFireAt(location voxel.Int3, turns int) {
     if !g.voxelMap.Contains(location.X, location.Y, location.Z) {
         return
     }
+    g.burnBlocksAround(location)
     if g.voxelMap.IsSolidBlockAt(location.X, location.Y, location.Z) {
         return
     }
@@ -509,7 +614,7 @@ func (g *GameInstance) applyExplosionToSingleBlock(origin voxel.Int3, radius flo
 		affectedUnit := explodingBlock.GetOccupant().(*UnitInstance)
 		g.ApplyDamage(nil, affectedUnit, 5, util.ZoneTorso) // TODO: can we do better with the damage zone? and value..
 	}
-	g.DestroyBlock(voxel.Int3{X: x, Y: y, Z: z})
+	g.applyExplosionToBlock(voxel.Int3{X: x, Y: y, Z: z})
 }
 
 func (g *GameInstance) DestroyBlock(pos voxel.Int3) {
@@ -517,9 +622,31 @@ func (g *GameInstance) DestroyBlock(pos voxel.Int3) {
 		return
 	}
 	g.voxelMap.SetAir(pos)
+	g.forgetBlockState(pos)
+	g.destroyedBlocks = append(g.destroyedBlocks, pos)
+}
+
+// GetDestroyedBlocks lists every block that was destroyed since the map was loaded.
+func (g *GameInstance) GetDestroyedBlocks() []voxel.Int3 {
+	return g.destroyedBlocks
 }
+
+// TakeDestroyedBlocks returns the blocks destroyed since the last call, the server sends them to the players
+// after every action.
+func (g *GameInstance) TakeDestroyedBlocks() []voxel.Int3 {
+	destroyed := g.destroyedBlocks[g.destroyedSent:]
+	g.destroyedSent = len(g.destroyedBlocks)
+	return destroyed
+}
+// SetBlockLibrary also changes the block ids of the map to the ones of the library.
 func (g *GameInstance) SetBlockLibrary(bl *BlockLibrary) {
 	g.blockLibrary = bl
+	if g.voxelMap == nil {
+		return
+	}
+	if unknown := g.voxelMap.SetBlockNames(bl.BlockNames()); len(unknown) > 0 {
+		g.logGameError(fmt.Sprintf("[GameInstance] ERR - the blocks %v of the map are unknown and were replaced by air", unknown))
+	}
 }
 
 func (g *GameInstance) GetBlockLibrary() *BlockLibrary {
@@ -533,7 +660,8 @@ func (g *GameInstance) GetBlockDefAt(blockPos voxel.Int3) *BlockDefinition {
 	return g.blockLibrary.GetBlockDefinition(block.ID)
 }
 
-func (g *GameInstance) HandleUnitHitWithProjectile(attacker *UnitInstance, damageModifier float64, rayHitInfo FreeAimHit) (int, bool) {
+// HandleUnitHitWithProjectile applies the damage of a projectile that lost penetrationLoss on the blocks it passed through.
+func (g *GameInstance) HandleUnitHitWithProjectile(attacker *UnitInstance, damageModifier float64, penetrationLoss int, rayHitInfo FreeAimHit) (int, bool) {
 	hitUnit := rayHitInfo.UnitHit.(*UnitInstance)
 	//direction := rayHitInfo.HitInfo3D.CollisionWorldPosition.Sub(rayHitInfo.Origin).Normalize()
 	distance := rayHitInfo.Distance
@@ -542,6 +670,7 @@ func (g *GameInstance) HandleUnitHitWithProjectile(attacker *UnitInstance, damag
 	projectileBaseDamage = attacker.GetWeapon().AdjustDamageForDistance(float32(distance), projectileBaseDamage)
 
 	projectileBaseDamage = int(math.Ceil(float64(projectileBaseDamage) * damageModifier))
+	projectileBaseDamage = max(projectileBaseDamage-penetrationLoss, 0)
 
     // state changes here
 	// 1. apply damage
@@ -556,6 +685,7 @@ func (g *GameInstance) RegisterOverwatch(unit *UnitInstance, targets []voxel.Int
 	for _, target := range targets {
 		g.overwatch[target] = append(g.overwatch[target], unit)
 	}
+	g.hazardsChanged()
 }
 
 func (g *GameInstance) GetEnemiesWatchingPosition(playerID uint64, pos voxel.Int3) ([]*UnitInstance, bool) {
@@ -581,6 +711,7 @@ func (g *GameInstance) RemoveOverwatch(id uint64, pos voxel.Int3) {
 		instance := instances[i]
 		if instance.UnitID() == id {
 			g.overwatch[pos] = append(instances[:i], instances[i+1:]...)
+			g.hazardsChanged()
 			return
 		}
 	}
@@ -612,6 +743,13 @@ func (g *GameInstance) GetRules() *Ruleset {
 	return g.rules
 }
 
+// SetRules replaces the rules of the game with a copy of the given ones.
+func (g *GameInstance) SetRules(rules Ruleset) {
+	rules.engine = g
+	g.rules = &rules
+	g.hazardsChanged()
+}
+
 func (g *GameInstance) GetMapMetadata() *MapMetadata {
 	return g.mapMeta
 }
@@ -634,7 +772,7 @@ func (g *GameInstance) GetMissionDetails() *MissionDetails {
 }
 
 func (g *GameInstance) TryDeploy(playerID uint64, deployment map[uint64]voxel.Int3) bool {
-	for unitID, pos := range deployment {
+	for unitID := range deployment {
 		unit, ok := g.units[unitID]
 		if !ok {
 			g.logGameError(fmt.Sprintf("[GameInstance] ERR - TryDeploy - Unit %d does not exist", unitID))
@@ -644,15 +782,106 @@ func (g *GameInstance) TryDeploy(playerID uint64, deployment map[uint64]voxel.In
 			g.logGameError(fmt.Sprintf("[GameInstance] ERR - TryDeploy - Unit %d is not controlled by player %d", unitID, playerID))
 			return false
 		}
-		// TODO: needs validation..
+	}
+	if problem := g.checkDeployment(playerID, deployment); problem != "" {
+		g.logGameError(fmt.Sprintf("[GameInstance] ERR - TryDeploy - %s", problem))
+		return false
+	}
+	// clear the old places first, so the units can swap them
+	for unitID := range deployment {
+		g.voxelMap.RemoveUnit(g.units[unitID])
+	}
+	for unitID, pos := range deployment {
+		unit := g.units[unitID]
 		unit.SetBlockPositionAndUpdateStance(pos)
 		unit.StartStanceAnimation()
 	}
 	return true
 }
 
+// checkDeployment makes sure the deployed units are placed in the spawn area of their player, on solid ground,
+// and fit there without overlapping each other or the units that stay where they are. The units of the deployment
+// may take the places they are leaving.
+func (g *GameInstance) checkDeployment(playerID uint64, deployment map[uint64]voxel.Int3) string {
+	spawnArea := g.spawnAreaOf(playerID)
+	claimed := make(map[voxel.Int3]uint64)
+	for unitID, pos := range deployment {
+		unit := g.units[unitID]
+		if !spawnArea[pos] {
+			return fmt.Sprintf("%s(%d) is outside of the spawn area at %s", unit.GetName(), unitID, pos.ToString())
+		}
+		if !g.HasGroundUnder(unit, pos) {
+			return fmt.Sprintf("%s(%d) has no ground under it at %s", unit.GetName(), unitID, pos.ToString())
+		}
+		for _, offset := range unit.GetOccupiedBlockOffsets(pos) {
+			block := pos.Add(offset)
+			if !g.voxelMap.ContainsGrid(block) || g.voxelMap.IsSolidBlockAt(block.X, block.Y, block.Z) {
+				return fmt.Sprintf("%s(%d) does not fit at %s", unit.GetName(), unitID, pos.ToString())
+			}
+			if other, taken := claimed[block]; taken {
+				return fmt.Sprintf("%s(%d) and unit %d overlap at %s", unit.GetName(), unitID, other, block.ToString())
+			}
+			claimed[block] = unitID
+			if occupant := g.voxelMap.GetMapObjectAt(block); occupant != nil && occupant.UnitID() != unitID {
+				if _, isDeployed := deployment[occupant.UnitID()]; !isDeployed {
+					return fmt.Sprintf("%s(%d) is blocked by %s(%d) at %s", unit.GetName(), unitID, occupant.GetName(), occupant.UnitID(), block.ToString())
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func (g *GameInstance) spawnAreaOf(playerID uint64) map[voxel.Int3]bool {
+	spawnArea := make(map[voxel.Int3]bool)
+	playerIndex := g.IndexOfPlayer(playerID)
+	if playerIndex < 0 || g.mapMeta == nil || playerIndex >= len(g.mapMeta.SpawnPositions) {
+		return spawnArea
+	}
+	for _, pos := range g.mapMeta.SpawnPositions[playerIndex] {
+		spawnArea[pos] = true
+	}
+	return spawnArea
+}
+
+// HasGroundUnder is true, when every block of the lowest layer of the unit placed at the position rests on a solid one.
+func (g *GameInstance) HasGroundUnder(unit *UnitInstance, pos voxel.Int3) bool {
+	for _, offset := range unit.GetOccupiedBlockOffsets(pos) {
+		if offset.Y != 0 {
+			continue
+		}
+		below := pos.Add(offset).Sub(voxel.Up)
+		if !g.voxelMap.IsSolidBlockAt(below.X, below.Y, below.Z) {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *GameInstance) IsStarted() bool {
+	return g.started
+}
+
+func (g *GameInstance) GetTurnCounter() int {
+	return g.turnCounter
+}
+
+// HasTurnsStarted is false while the players are still loading the map or deploying their units.
+func (g *GameInstance) HasTurnsStarted() bool {
+	return g.turnCounter > 0
+}
+
+func (g *GameInstance) StartDeployment() {
+	g.deploymentRunning = true
+}
+
+func (g *GameInstance) IsDeploymentRunning() bool {
+	return g.deploymentRunning
+}
+
 func (g *GameInstance) DeploymentDone() {
 	g.waitForDeployment = false
+	g.deploymentRunning = false
 }
 
 func (g *GameInstance) logGameInfo(text string) {
@@ -695,6 +924,7 @@ func (g *GameInstance) addBlockStatusEffect(location voxel.Int3, effect BlockEff
 		}
 	}
 	g.activeBlockEffects[location] = BlockStatusEffectInstance{Effect: effect, Turns: turnsToLive}
+	g.hazardsChanged()
 	g.blockEffectAdded(location, effect)
 }
 
@@ -710,6 +940,24 @@ func (g *GameInstance) blockEffectRemoved(location voxel.Int3, effect BlockEffec
 	}
 }
 
+func (g *GameInstance) GetActiveBlockEffects() []BlockEffectState {
+	result := make([]BlockEffectState, 0, len(g.activeBlockEffects))
+	for location, effect := range g.activeBlockEffects {
+		result = append(result, BlockEffectState{Position: location, Effect: effect.Effect, Turns: effect.Turns})
+	}
+	return result
+}
+
+// SetActiveBlockEffects replaces all block effects, the callbacks fire for every removed and added effect.
+func (g *GameInstance) SetActiveBlockEffects(effects []BlockEffectState) {
+	for location, effect := range g.activeBlockEffects {
+		g.removeBlockStatusEffect(location, effect.Effect)
+	}
+	for _, effect := range effects {
+		g.addBlockStatusEffect(effect.Position, effect.Effect, effect.Turns)
+	}
+}
+
 func (g *GameInstance) removeBlockStatusEffect(location voxel.Int3, effect BlockEffect) {
 	currentEffect, exists := g.activeBlockEffects[location]
 	if !exists {
@@ -720,6 +968,7 @@ func (g *GameInstance) removeBlockStatusEffect(location voxel.Int3, effect Block
 		return
 	}
 	delete(g.activeBlockEffects, location)
+	g.hazardsChanged()
 	g.blockEffectRemoved(location, effect)
 }
 
@@ -749,11 +998,16 @@ func (g *GameInstance) CalculateBaseHitCoverageFromCamera(attacker *UnitInstance
 			dirVec = mgl32.Vec2{dirVec.X(), dirVec.Y() * aspectRatio}
 			rayStart, rayEnd := cam.GetRayInCircleFrustum(dirVec, achievedAccuracy)
 			probeCount++
-			if g.RayCastHitUnit(rayStart, rayEnd, attacker, target) {
+			hit := g.RayCastHitUnit(rayStart, rayEnd, attacker, target)
+			if hit {
 				hitCounter++
-				g.onDebugPos(rayStart, ColorPositiveGreen.Vec3())
-			} else {
-				g.onDebugPos(rayStart, ColorNegativeRed.Vec3())
+			}
+			if g.onDebugPos != nil {
+				if hit {
+					g.onDebugPos(rayStart, ColorPositiveGreen.Vec3())
+				} else {
+					g.onDebugPos(rayStart, ColorNegativeRed.Vec3())
+				}
 			}
 		}
 		c = 8
@@ -0,0 +1,122 @@
+package game
+
+import (
+	"fmt"
+	"github.com/memmaker/battleground/engine/voxel"
+	"sort"
+	"strings"
+)
+
+type HazardKind string
+
+const (
+	HazardFire      HazardKind = "fire"
+	HazardPoison    HazardKind = "poison"
+	HazardSmoke     HazardKind = "smoke"
+	HazardOverwatch HazardKind = "overwatch" // a position watched by an enemy
+	HazardTerrain   HazardKind = "terrain"   // a block that is slow to walk on, its costs are per block name
+)
+
+var hazardKindsOfBlockEffects = []struct {
+	effect BlockEffect
+	kind   HazardKind
+}{
+	{BlockEffectFire, HazardFire},
+	{BlockEffectPoison, HazardPoison},
+	{BlockEffectSmoke, HazardSmoke},
+}
+
+// PathHazard is a hazard on a step of a path.
+type PathHazard struct {
+	Position voxel.Int3
+	Kind     HazardKind
+	Terrain  string // Terrain is the block name for HazardTerrain
+	Cost     float64
+}
+
+// PathHazards tells the pathfinding what a step costs on top of its length, as far as the owner of the mover knows.
+type PathHazards interface {
+	HazardCost(mover *UnitInstance, position voxel.Int3) float64
+	HazardsAt(mover *UnitInstance, position voxel.Int3) []PathHazard
+	// HazardGeneration changes whenever a hazard appears or goes away.
+	HazardGeneration() uint64
+}
+
+// isWorthAWarning is false for the hazards that only slow a unit down.
+func (h PathHazard) isWorthAWarning() bool {
+	return h.Kind == HazardFire || h.Kind == HazardPoison || h.Kind == HazardOverwatch
+}
+
+// DescribeHazards summarizes the hazards of a route for a warning, like "fire (2), overwatch (1)".
+func DescribeHazards(hazards []PathHazard) string {
+	counts := make(map[string]int)
+	for _, hazard := range hazards {
+		if hazard.isWorthAWarning() {
+			counts[string(hazard.Kind)]++
+		}
+	}
+	descriptions := make([]string, 0, len(counts))
+	for kind, count := range counts {
+		descriptions = append(descriptions, fmt.Sprintf("%s (%d)", kind, count))
+	}
+	sort.Strings(descriptions)
+	return strings.Join(descriptions, ", ")
+}
+
+func (g *GameInstance) HazardCost(mover *UnitInstance, position voxel.Int3) float64 {
+	cost := 0.0
+	g.forEachHazard(mover, position, func(kind HazardKind, terrain string, hazardCost float64) {
+		cost += hazardCost
+	})
+	return cost
+}
+
+func (g *GameInstance) HazardsAt(mover *UnitInstance, position voxel.Int3) []PathHazard {
+	var hazards []PathHazard
+	g.forEachHazard(mover, position, func(kind HazardKind, terrain string, cost float64) {
+		hazards = append(hazards, PathHazard{Position: position, Kind: kind, Terrain: terrain, Cost: cost})
+	})
+	return hazards
+}
+
+func (g *GameInstance) HazardGeneration() uint64 {
+	return g.hazardGeneration
+}
+
+// forEachHazard looks at the block effects where the unit stands and at its head, the enemy overwatch on the
+// position and the block below it.
+func (g *GameInstance) forEachHazard(mover *UnitInstance, position voxel.Int3, onHazard func(kind HazardKind, terrain string, cost float64)) {
+	var effects BlockEffect
+	for _, location := range []voxel.Int3{position, position.Add(voxel.Int3{Y: 1})} {
+		if effect, exists := g.activeBlockEffects[location]; exists {
+			effects |= effect.Effect
+		}
+	}
+	for _, known := range hazardKindsOfBlockEffects {
+		if effects&known.effect != 0 {
+			onHazard(known.kind, "", g.rules.HazardCosts[known.kind])
+		}
+	}
+	// the positions are sent to all players when the overwatch begins
+	for _, watcher := range g.overwatch[position] {
+		if watcher.ControlledBy() != mover.ControlledBy() && watcher.IsActive() {
+			onHazard(HazardOverwatch, "", g.rules.HazardCosts[HazardOverwatch])
+			break
+		}
+	}
+	if len(g.rules.TerrainCosts) > 0 && g.blockLibrary != nil {
+		ground := g.voxelMap.GetGlobalBlock(position.X, position.Y-1, position.Z)
+		if ground == nil || ground.IsAir() {
+			return
+		}
+		if definition := g.blockLibrary.GetBlockDefinition(ground.ID); definition != nil {
+			if cost, isSlow := g.rules.TerrainCosts[definition.UniqueName]; isSlow && cost > 0 {
+				onHazard(HazardTerrain, definition.UniqueName, cost)
+			}
+		}
+	}
+}
+
+func (g *GameInstance) hazardsChanged() {
+	g.hazardGeneration++
+}
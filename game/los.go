@@ -14,6 +14,11 @@ func (g *GameInstance) SetLOSAndPressure(los map[uint64]map[uint64]bool, pressur
 	g.pressureMatrix = pressure
 }
 
+// GetCompleteLOSMatrix is the unfiltered view of who can see whom, only spectators should ever receive it.
+func (g *GameInstance) GetCompleteLOSMatrix() map[uint64]map[uint64]bool {
+	return g.losMatrix
+}
+
 func (g *GameInstance) InitLOSAndPressure() {
 	for _, unit := range g.units {
 		g.losMatrix[unit.UnitID()] = make(map[uint64]bool)
@@ -126,21 +131,21 @@ func (g *GameInstance) CanSeeFromTo(observer, another *UnitInstance, observerEye
 		return false
 	}
 
-	targetTwo := targetFootPosition
-	targetOne := targetFootPosition.Add(another.GetEyeOffset())
+	targetPositions := []mgl32.Vec3{targetFootPosition.Add(another.GetEyeOffset()), targetFootPosition}
+	if another.HasFootprint() {
+		// the corners of a big unit may stick out behind cover
+		for _, corner := range another.Definition.Footprint.CornerOffsets(another.GetForward2DCardinal()) {
+			targetPositions = append(targetPositions, targetFootPosition.Add(corner))
+		}
+	}
 
 	originPositions := []mgl32.Vec3{observerEye.Add(mgl32.Vec3{-0.5, 0, -0.5}), observerEye.Add(mgl32.Vec3{0.5, 0, -0.5}), observerEye.Add(mgl32.Vec3{-0.5, 0, 0.5}), observerEye.Add(mgl32.Vec3{0.5, 0, 0.5})}
 	for _, observerEyePosition := range originPositions {
-		rayOne := g.RayCastLineOfSight(observerEyePosition, targetOne, another, voxel.PositionToGridInt3(targetFootPosition))
-
-		if rayOne.UnitHit == another {
-			return true
-		} // fast exit
-
-		rayTwo := g.RayCastLineOfSight(observerEyePosition, targetTwo, another, voxel.PositionToGridInt3(targetFootPosition))
-
-		if rayTwo.UnitHit == another {
-			return true
+		for _, targetPosition := range targetPositions {
+			ray := g.RayCastLineOfSight(observerEyePosition, targetPosition, another, voxel.PositionToGridInt3(targetFootPosition))
+			if ray.UnitHit == another {
+				return true
+			} // fast exit
 		}
 	}
 	return false
@@ -176,6 +181,33 @@ func (g *GameInstance) GetReverseLOSChangesForUser(userID uint64, mover *UnitIns
 	return seenBy, hiddenTo
 }
 
+// UpdateLOSAfterMove updates who the unit can see and who can see it at its current position, together with the
+// pressure between it and its enemies.
+func (g *GameInstance) UpdateLOSAfterMove(unit *UnitInstance) {
+	visibles, invisibles, _ := g.GetLOSChanges(unit, unit.GetBlockPosition())
+	for _, other := range visibles {
+		g.SetLOS(unit.UnitID(), other.UnitID(), true)
+	}
+	for _, other := range invisibles {
+		g.SetLOS(unit.UnitID(), other.UnitID(), false)
+	}
+
+	for _, playerID := range g.players {
+		if playerID == unit.ControlledBy() {
+			continue
+		}
+		seenByPlayer, hiddenToPlayer := g.GetReverseLOSChangesForUser(playerID, unit)
+		for _, observer := range seenByPlayer {
+			g.SetLOS(observer, unit.UnitID(), true)
+		}
+		for _, observer := range hiddenToPlayer {
+			g.SetLOS(observer, unit.UnitID(), false)
+		}
+	}
+
+	g.UpdatePressureAfterMove(unit)
+}
+
 func (g *GameInstance) GetLOSChanges(unit *UnitInstance, pos voxel.Int3) ([]*UnitInstance, []*UnitInstance, bool) {
 	allVisibleEnemies := g.GetAllVisibleEnemies(unit.ControlledBy())
 	visibleEnemiesForUnit := g.losMatrix[unit.UnitID()]
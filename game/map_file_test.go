@@ -0,0 +1,127 @@
+package game
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"github.com/memmaker/battleground/engine/voxel"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func saveAndLoadMap(t *testing.T, voxelMap *voxel.Map, metadata []byte) (*voxel.Map, voxel.MapFile) {
+	t.Helper()
+	filename := path.Join(t.TempDir(), "map.bin")
+	if err := voxelMap.SaveToDisk(filename, metadata); err != nil {
+		t.Fatal(err)
+	}
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadedMap, file, err := voxel.NewMapFromSource(source, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loadedMap, file
+}
+
+func TestMapFileKeepsBlocksByName(t *testing.T) {
+	voxelMap := voxel.NewMapWithEmptyChunks(2, 1, 2, 16, 16)
+	voxelMap.SetFloorAtHeight(0, voxel.NewBlock(1))
+	voxelMap.SetBlock(3, 1, 3, voxel.NewBlock(2))
+	voxelMap.SetBlock(20, 1, 20, voxel.NewBlock(3))
+	voxelMap.SetBlockNames([]string{voxel.AirBlockName, "bricks", "tnt", "clay"})
+
+	loadedMap, file := saveAndLoadMap(t, voxelMap, []byte(`{"Name":"Arena"}`))
+	if file.Version != voxel.MapFormatVersion || string(file.Metadata) != `{"Name":"Arena"}` {
+		t.Fatalf("loaded version %d with metadata %s", file.Version, file.Metadata)
+	}
+
+	// the block list changed, tnt moved and clay is gone
+	unknown := loadedMap.SetBlockNames([]string{voxel.AirBlockName, "tnt", "gravel", "bricks"})
+	if !slices.Equal(unknown, []string{"clay"}) {
+		t.Errorf("got unknown blocks %v, want clay", unknown)
+	}
+	for _, test := range []struct {
+		position voxel.Int3
+		id       byte
+	}{{voxel.Int3{X: 31, Z: 31}, 3}, {voxel.Int3{X: 3, Y: 1, Z: 3}, 1}, {voxel.Int3{X: 20, Y: 1, Z: 20}, voxel.EMPTYBLOCK}, {voxel.Int3{X: 5, Y: 5, Z: 5}, voxel.EMPTYBLOCK}} {
+		if block := loadedMap.GetBlockFromVec(test.position); block == nil || block.ID != test.id {
+			t.Errorf("the block at %s is %v, want id %d", test.position.ToString(), block, test.id)
+		}
+	}
+}
+
+func TestMapFileUpgradesVersion1(t *testing.T) {
+	source, err := os.ReadFile("../assets/maps/map.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldMap, file, err := voxel.NewMapFromSource(source, nil, nil)
+	if err != nil || file.Version != 1 {
+		t.Fatalf("loaded version %d: %v", file.Version, err)
+	}
+	blockNames := NewBlockLibrary(GetDebugBlockNames(), nil).BlockNames()
+	oldMap.SetBlockNames(blockNames)
+
+	upgraded, file := saveAndLoadMap(t, oldMap, nil)
+	if file.Version != voxel.MapFormatVersion {
+		t.Fatalf("saved version %d", file.Version)
+	}
+	upgraded.SetBlockNames(blockNames)
+	size := oldMap.GetSize()
+	if upgraded.GetSize() != size || upgraded.ChunkSizeCube != oldMap.ChunkSizeCube {
+		t.Fatalf("the upgraded map has %s chunks of %d blocks, not %s of %d", upgraded.GetSize().ToString(), upgraded.ChunkSizeCube, size.ToString(), oldMap.ChunkSizeCube)
+	}
+	for x := int32(0); x < size.X*oldMap.ChunkSizeHorizontal; x++ {
+		for y := int32(0); y < size.Y*oldMap.ChunkSizeHeight; y++ {
+			for z := int32(0); z < size.Z*oldMap.ChunkSizeHorizontal; z++ {
+				if before, after := oldMap.GetGlobalBlock(x, y, z), upgraded.GetGlobalBlock(x, y, z); before.ID != after.ID {
+					t.Fatalf("the block at %d,%d,%d changed from %d to %d", x, y, z, before.ID, after.ID)
+				}
+			}
+		}
+	}
+}
+
+func TestMapFileWithManyChunks(t *testing.T) {
+	voxelMap := voxel.NewMapWithEmptyChunks(200, 1, 200, 2, 2)
+	voxelMap.SetBlock(399, 1, 399, voxel.NewBlock(1))
+	voxelMap.SetBlockNames([]string{voxel.AirBlockName, "bricks"})
+	loadedMap, _ := saveAndLoadMap(t, voxelMap, nil)
+	if block := loadedMap.GetGlobalBlock(399, 1, 399); block == nil || block.ID != 1 {
+		t.Errorf("the block in the last of 40000 chunks is %v", block)
+	}
+}
+
+func TestMapFileRejectsVersion1ChunksOutsideOfTheMap(t *testing.T) {
+	var raw bytes.Buffer
+	binary.Write(&raw, binary.LittleEndian, []int32{2, 2, 1, 1, 1}) // chunk sizes and dimensions
+	binary.Write(&raw, binary.LittleEndian, int16(2))
+	for _, chunkPos := range [][3]int32{{0, 0, 0}, {3, 0, 0}} {
+		binary.Write(&raw, binary.LittleEndian, chunkPos)
+		raw.Write(make([]byte, 2*2*2))
+	}
+	var source bytes.Buffer
+	gzipWriter := gzip.NewWriter(&source)
+	gzipWriter.Write(raw.Bytes())
+	gzipWriter.Close()
+
+	if _, _, err := voxel.NewMapFromSource(source.Bytes(), nil, nil); err == nil {
+		t.Error("expected a chunk outside of the map to be refused")
+	}
+}
+
+func TestMapFileRejectsLongBlockNames(t *testing.T) {
+	voxelMap := voxel.NewMapWithEmptyChunks(1, 1, 1, 2, 2)
+	voxelMap.SetBlock(0, 0, 0, voxel.NewBlock(1))
+	voxelMap.SetBlockNames([]string{voxel.AirBlockName, strings.Repeat("b", 256)})
+	if err := voxelMap.Save(io.Discard, nil); err == nil {
+		t.Error("expected a block name of 256 bytes to be refused")
+	}
+}
@@ -1,7 +1,6 @@
 package game
 
 import (
-	"encoding/json"
 	"github.com/memmaker/battleground/engine/util"
 	"github.com/memmaker/battleground/engine/voxel"
 	"os"
@@ -14,19 +13,7 @@ type MapMetadata struct {
 	Blocks         string
 }
 
-func (m *MapMetadata) SaveToDisk(mapfilename string) error {
-	metaFilename := mapfilename + ".meta"
-	file, err := os.Create(metaFilename)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	return encoder.Encode(m)
-}
-
+// NewMapMetadataFromFile reads the .meta file of a version 1 map, newer map files contain their metadata.
 func NewMapMetadataFromFile(filename string) MapMetadata {
 	if util.DoesFileExist(filename) {
 		var metadata MapMetadata
@@ -0,0 +1,267 @@
+package game
+
+import (
+	"fmt"
+	"github.com/memmaker/battleground/engine/util"
+	"io"
+	"sort"
+	"sync"
+)
+
+// WeaponStatistics counts what the shots of one weapon did.
+type WeaponStatistics struct {
+	Shots       int // Shots counts the projectiles, a shotgun fires several per attack
+	Hits        int
+	Damage      int
+	Kills       int
+	Overwatches int // Overwatches counts the attacks that were triggered by overwatch
+}
+
+// MatchStatistics is what happened in one game, as seen by a spectator.
+type MatchStatistics struct {
+	Factions             []string // the factions in the order of the players
+	Winner               string   // the faction of the winner, empty if the game didn't end
+	Turns                int
+	Weapons              map[string]*WeaponStatistics
+	DamageByZone         map[util.DamageZone]int
+	OverwatchesStarted   int
+	OverwatchesTriggered int
+}
+
+// MatchObserver watches a game with the spectator messages of the server and counts what happens.
+// Its OnServerMessage can be used as the event handler of a spectating connection.
+type MatchObserver struct {
+	lock          sync.Mutex
+	stats         MatchStatistics
+	unitWeapons   map[uint64]string
+	unitOwners    map[uint64]uint64
+	factions      map[uint64]string
+	currentPlayer uint64
+	over          chan struct{}
+}
+
+func NewMatchObserver() *MatchObserver {
+	return &MatchObserver{
+		stats: MatchStatistics{
+			Weapons:      make(map[string]*WeaponStatistics),
+			DamageByZone: make(map[util.DamageZone]int),
+		},
+		unitWeapons: make(map[uint64]string),
+		unitOwners:  make(map[uint64]uint64),
+		factions:    make(map[uint64]string),
+		over:        make(chan struct{}),
+	}
+}
+
+func (o *MatchObserver) OnServerMessage(msg StringMessage) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	switch msg.MessageType {
+	case "SpectatorState":
+		var state SpectatorStateMessage
+		if util.FromJson(msg.Message, &state) {
+			o.onState(state)
+		}
+	case "NextPlayer":
+		var nextPlayer NextPlayerMessage
+		if util.FromJson(msg.Message, &nextPlayer) {
+			o.currentPlayer = nextPlayer.CurrentPlayer
+			o.stats.Turns++
+		}
+	case "RangedAttack":
+		var attack VisualRangedAttack
+		if util.FromJson(msg.Message, &attack) {
+			o.onRangedAttack(attack)
+		}
+	case "BeginOverwatch":
+		o.stats.OverwatchesStarted++
+	case "GameOver":
+		var gameOver GameOverMessage
+		if util.FromJson(msg.Message, &gameOver) {
+			o.stats.Winner = o.factions[gameOver.WinnerID]
+			close(o.over)
+		}
+	}
+}
+
+func (o *MatchObserver) onState(state SpectatorStateMessage) {
+	if len(o.stats.Factions) == 0 {
+		o.stats.Turns = 1
+		for _, playerID := range sortedPlayerIDs(state.PlayerFactionMap) {
+			o.stats.Factions = append(o.stats.Factions, state.PlayerFactionMap[playerID])
+		}
+	}
+	for playerID, faction := range state.PlayerFactionMap {
+		o.factions[playerID] = faction
+	}
+	o.currentPlayer = state.CurrentPlayer
+	for _, unit := range state.Units {
+		o.unitOwners[unit.UnitID()] = unit.ControlledBy()
+		if unit.Weapon != nil {
+			o.unitWeapons[unit.UnitID()] = unit.Weapon.Definition.UniqueName
+		}
+	}
+}
+
+func (o *MatchObserver) onRangedAttack(attack VisualRangedAttack) {
+	weaponName, known := o.unitWeapons[attack.Attacker]
+	if !known {
+		weaponName = string(attack.WeaponType)
+	}
+	weapon, exists := o.stats.Weapons[weaponName]
+	if !exists {
+		weapon = &WeaponStatistics{}
+		o.stats.Weapons[weaponName] = weapon
+	}
+	// overwatch fires while the other side moves
+	if o.unitOwners[attack.Attacker] != o.currentPlayer {
+		weapon.Overwatches++
+		o.stats.OverwatchesTriggered++
+	}
+	for _, projectile := range attack.Projectiles {
+		weapon.Shots++
+		if projectile.UnitHit < 0 {
+			continue
+		}
+		weapon.Hits++
+		weapon.Damage += projectile.Damage
+		o.stats.DamageByZone[projectile.BodyPart] += projectile.Damage
+		if projectile.IsLethal {
+			weapon.Kills++
+		}
+	}
+}
+
+// Done is closed when the game is over.
+func (o *MatchObserver) Done() <-chan struct{} {
+	return o.over
+}
+
+// Statistics returns a copy of what was counted so far.
+func (o *MatchObserver) Statistics() MatchStatistics {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	stats := o.stats
+	stats.Factions = append([]string(nil), o.stats.Factions...)
+	stats.Weapons = make(map[string]*WeaponStatistics, len(o.stats.Weapons))
+	for name, weapon := range o.stats.Weapons {
+		weaponCopy := *weapon
+		stats.Weapons[name] = &weaponCopy
+	}
+	stats.DamageByZone = make(map[util.DamageZone]int, len(o.stats.DamageByZone))
+	for zone, damage := range o.stats.DamageByZone {
+		stats.DamageByZone[zone] = damage
+	}
+	return stats
+}
+
+func sortedPlayerIDs(players map[uint64]string) []uint64 {
+	ids := make([]uint64, 0, len(players))
+	for id := range players {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// BatchStatistics sums up the statistics of many games, for balancing the weapons.
+type BatchStatistics struct {
+	Matches              int
+	Draws                int // Draws are the games that were stopped at the turn limit
+	Wins                 map[string]int
+	Appearances          map[string]int
+	Turns                int
+	Weapons              map[string]*WeaponStatistics
+	DamageByZone         map[util.DamageZone]int
+	OverwatchesStarted   int
+	OverwatchesTriggered int
+}
+
+func NewBatchStatistics() *BatchStatistics {
+	return &BatchStatistics{
+		Wins:         make(map[string]int),
+		Appearances:  make(map[string]int),
+		Weapons:      make(map[string]*WeaponStatistics),
+		DamageByZone: make(map[util.DamageZone]int),
+	}
+}
+
+func (b *BatchStatistics) Add(match MatchStatistics) {
+	b.Matches++
+	b.Turns += match.Turns
+	if match.Winner == "" {
+		b.Draws++
+	} else {
+		b.Wins[match.Winner]++
+	}
+	for _, faction := range uniqueStrings(match.Factions) {
+		b.Appearances[faction]++
+	}
+	for name, weapon := range match.Weapons {
+		sum, exists := b.Weapons[name]
+		if !exists {
+			sum = &WeaponStatistics{}
+			b.Weapons[name] = sum
+		}
+		sum.Shots += weapon.Shots
+		sum.Hits += weapon.Hits
+		sum.Damage += weapon.Damage
+		sum.Kills += weapon.Kills
+		sum.Overwatches += weapon.Overwatches
+	}
+	for zone, damage := range match.DamageByZone {
+		b.DamageByZone[zone] += damage
+	}
+	b.OverwatchesStarted += match.OverwatchesStarted
+	b.OverwatchesTriggered += match.OverwatchesTriggered
+}
+
+func uniqueStrings(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if !containsString(result, value) {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// WriteReport prints the statistics as plain text tables.
+func (b *BatchStatistics) WriteReport(w io.Writer) {
+	fmt.Fprintf(w, "Matches: %d, draws: %d, average turns: %0.1f\n", b.Matches, b.Draws, ratio(b.Turns, b.Matches))
+
+	fmt.Fprintf(w, "\nWin rates\n")
+	for _, faction := range sortedKeys(b.Appearances) {
+		fmt.Fprintf(w, "  %-20s %4d of %4d  %5.1f%%\n", faction, b.Wins[faction], b.Appearances[faction], 100*ratio(b.Wins[faction], b.Appearances[faction]))
+	}
+
+	fmt.Fprintf(w, "\nWeapons                shots   hits  hit%%  damage  dmg/shot  kills  overwatch\n")
+	for _, name := range sortedKeys(b.Weapons) {
+		weapon := b.Weapons[name]
+		fmt.Fprintf(w, "  %-20s %6d %6d %5.1f %7d %9.2f %6d %10d\n", name, weapon.Shots, weapon.Hits, 100*ratio(weapon.Hits, weapon.Shots), weapon.Damage, ratio(weapon.Damage, weapon.Shots), weapon.Kills, weapon.Overwatches)
+	}
+
+	totalDamage := 0
+	for _, damage := range b.DamageByZone {
+		totalDamage += damage
+	}
+	fmt.Fprintf(w, "\nDamage by zone\n")
+	zones := make([]string, 0, len(b.DamageByZone))
+	for zone := range b.DamageByZone {
+		zones = append(zones, string(zone))
+	}
+	sort.Strings(zones)
+	for _, zone := range zones {
+		damage := b.DamageByZone[util.DamageZone(zone)]
+		fmt.Fprintf(w, "  %-20s %7d  %5.1f%%\n", zone, damage, 100*ratio(damage, totalDamage))
+	}
+
+	fmt.Fprintf(w, "\nOverwatch: %d started, %d triggered (%0.1f%%)\n", b.OverwatchesStarted, b.OverwatchesTriggered, 100*ratio(b.OverwatchesTriggered, b.OverwatchesStarted))
+}
+
+func ratio(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
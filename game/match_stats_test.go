@@ -0,0 +1,74 @@
+package game
+
+import (
+	"encoding/json"
+	"github.com/memmaker/battleground/engine/util"
+	"strings"
+	"testing"
+)
+
+func observe(t *testing.T, observer *MatchObserver, messageType string, message any) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	observer.OnServerMessage(StringMessage{MessageType: messageType, Message: string(data)})
+}
+
+func TestMatchObserver(t *testing.T) {
+	rifle := &Weapon{Definition: &WeaponDefinition{UniqueName: "M16 Rifle"}}
+	observer := NewMatchObserver()
+	observe(t, observer, "SpectatorState", SpectatorStateMessage{
+		PlayerFactionMap: map[uint64]string{1: "X-Com", 2: "Deep Ones"},
+		Units: []*UnitInstance{
+			{GameUnitID: 10, Owner: 1, Weapon: rifle},
+			{GameUnitID: 20, Owner: 2},
+		},
+		CurrentPlayer: 1,
+	})
+	// a burst in the turn of the attacker, one bullet kills
+	observe(t, observer, "RangedAttack", VisualRangedAttack{Attacker: 10, Projectiles: []VisualProjectile{
+		{UnitHit: -1},
+		{UnitHit: 20, BodyPart: util.ZoneHead, Damage: 4, IsLethal: true},
+	}})
+	observe(t, observer, "BeginOverwatch", struct{}{})
+	observe(t, observer, "NextPlayer", NextPlayerMessage{CurrentPlayer: 2})
+	// the other side moves into the overwatch
+	observe(t, observer, "RangedAttack", VisualRangedAttack{Attacker: 10, Projectiles: []VisualProjectile{
+		{UnitHit: 20, BodyPart: util.ZoneTorso, Damage: 2},
+	}})
+	select {
+	case <-observer.Done():
+		t.Fatal("the game is not over yet")
+	default:
+	}
+	observe(t, observer, "GameOver", GameOverMessage{WinnerID: 1})
+	<-observer.Done()
+
+	stats := observer.Statistics()
+	if stats.Winner != "X-Com" || stats.Turns != 2 {
+		t.Errorf("got winner '%s' after %d turns, want 'X-Com' after 2", stats.Winner, stats.Turns)
+	}
+	want := WeaponStatistics{Shots: 3, Hits: 2, Damage: 6, Kills: 1, Overwatches: 1}
+	if got := stats.Weapons["M16 Rifle"]; got == nil || *got != want {
+		t.Errorf("got rifle statistics %v, want %v", got, want)
+	}
+	if stats.DamageByZone[util.ZoneHead] != 4 || stats.DamageByZone[util.ZoneTorso] != 2 {
+		t.Errorf("got damage by zone %v", stats.DamageByZone)
+	}
+	if stats.OverwatchesStarted != 1 || stats.OverwatchesTriggered != 1 {
+		t.Errorf("got %d overwatches started and %d triggered, want 1 and 1", stats.OverwatchesStarted, stats.OverwatchesTriggered)
+	}
+
+	batch := NewBatchStatistics()
+	batch.Add(stats)
+	batch.Add(MatchStatistics{Factions: []string{"X-Com", "Deep Ones"}, Turns: 60})
+	if batch.Draws != 1 || batch.Wins["X-Com"] != 1 || batch.Appearances["Deep Ones"] != 2 {
+		t.Errorf("got %d draws, wins %v and appearances %v", batch.Draws, batch.Wins, batch.Appearances)
+	}
+	var report strings.Builder
+	batch.WriteReport(&report)
+	if !strings.Contains(report.String(), "average turns: 31.0") {
+		t.Errorf("unexpected report:\n%s", report.String())
+	}
+}
@@ -0,0 +1,107 @@
+package game
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/memmaker/battleground/engine/voxel"
+	"math"
+)
+
+// DefaultMaterialName is the material of the blocks that have none of their own in materials.json.
+const DefaultMaterialName = "default"
+
+// BlockMaterial are the properties of a block that decide how it takes damage. The damage is kept in the block
+// state, so the hit points can be at most voxel.MaxBlockDamage.
+type BlockMaterial struct {
+	HitPoints           int  // HitPoints of 0 make the block indestructible
+	Armor               int  // Armor is taken off the damage of every projectile
+	Penetrable          bool // Penetrable blocks let projectiles through, they are damaged on the way
+	PenetrationLoss     int  // PenetrationLoss is the damage a projectile loses passing through the block
+	Flammability        int  // Flammability is the damage a fire started at or next to the block deals to it
+	ExplosionResistance int  // ExplosionResistance is taken off the voxel.MaxBlockDamage that explosions deal
+}
+
+// fallbackMaterial is used before the server sent the materials, every block can be chipped down.
+var fallbackMaterial = BlockMaterial{HitPoints: voxel.MaxBlockDamage}
+
+// MaxPenetrations limits how many blocks a single projectile can pass through.
+const MaxPenetrations = 8
+
+// SetBlockMaterials sets the materials by block name, with an entry for DefaultMaterialName.
+func (g *GameInstance) SetBlockMaterials(materials map[string]BlockMaterial) {
+	g.blockMaterials = materials
+}
+
+func (g *GameInstance) GetBlockMaterials() map[string]BlockMaterial {
+	return g.blockMaterials
+}
+
+// GetBlockMaterial returns the material of the block at the position.
+func (g *GameInstance) GetBlockMaterial(pos voxel.Int3) BlockMaterial {
+	if g.blockMaterials == nil {
+		return fallbackMaterial
+	}
+	block := g.voxelMap.GetGlobalBlock(pos.X, pos.Y, pos.Z)
+	if block != nil && g.blockLibrary != nil {
+		if definition := g.blockLibrary.GetBlockDefinition(block.ID); definition != nil {
+			if material, exists := g.blockMaterials[definition.UniqueName]; exists {
+				return material
+			}
+		}
+	}
+	return g.blockMaterials[DefaultMaterialName]
+}
+
+// DamageBlock lets the block at the position take the damage of a projectile, less its armor.
+// It returns true if the block was destroyed.
+func (g *GameInstance) DamageBlock(pos voxel.Int3, damage int) bool {
+	material := g.GetBlockMaterial(pos)
+	return g.applyBlockDamage(pos, material, damage-material.Armor)
+}
+
+// applyBlockDamage raises the damage level of the block and destroys it once it reaches the hit points.
+// Only the server does this, the clients get the block states and the destroyed blocks from it.
+func (g *GameInstance) applyBlockDamage(pos voxel.Int3, material BlockMaterial, damage int) bool {
+	if g.isClient || damage <= 0 || material.HitPoints <= 0 || !g.voxelMap.IsSolidBlockAt(pos.X, pos.Y, pos.Z) {
+		return false
+	}
+	state := g.GetBlockState(pos)
+	totalDamage := state.Damage() + damage
+	if totalDamage < material.HitPoints {
+		g.SetBlockState(pos, state.WithDamage(totalDamage))
+		return false
+	}
+	g.DestroyBlock(pos)
+	return !g.voxelMap.IsSolidBlockAt(pos.X, pos.Y, pos.Z)
+}
+
+func (g *GameInstance) applyExplosionToBlock(pos voxel.Int3) {
+	material := g.GetBlockMaterial(pos)
+	g.applyBlockDamage(pos, material, voxel.MaxBlockDamage-material.ExplosionResistance)
+}
+
+// burnBlocksAround damages the flammable blocks at and next to the location of a new fire.
+func (g *GameInstance) burnBlocksAround(location voxel.Int3) {
+	for _, offset := range []voxel.Int3{{}, voxel.NorthDir, voxel.SouthDir, voxel.EastDir, voxel.WestDir, voxel.Up, voxel.Up.Mul(-1)} {
+		pos := location.Add(offset)
+		if !g.voxelMap.Contains(pos.X, pos.Y, pos.Z) {
+			continue
+		}
+		if material := g.GetBlockMaterial(pos); material.Flammability > 0 {
+			g.applyBlockDamage(pos, material, material.Flammability)
+		}
+	}
+}
+
+// PenetrationExit returns a point just behind the block where a ray starting at origin leaves it.
+func PenetrationExit(origin, direction mgl32.Vec3, block voxel.Int3) mgl32.Vec3 {
+	exit := float32(math.MaxFloat32)
+	corner := block.ToVec3()
+	for axis := 0; axis < 3; axis++ {
+		if direction[axis] > 0 {
+			exit = min(exit, (corner[axis]+1-origin[axis])/direction[axis])
+		} else if direction[axis] < 0 {
+			exit = min(exit, (corner[axis]-origin[axis])/direction[axis])
+		}
+	}
+	return origin.Add(direction.Mul(exit + 0.01))
+}
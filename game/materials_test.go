@@ -0,0 +1,104 @@
+package game
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/memmaker/battleground/engine/voxel"
+	"testing"
+)
+
+func newMaterialGame(t *testing.T) *GameInstance {
+	t.Helper()
+	voxelMap := voxel.NewMapWithEmptyChunks(1, 1, 1, 16, 16)
+	library := NewBlockLibrary([]string{"bedrock", "bricks", "iron_block", "birch_planks"}, nil)
+	voxelMap.SetFloorAtHeight(0, library.NewBlockFromName("bedrock"))
+	for x, name := range []string{"bricks", "iron_block", "birch_planks"} {
+		voxelMap.SetBlock(int32(x)+2, 1, 2, library.NewBlockFromName(name))
+	}
+	g := &GameInstance{voxelMap: voxelMap, activeBlockEffects: make(map[voxel.Int3]BlockStatusEffectInstance)}
+	g.rules = NewDefaultRuleset(g)
+	g.SetBlockLibrary(library)
+	g.SetBlockMaterials(map[string]BlockMaterial{
+		DefaultMaterialName: {HitPoints: 10, Armor: 10},
+		"bedrock":           {},
+		"bricks":            {HitPoints: 5},
+		"iron_block":        {HitPoints: 15, Armor: 3, ExplosionResistance: 6},
+		"birch_planks":      {HitPoints: 6, Penetrable: true, PenetrationLoss: 1, Flammability: 4},
+	})
+	return g
+}
+
+func TestBlocksAreChippedDown(t *testing.T) {
+	g := newMaterialGame(t)
+	bricks, iron := voxel.Int3{X: 2, Y: 1, Z: 2}, voxel.Int3{X: 3, Y: 1, Z: 2}
+
+	if g.DamageBlock(bricks, 3) || g.GetBlockState(bricks).Damage() != 3 {
+		t.Fatalf("the bricks have damage %d after the first hit", g.GetBlockState(bricks).Damage())
+	}
+	if !g.DamageBlock(bricks, 2) || g.voxelMap.IsSolidBlockAt(bricks.X, bricks.Y, bricks.Z) {
+		t.Error("the bricks survived the second hit")
+	}
+	if g.DamageBlock(iron, 3) || g.GetBlockState(iron).Damage() != 0 {
+		t.Errorf("the armor of the iron did not stop the hit, damage %d", g.GetBlockState(iron).Damage())
+	}
+	if g.DamageBlock(voxel.Int3{X: 7, Z: 7}, 100) {
+		t.Error("the bedrock was destroyed")
+	}
+}
+
+func TestExplosionsAndFireUseTheMaterials(t *testing.T) {
+	g := newMaterialGame(t)
+	iron, planks := voxel.Int3{X: 3, Y: 1, Z: 2}, voxel.Int3{X: 4, Y: 1, Z: 2}
+
+	g.applyExplosionToBlock(iron)
+	if damage := g.GetBlockState(iron).Damage(); damage != voxel.MaxBlockDamage-6 {
+		t.Errorf("the explosion left the iron with damage %d", damage)
+	}
+
+	g.AddFireAt(planks.Add(voxel.Int3{Y: 1}), 2)
+	if damage := g.GetBlockState(planks).Damage(); damage != 4 {
+		t.Errorf("the fire above left the planks with damage %d, want 4", damage)
+	}
+	g.AddFireAt(planks.Add(voxel.Int3{Y: 1}), 2)
+	if g.voxelMap.IsSolidBlockAt(planks.X, planks.Y, planks.Z) {
+		t.Error("the planks did not burn down")
+	}
+	if damage := g.GetBlockState(iron).Damage(); damage != voxel.MaxBlockDamage-6 {
+		t.Errorf("the fire damaged the iron to %d", damage)
+	}
+}
+
+func TestPenetrationExit(t *testing.T) {
+	origin := mgl32.Vec3{0.5, 1.5, 2.5}
+	exit := PenetrationExit(origin, mgl32.Vec3{1, 0, 0}, voxel.Int3{X: 4, Y: 1, Z: 2})
+	if voxel.PositionToGridInt3(exit) != (voxel.Int3{X: 5, Y: 1, Z: 2}) {
+		t.Errorf("the ray leaves the block at %v", exit)
+	}
+	exit = PenetrationExit(origin, mgl32.Vec3{-1, 0, -1}.Normalize(), voxel.Int3{X: -1, Y: 1, Z: 1})
+	if voxel.PositionToGridInt3(exit) != (voxel.Int3{X: -2, Y: 1, Z: 0}) {
+		t.Errorf("the diagonal ray leaves the block at %v", exit)
+	}
+}
+
+func TestClientsTakeTheBlockDamageFromTheServer(t *testing.T) {
+	server := newMaterialGame(t)
+	client := &GameClient[*DummyClientUnit]{GameInstance: newMaterialGame(t)}
+	client.isClient = true
+	bricks := voxel.Int3{X: 2, Y: 1, Z: 2}
+
+	replayHit := func() {
+		// the client replays the hit of the projectile before and after the message of the server arrives
+		client.DamageBlock(bricks, 3)
+		client.OnBlockStatesChanged(BlockStatesChangedMessage{Changes: server.TakeBlockStateChanges(), Destroyed: server.TakeDestroyedBlocks()})
+		client.DamageBlock(bricks, 3)
+	}
+	server.DamageBlock(bricks, 3)
+	replayHit()
+	if server.GetBlockState(bricks) != client.GetBlockState(bricks) || !client.voxelMap.IsSolidBlockAt(bricks.X, bricks.Y, bricks.Z) {
+		t.Fatalf("the client has the state %d, the server %d", client.GetBlockState(bricks), server.GetBlockState(bricks))
+	}
+	server.DamageBlock(bricks, 3)
+	replayHit()
+	if client.voxelMap.IsSolidBlockAt(bricks.X, bricks.Y, bricks.Z) {
+		t.Error("the client kept the block the server destroyed")
+	}
+}
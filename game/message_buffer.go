@@ -15,10 +15,19 @@ type MessageBuffer struct {
 	buffer  map[uint64][]*BufferedMessage
 	userIDs []uint64
 	send    func(userID uint64, messageType, response []byte)
+
+	// spectators see everything that is sent to all players, plus what is explicitly added for them
+	spectatorBuffer  []*BufferedMessage
+	sendToSpectators func(messageType, response []byte)
 }
 
 func NewMessageBuffer(userIDs []uint64, writer func(userID uint64, messageType, response []byte)) *MessageBuffer {
-	return &MessageBuffer{make(map[uint64][]*BufferedMessage), userIDs, writer}
+	return &MessageBuffer{buffer: make(map[uint64][]*BufferedMessage), userIDs: userIDs, send: writer}
+}
+
+// SetSpectatorWriter enables the spectator channel, without a writer the messages for spectators are discarded.
+func (mb *MessageBuffer) SetSpectatorWriter(writer func(messageType, response []byte)) {
+	mb.sendToSpectators = writer
 }
 func (mb *MessageBuffer) AddMessageFor(userID uint64, response Message) {
 	messageAsJSON, _ := json.Marshal(response)
@@ -38,19 +47,27 @@ func (mb *MessageBuffer) AddMessageForAll(response Message) {
 		}
 		mb.buffer[userID] = append(mb.buffer[userID], &BufferedMessage{messageType, messageAsJSON})
 	}
+	mb.spectatorBuffer = append(mb.spectatorBuffer, &BufferedMessage{messageType, messageAsJSON})
 }
 
-func (mb *MessageBuffer) AddMessageForAllExcept(userID uint64, response Message) {
+func (mb *MessageBuffer) AddMessageForAllExcept(exceptUserID uint64, response Message) {
 	messageAsJSON, _ := json.Marshal(response)
 	messageType := []byte(response.MessageType())
-	for i := uint64(0); i < uint64(len(mb.userIDs)); i++ {
-		if i != userID {
+	for _, userID := range mb.userIDs {
+		if userID != exceptUserID {
 			if _, ok := mb.buffer[userID]; !ok {
 				mb.buffer[userID] = make([]*BufferedMessage, 0)
 			}
 			mb.buffer[userID] = append(mb.buffer[userID], &BufferedMessage{messageType, messageAsJSON})
 		}
 	}
+	mb.spectatorBuffer = append(mb.spectatorBuffer, &BufferedMessage{messageType, messageAsJSON})
+}
+
+// AddMessageForSpectators is used for events the players only receive in a filtered, per player version.
+func (mb *MessageBuffer) AddMessageForSpectators(response Message) {
+	messageAsJSON, _ := json.Marshal(response)
+	mb.spectatorBuffer = append(mb.spectatorBuffer, &BufferedMessage{[]byte(response.MessageType()), messageAsJSON})
 }
 
 func (mb *MessageBuffer) SendAll() {
@@ -60,6 +77,13 @@ func (mb *MessageBuffer) SendAll() {
 		}
 	}
 	mb.buffer = make(map[uint64][]*BufferedMessage)
+
+	if mb.sendToSpectators != nil {
+		for _, message := range mb.spectatorBuffer {
+			mb.sendToSpectators(message.MessageType, message.MessageAsJSON)
+		}
+	}
+	mb.spectatorBuffer = nil
 }
 
 func (mb *MessageBuffer) UserIDs() []uint64 {
@@ -16,6 +16,43 @@ const (
 	MissionScenarioDefend     MissionScenario = "defend"
 )
 
+type TimeControlMode string
+
+const (
+	TimeControlNone       TimeControlMode = ""
+	TimeControlPerTurn    TimeControlMode = "per_turn"
+	TimeControlChessClock TimeControlMode = "chess_clock"
+)
+
+// TimeControl limits how long a player may take, all times are in seconds.
+// With a fixed time per turn every turn gets TurnSeconds. With a chess clock every player starts with a bank of
+// BankSeconds, the time used in a turn is taken from it and IncrementSeconds are added after each turn.
+type TimeControl struct {
+	Mode             TimeControlMode
+	TurnSeconds      float64
+	BankSeconds      float64
+	IncrementSeconds float64
+	// the player is warned once when this much time is left
+	WarningSeconds float64
+}
+
+func (t TimeControl) IsEnabled() bool {
+	return t.Mode == TimeControlPerTurn || t.Mode == TimeControlChessClock
+}
+
+// IsValid rejects unknown modes and clocks that would end every turn right away.
+func (t TimeControl) IsValid() bool {
+	switch t.Mode {
+	case TimeControlNone:
+		return true
+	case TimeControlPerTurn:
+		return t.TurnSeconds > 0
+	case TimeControlChessClock:
+		return t.BankSeconds > 0 && t.IncrementSeconds >= 0
+	}
+	return false
+}
+
 type MissionDetails struct {
 	Placement             PlacementMode
 	Scenario              MissionScenario
@@ -23,6 +60,7 @@ type MissionDetails struct {
 	ObjectiveLife         int
 	damage                map[voxel.Int3]int
 	TurnLimit             int
+	TimeControl           TimeControl
 }
 
 func NewRandomDeathmatch() *MissionDetails {
@@ -91,3 +129,24 @@ func (d *MissionDetails) AllObjectivesDestroyed() bool {
 	}
 	return true
 }
+
+type ObjectiveDamage struct {
+	Position voxel.Int3
+	Damage   int
+}
+
+// GetObjectiveDamages lists the damage dealt to each objective so far.
+func (d *MissionDetails) GetObjectiveDamages() []ObjectiveDamage {
+	damages := make([]ObjectiveDamage, 0, len(d.damage))
+	for pos, damage := range d.damage {
+		damages = append(damages, ObjectiveDamage{Position: pos, Damage: damage})
+	}
+	return damages
+}
+
+func (d *MissionDetails) SetObjectiveDamage(atPos voxel.Int3, damage int) {
+	if d.damage == nil {
+		d.damage = make(map[voxel.Int3]int)
+	}
+	d.damage[atPos] = damage
+}
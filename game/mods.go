@@ -0,0 +1,304 @@
+package game
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/memmaker/battleground/engine/util"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// ModLoadOrderFile lists the mods of a mods directory that are active, the later ones override the earlier ones.
+const ModLoadOrderFile = "load_order.json"
+
+const (
+	modManifestFile = "mod.json"
+	modBlocksFile   = "blocks.json"
+	modMapsFile     = "maps.json"
+)
+
+// ModInfo identifies a mod together with the exact state of its files.
+type ModInfo struct {
+	Name    string
+	Version string
+	Hash    string
+}
+
+type modManifest struct {
+	Name        string
+	Version     string
+	Description string
+}
+
+// ModSet is the base content with all active mods layered over it.
+//
+// A mod is a directory with a mod.json manifest. Its data/ directory can hold any of factions.json, weapons.json,
+// items.json, animations.json, rules.json, ai.json and materials.json, which add to or replace the definitions of the same name, as well as
+// blocks.json (a list of additional block names) and maps.json (display name -> map file).
+// The files in its models/, maps/ and textures/skins/ directories are found before the ones of the base game.
+type ModSet struct {
+	Content     *ContentDefinitions
+	Blocks      []string
+	Maps        map[string]string
+	Mods        []ModInfo
+	Directories []string
+	Conflicts   []string // Conflicts are the things that more than one mod defines, the last one wins
+	ContentHash string   // ContentHash covers the base data and all mods, clients must have the same one
+}
+
+// contentOwners remembers who defined what last, so overrides between mods can be reported.
+type contentOwners struct {
+	owners    map[string]string
+	conflicts []string
+}
+
+func (c *contentOwners) define(kind, name, modName string) {
+	key := kind + " '" + name + "'"
+	if previous, exists := c.owners[key]; exists && previous != "" {
+		c.conflicts = append(c.conflicts, fmt.Sprintf("%s is defined by mod '%s' and mod '%s', '%s' wins", key, previous, modName, modName))
+	}
+	c.owners[key] = modName
+}
+
+// LoadModSet reads the base content from the data directory and applies the mods named in the load order file
+// of the mods directory. Without a load order file, only the base content is used.
+func LoadModSet(dataDirectory, modsDirectory string) (*ModSet, error) {
+	files, err := readContentFiles(dataDirectory, false)
+	if err != nil {
+		return nil, err
+	}
+	baseHash, err := hashDirectory(dataDirectory)
+	if err != nil {
+		return nil, err
+	}
+	owners := &contentOwners{owners: make(map[string]string)}
+	files.defineAll(owners, "")
+	modSet := &ModSet{Maps: make(map[string]string)}
+	contentHash := sha256.New()
+	fmt.Fprintf(contentHash, "base:%s\n", baseHash)
+
+	var loadOrder []string
+	if util.DoesFileExist(path.Join(modsDirectory, ModLoadOrderFile)) {
+		if err = decodeContentFile(modsDirectory, ModLoadOrderFile, &loadOrder); err != nil {
+			return nil, err
+		}
+	}
+	for _, modName := range loadOrder {
+		mod, err := loadMod(path.Join(modsDirectory, modName), files, owners, modSet)
+		if err != nil {
+			return nil, fmt.Errorf("mod '%s': %w", modName, err)
+		}
+		modSet.Mods = append(modSet.Mods, mod)
+		modSet.Directories = append(modSet.Directories, path.Join(modsDirectory, modName))
+		fmt.Fprintf(contentHash, "%s@%s:%s\n", mod.Name, mod.Version, mod.Hash)
+	}
+
+	if modSet.Content, err = files.resolve(); err != nil {
+		return nil, err
+	}
+	modSet.Conflicts = owners.conflicts
+	modSet.ContentHash = hex.EncodeToString(contentHash.Sum(nil))
+	return modSet, nil
+}
+
+func loadMod(directory string, files *contentFiles, owners *contentOwners, modSet *ModSet) (ModInfo, error) {
+	var manifest modManifest
+	if err := decodeContentFile(directory, modManifestFile, &manifest); err != nil {
+		return ModInfo{}, err
+	}
+	if manifest.Name == "" || manifest.Version == "" {
+		return ModInfo{}, fmt.Errorf("%s: Name and Version are required", modManifestFile)
+	}
+	hash, err := hashDirectory(directory)
+	if err != nil {
+		return ModInfo{}, err
+	}
+
+	dataDirectory := path.Join(directory, "data")
+	modFiles, err := readContentFiles(dataDirectory, true)
+	if err != nil {
+		return ModInfo{}, err
+	}
+	modFiles.defineAll(owners, manifest.Name)
+	files.override(modFiles)
+
+	var blocks []string
+	if err = decodeOptionalFile(dataDirectory, modBlocksFile, &blocks); err != nil {
+		return ModInfo{}, err
+	}
+	for _, block := range blocks {
+		owners.define("block", block, manifest.Name)
+		if !containsString(modSet.Blocks, block) && !containsString(GetDebugBlockNames(), block) {
+			modSet.Blocks = append(modSet.Blocks, block)
+		}
+	}
+	var maps map[string]string
+	if err = decodeOptionalFile(dataDirectory, modMapsFile, &maps); err != nil {
+		return ModInfo{}, err
+	}
+	for _, displayName := range sortedKeys(maps) {
+		owners.define("map", displayName, manifest.Name)
+		modSet.Maps[displayName] = maps[displayName]
+	}
+	for _, assetType := range []AssetType{AssetTypeMeshes, AssetTypeMaps, AssetTypeSkins} {
+		if err = defineAssetFiles(owners, directory, modAssetPaths[assetType], manifest.Name); err != nil {
+			return ModInfo{}, err
+		}
+	}
+	return ModInfo{Name: manifest.Name, Version: manifest.Version, Hash: hash}, nil
+}
+
+func decodeOptionalFile(directory, filename string, target any) error {
+	if !util.DoesFileExist(path.Join(directory, filename)) {
+		return nil
+	}
+	return decodeContentFile(directory, filename, target)
+}
+
+func defineAssetFiles(owners *contentOwners, modDirectory, subDirectory, modName string) error {
+	entries, err := os.ReadDir(path.Join(modDirectory, subDirectory))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			owners.define("file", path.Join(subDirectory, entry.Name()), modName)
+		}
+	}
+	return nil
+}
+
+func (f *contentFiles) defineAll(owners *contentOwners, modName string) {
+	for _, name := range sortedKeys(f.animationPresets) {
+		owners.define("animation preset", name, modName)
+	}
+	for _, faction := range f.factions {
+		owners.define("faction", faction.Name, modName)
+	}
+	for _, weapon := range f.weapons {
+		owners.define("weapon", weapon.UniqueName, modName)
+	}
+	for _, item := range f.items {
+		owners.define("item", item.UniqueName, modName)
+	}
+	for _, name := range sortedKeys(f.rulePresets) {
+		owners.define("rule preset", name, modName)
+	}
+	for _, name := range sortedKeys(f.ai.Difficulties) {
+		owners.define("AI difficulty", name, modName)
+	}
+	for _, name := range sortedKeys(f.ai.Personalities) {
+		owners.define("AI personality", name, modName)
+	}
+	for _, name := range sortedKeys(f.blockMaterials) {
+		owners.define("material", name, modName)
+	}
+}
+
+// override replaces the definitions with the same names as in the mod and appends the new ones.
+func (f *contentFiles) override(mod *contentFiles) {
+	if f.animationPresets == nil {
+		f.animationPresets = make(map[string]map[string]string)
+	}
+	for name, preset := range mod.animationPresets {
+		f.animationPresets[name] = preset
+	}
+	if f.rulePresets == nil {
+		f.rulePresets = make(map[string]Ruleset)
+	}
+	for name, rules := range mod.rulePresets {
+		f.rulePresets[name] = rules
+	}
+	if f.ai.Difficulties == nil {
+		f.ai.Difficulties = make(map[string]AIDifficulty)
+	}
+	for name, difficulty := range mod.ai.Difficulties {
+		f.ai.Difficulties[name] = difficulty
+	}
+	if f.ai.Personalities == nil {
+		f.ai.Personalities = make(map[string]AIPersonality)
+	}
+	for name, personality := range mod.ai.Personalities {
+		f.ai.Personalities[name] = personality
+	}
+	if f.blockMaterials == nil {
+		f.blockMaterials = make(map[string]BlockMaterial)
+	}
+	for name, material := range mod.blockMaterials {
+		f.blockMaterials[name] = material
+	}
+	for _, faction := range mod.factions {
+		if i := indexOf(f.factions, func(e factionEntry) bool { return e.Name == faction.Name }); i >= 0 {
+			f.factions[i] = faction
+		} else {
+			f.factions = append(f.factions, faction)
+		}
+	}
+	for _, weapon := range mod.weapons {
+		if i := indexOf(f.weapons, func(w WeaponDefinition) bool { return w.UniqueName == weapon.UniqueName }); i >= 0 {
+			f.weapons[i] = weapon
+		} else {
+			f.weapons = append(f.weapons, weapon)
+		}
+	}
+	for _, item := range mod.items {
+		if i := indexOf(f.items, func(d ItemDefinition) bool { return d.UniqueName == item.UniqueName }); i >= 0 {
+			f.items[i] = item
+		} else {
+			f.items = append(f.items, item)
+		}
+	}
+}
+
+func indexOf[T any](list []T, matches func(T) bool) int {
+	for i, element := range list {
+		if matches(element) {
+			return i
+		}
+	}
+	return -1
+}
+
+func containsString(list []string, value string) bool {
+	return indexOf(list, func(element string) bool { return element == value }) >= 0
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// hashDirectory hashes the names and contents of all files below the directory.
+func hashDirectory(directory string) (string, error) {
+	hash := sha256.New()
+	err := filepath.WalkDir(directory, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		relativePath, err := filepath.Rel(directory, filePath)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00", filepath.ToSlash(relativePath), len(data))
+		hash.Write(data)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,120 @@
+package game
+
+import (
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeModFile(t *testing.T, directory, filename, content string) {
+	filePath := path.Join(directory, filename)
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadModSetWithoutMods(t *testing.T) {
+	mods, err := LoadModSet("../assets/data", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mods.Mods) != 0 || len(mods.Conflicts) != 0 || mods.ContentHash == "" {
+		t.Fatalf("unexpected mod set: %+v", mods)
+	}
+}
+
+func TestLoadModSetLayersModsInLoadOrder(t *testing.T) {
+	modsDirectory := t.TempDir()
+	writeModFile(t, modsDirectory, ModLoadOrderFile, `["heavy", "heavier"]`)
+	writeModFile(t, modsDirectory, "heavy/mod.json", `{"Name": "Heavy Weapons", "Version": "1.0"}`)
+	writeModFile(t, modsDirectory, "heavy/data/weapons.json", `[
+		{"UniqueName": "M16 Rifle", "Model": "Rifle", "WeaponType": "Automatic", "AccuracyModifier": 0.75, "BulletsPerShot": 3,
+		 "EffectiveRange": 14, "MaxRange": 50, "MagazineSize": 5, "BaseDamagePerBullet": 4, "MinFOVForZoom": 40, "BaseAPForShot": 2, "BaseAPForReload": 2}
+	]`)
+	writeModFile(t, modsDirectory, "heavy/data/maps.json", `{"Desert": "desert"}`)
+	writeModFile(t, modsDirectory, "heavier/mod.json", `{"Name": "Heavier Weapons", "Version": "0.1"}`)
+	writeModFile(t, modsDirectory, "heavier/data/weapons.json", `[
+		{"UniqueName": "M16 Rifle", "Model": "Rifle", "WeaponType": "Automatic", "AccuracyModifier": 0.75, "BulletsPerShot": 3,
+		 "EffectiveRange": 14, "MaxRange": 50, "MagazineSize": 5, "BaseDamagePerBullet": 5, "MinFOVForZoom": 40, "BaseAPForShot": 2, "BaseAPForReload": 2}
+	]`)
+	writeModFile(t, modsDirectory, "heavier/data/blocks.json", `["armored_glass"]`)
+
+	mods, err := LoadModSet("../assets/data", modsDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mods.Mods) != 2 || mods.Mods[0].Name != "Heavy Weapons" || mods.Mods[1].Name != "Heavier Weapons" {
+		t.Fatalf("unexpected mods: %+v", mods.Mods)
+	}
+	if len(mods.Content.Weapons) != 5 {
+		t.Errorf("expected the rifle to be replaced, got %d weapons", len(mods.Content.Weapons))
+	}
+	for _, weapon := range mods.Content.Weapons {
+		if weapon.UniqueName == "M16 Rifle" && weapon.BaseDamagePerBullet != 5 {
+			t.Errorf("expected the last mod to win, got damage %d", weapon.BaseDamagePerBullet)
+		}
+	}
+	if len(mods.Conflicts) != 1 || !strings.Contains(mods.Conflicts[0], "weapon 'M16 Rifle'") {
+		t.Errorf("expected one conflict about the rifle, got %v", mods.Conflicts)
+	}
+	if mods.Maps["Desert"] != "desert" || len(mods.Blocks) != 1 || mods.Blocks[0] != "armored_glass" {
+		t.Errorf("unexpected maps %v or blocks %v", mods.Maps, mods.Blocks)
+	}
+
+	before := mods.ContentHash
+	writeModFile(t, modsDirectory, "heavier/data/blocks.json", `["armored_glass", "steel"]`)
+	mods, err = LoadModSet("../assets/data", modsDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mods.ContentHash == before {
+		t.Error("expected the content hash to change with the files of a mod")
+	}
+}
+
+func TestModCanReplaceOneFaction(t *testing.T) {
+	modsDirectory := t.TempDir()
+	writeModFile(t, modsDirectory, ModLoadOrderFile, `["tentacles"]`)
+	writeModFile(t, modsDirectory, "tentacles/mod.json", `{"Name": "Tentacles", "Version": "1.0"}`)
+	writeModFile(t, modsDirectory, "tentacles/data/factions.json", `[
+		{"Name": "Deep Ones", "Color": [0, 1, 0], "Units": [
+			{"Name": "Tentacle", "CoreStats": {"Health": 12, "MovementPerAP": 2, "Accuracy": 0.5, "MaxActionPoints": 4, "ThrowVelocity": 12, "BaseAPForThrow": 2},
+			 "ModelFile": "soldier", "AnimationPreset": "soldier"}
+		]}
+	]`)
+
+	mods, err := LoadModSet("../assets/data", modsDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xcom, deepOnes := mods.Content.Factions[0], mods.Content.Factions[1]
+	if len(xcom.Units) != 2 || xcom.Units[0].Name != "Soldier" || xcom.Units[0].Faction != "X-Com" {
+		t.Errorf("the other faction changed: %+v", xcom.Units)
+	}
+	if len(deepOnes.Units) != 1 || deepOnes.Units[0].Name != "Tentacle" || deepOnes.Units[0].Faction != "Deep Ones" {
+		t.Errorf("the faction was not replaced: %+v", deepOnes.Units)
+	}
+}
+
+func TestLoadModSetRejectsBrokenMods(t *testing.T) {
+	modsDirectory := t.TempDir()
+	writeModFile(t, modsDirectory, ModLoadOrderFile, `["broken"]`)
+	writeModFile(t, modsDirectory, "broken/mod.json", `{"Name": "Broken"}`)
+	_, err := LoadModSet("../assets/data", modsDirectory)
+	if err == nil || !strings.Contains(err.Error(), "mod 'broken'") {
+		t.Errorf("expected an error about the broken mod, got %v", err)
+	}
+}
+
+func TestModBlocksAreAddedAfterTheBaseBlocks(t *testing.T) {
+	library := NewBlockLibrary([]string{"bricks", "tnt"}, nil)
+	library.AddBlocks([]string{"armored_glass", "tnt"}, nil)
+	if names := library.BlockNames(); !slices.Equal(names, []string{"air", "bricks", "tnt", "armored_glass"}) {
+		t.Errorf("the library has the blocks %v", names)
+	}
+}
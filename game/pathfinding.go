@@ -8,6 +8,7 @@ import (
 type VoxelPather struct {
 	voxelMap *voxel.Map
 	unit     *UnitInstance
+	hazards  PathHazards
 }
 
 func (v *VoxelPather) GetNeighbors(node voxel.Int3) []voxel.Int3 {
@@ -19,9 +20,20 @@ func (v *VoxelPather) isWalkable(neighbor voxel.Int3) bool {
 }
 
 func (v *VoxelPather) GetCost(currentNode, neighbor voxel.Int3) float64 {
-	return float64(util.EucledianDistance3D(currentNode.ToBlockCenterVec3D(), neighbor.ToBlockCenterVec3D()))
+	cost := float64(util.EucledianDistance3D(currentNode.ToBlockCenterVec3D(), neighbor.ToBlockCenterVec3D()))
+	if v.hazards != nil {
+		cost += v.hazards.HazardCost(v.unit, neighbor)
+	}
+	return cost
 	//return int(voxel.ManhattanDistance2(currentNode, neighbor))
 }
-func NewPather(voxelMap *voxel.Map, unit *UnitInstance) *VoxelPather {
-	return &VoxelPather{voxelMap: voxelMap, unit: unit}
+
+// GetHeuristic is the straight distance, it can't be more than the steps from block center to block center.
+func (v *VoxelPather) GetHeuristic(node, goal voxel.Int3) float64 {
+	return float64(util.EucledianDistance3D(node.ToBlockCenterVec3D(), goal.ToBlockCenterVec3D()))
+}
+
+// NewPather charges the hazards on top of the distance, hazards can be nil.
+func NewPather(voxelMap *voxel.Map, unit *UnitInstance, hazards PathHazards) *VoxelPather {
+	return &VoxelPather{voxelMap: voxelMap, unit: unit, hazards: hazards}
 }
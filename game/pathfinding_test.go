@@ -0,0 +1,280 @@
+package game
+
+import (
+	"github.com/memmaker/battleground/engine/path"
+	"github.com/memmaker/battleground/engine/util"
+	"github.com/memmaker/battleground/engine/voxel"
+	"slices"
+	"testing"
+)
+
+// newConstructionMap is a floor with rows of walls that have a door every few blocks, similar to the
+// rooms of a construction map.
+func newConstructionMap(chunks int32) *voxel.Map {
+	voxelMap := voxel.NewMapWithEmptyChunks(chunks, 1, chunks, 16, 16)
+	voxelMap.SetFloorAtHeight(0, voxel.NewBlock(1))
+	size := chunks * 16
+	for z := int32(4); z < size; z += 6 {
+		for x := int32(0); x < size; x++ {
+			if (x+z)%9 == 0 {
+				continue
+			}
+			for y := int32(1); y <= 3; y++ {
+				voxelMap.SetBlock(x, y, z, voxel.NewBlock(1))
+			}
+		}
+	}
+	return voxelMap
+}
+
+func newPathingUnit(voxelMap *voxel.Map, id uint64, position voxel.Int3) *UnitInstance {
+	unit := &UnitInstance{
+		Transform:     util.NewScaledTransform("pathing unit", 1.0),
+		GameUnitID:    id,
+		Name:          "pathing unit",
+		Definition:    &UnitDefinition{},
+		ActionPoints:  4,
+		MovementPerAP: 3,
+		Health:        10,
+		CurrentStance: StanceWeaponReady,
+	}
+	unit.SetVoxelMap(voxelMap)
+	unit.SetBlockPosition(position)
+	unit.UpdateMapPosition()
+	return unit
+}
+
+func TestAStarMatchesDijkstra(t *testing.T) {
+	voxelMap := newConstructionMap(2)
+	unit := newPathingUnit(voxelMap, 1, voxel.Int3{X: 2, Y: 1, Z: 1})
+	dist, _ := path.Dijkstra[voxel.Int3](path.NewNode(unit.GetBlockPosition()), 40, NewPather(voxelMap, unit, nil))
+	for _, target := range []voxel.Int3{{X: 2, Y: 1, Z: 2}, {X: 20, Y: 1, Z: 13}, {X: 30, Y: 1, Z: 30}} {
+		want, reachable := dist[target]
+		steps, cost, found := unit.PathTo(voxelMap, nil, target, 40)
+		if found != reachable {
+			t.Fatalf("%s: A* found a path: %v, Dijkstra: %v", target.ToString(), found, reachable)
+		}
+		if !found {
+			continue
+		}
+		if diff := cost - want; diff > 0.001 || diff < -0.001 {
+			t.Errorf("%s: A* cost %f, Dijkstra cost %f", target.ToString(), cost, want)
+		}
+		if steps[len(steps)-1] != target {
+			t.Errorf("%s: path ends at %s", target.ToString(), steps[len(steps)-1].ToString())
+		}
+	}
+	if _, _, found := unit.PathTo(voxelMap, nil, voxel.Int3{X: 30, Y: 1, Z: 30}, 5); found {
+		t.Error("found a path that costs more than allowed")
+	}
+}
+
+func TestReachabilityCache(t *testing.T) {
+	voxelMap := newConstructionMap(4)
+	unit := newPathingUnit(voxelMap, 1, voxel.Int3{X: 2, Y: 1, Z: 1})
+	dist, _ := unit.Reachable(voxelMap, nil, 6)
+	cached := unit.reachable
+
+	// far away changes keep the cache
+	voxelMap.SetBlock(60, 1, 60, voxel.NewBlock(1))
+	newPathingUnit(voxelMap, 2, voxel.Int3{X: 50, Y: 1, Z: 50})
+	if unit.Reachable(voxelMap, nil, 6); unit.reachable != cached {
+		t.Fatal("a change far away dropped the cache")
+	}
+
+	// a wall next to the unit drops it
+	voxelMap.SetBlock(3, 1, 1, voxel.NewBlock(1))
+	voxelMap.SetBlock(3, 2, 1, voxel.NewBlock(1))
+	newDist, _ := unit.Reachable(voxelMap, nil, 6)
+	if unit.reachable == cached {
+		t.Fatal("the cache was kept after a wall was built next to the unit")
+	}
+	if _, ok := newDist[voxel.Int3{X: 3, Y: 1, Z: 1}]; ok {
+		t.Error("the block of the new wall is still reachable")
+	}
+	if _, ok := dist[voxel.Int3{X: 3, Y: 1, Z: 1}]; !ok {
+		t.Error("the block of the wall was not reachable before")
+	}
+
+	// and so does another unit moving close
+	cached = unit.reachable
+	newPathingUnit(voxelMap, 3, voxel.Int3{X: 4, Y: 1, Z: 2})
+	if unit.Reachable(voxelMap, nil, 6); unit.reachable == cached {
+		t.Error("the cache was kept after a unit moved next to the unit")
+	}
+}
+
+func BenchmarkReachability(b *testing.B) {
+	voxelMap := newConstructionMap(8)
+	unit := newPathingUnit(voxelMap, 1, voxel.Int3{X: 64, Y: 1, Z: 61})
+	b.Run("dijkstra", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			path.Dijkstra[voxel.Int3](path.NewNode(unit.GetBlockPosition()), 12, NewPather(voxelMap, unit, nil))
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			NewActionMove(voxelMap, unit, nil)
+			// blocks change elsewhere on the map between the queries
+			voxelMap.SetBlock(int32(i%100), 5, 120, voxel.NewBlock(1))
+		}
+	})
+}
+
+func BenchmarkLongPath(b *testing.B) {
+	voxelMap := newConstructionMap(3)
+	unit := newPathingUnit(voxelMap, 1, voxel.Int3{X: 2, Y: 1, Z: 1})
+	target := voxel.Int3{X: 44, Y: 1, Z: 44}
+	b.Run("dijkstra", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			dist, _ := path.Dijkstra[voxel.Int3](path.NewNode(unit.GetBlockPosition()), 150, NewPather(voxelMap, unit, nil))
+			if _, found := dist[target]; !found {
+				b.Fatal("no path")
+			}
+		}
+	})
+	b.Run("astar", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, _, found := unit.PathTo(voxelMap, nil, target, 150); !found {
+				b.Fatal("no path")
+			}
+		}
+	})
+}
+
+func TestGetRoute(t *testing.T) {
+	voxelMap := newConstructionMap(2)
+	unit := newPathingUnit(voxelMap, 1, voxel.Int3{X: 2, Y: 1, Z: 1})
+	move := NewActionMove(voxelMap, unit, nil)
+
+	waypoint, destination := voxel.Int3{X: 6, Y: 1, Z: 1}, voxel.Int3{X: 6, Y: 1, Z: 3}
+	route, costs, problem := move.GetRoute([]voxel.Int3{waypoint, destination})
+	if problem != "" {
+		t.Fatal(problem)
+	}
+	if !slices.Contains(route, waypoint) || route[len(route)-1] != destination {
+		t.Errorf("the route %v doesn't go through %s to %s", route, waypoint.ToString(), destination.ToString())
+	}
+	if len(costs) != len(route) || !slices.IsSorted(costs) {
+		t.Errorf("got costs %v for a route of %d steps", costs, len(route))
+	}
+	if direct := move.GetCost(destination); costs[len(costs)-1] < direct {
+		t.Errorf("the detour costs %f, less than the direct way %f", costs[len(costs)-1], direct)
+	}
+
+	// 12 moves don't get the unit there and back again
+	if _, _, problem = move.GetRoute([]voxel.Int3{{X: 12, Y: 1, Z: 1}, {X: 2, Y: 1, Z: 2}}); problem == "" {
+		t.Error("accepted a route that is too long")
+	}
+	if _, _, problem = move.GetRoute(nil); problem == "" {
+		t.Error("accepted a route without targets")
+	}
+}
+
+// fireHazards burns on some blocks, like the flames of an incendiary grenade.
+type fireHazards struct {
+	burning    map[voxel.Int3]bool
+	generation uint64
+}
+
+func (f *fireHazards) HazardCost(mover *UnitInstance, position voxel.Int3) float64 {
+	if f.burning[position] {
+		return 2
+	}
+	return 0
+}
+
+func (f *fireHazards) HazardsAt(mover *UnitInstance, position voxel.Int3) []PathHazard {
+	if f.burning[position] {
+		return []PathHazard{{Position: position, Kind: HazardFire, Cost: 2}}
+	}
+	return nil
+}
+
+func (f *fireHazards) HazardGeneration() uint64 {
+	return f.generation
+}
+
+func TestHazardAwarePaths(t *testing.T) {
+	voxelMap := newConstructionMap(2)
+	unit := newPathingUnit(voxelMap, 1, voxel.Int3{X: 2, Y: 1, Z: 1})
+	hazards := &fireHazards{burning: make(map[voxel.Int3]bool)}
+	target := voxel.Int3{X: 6, Y: 1, Z: 1}
+
+	straight, _, _ := unit.PathTo(voxelMap, hazards, target, 40)
+	move := NewActionMove(voxelMap, unit, hazards)
+	if got := move.GetHazards(straight); len(got) != 0 {
+		t.Fatalf("found hazards %v before the fire", got)
+	}
+
+	// one burning block in the way is cheaper to walk around
+	hazards.burning[voxel.Int3{X: 4, Y: 1, Z: 1}] = true
+	hazards.generation++
+	move = NewActionMove(voxelMap, unit, hazards)
+	route, costs, problem := move.GetRoute([]voxel.Int3{target})
+	if problem != "" {
+		t.Fatal(problem)
+	}
+	if slices.Contains(route, voxel.Int3{X: 4, Y: 1, Z: 1}) {
+		t.Errorf("the route %v goes through the fire", route)
+	}
+	if len(move.GetHazards(route)) != 0 {
+		t.Errorf("the route around the fire reports hazards")
+	}
+	if costs[len(costs)-1] <= 4 {
+		t.Errorf("the detour costs %f, no more than the straight way", costs[len(costs)-1])
+	}
+
+	// a wall of fire has to be crossed, and is reported
+	for z := int32(0); z <= 3; z++ {
+		hazards.burning[voxel.Int3{X: 4, Y: 1, Z: z}] = true
+	}
+	hazards.generation++
+	move = NewActionMove(voxelMap, unit, hazards)
+	route, _, problem = move.GetRoute([]voxel.Int3{target})
+	if problem != "" {
+		t.Fatal(problem)
+	}
+	if description := DescribeHazards(move.GetHazards(route)); description != "fire (1)" {
+		t.Errorf("got hazards %q on the route %v", description, route)
+	}
+}
+
+func TestFootprintPaths(t *testing.T) {
+	voxelMap := newConstructionMap(2)
+	walker := newPathingUnit(voxelMap, 1, voxel.Int3{X: 20, Y: 1, Z: 20})
+	walker.Definition.Footprint = Footprint{Width: 3, Length: 3, Height: 3}
+	walker.SetBlockPosition(voxel.Int3{X: 5, Y: 1, Z: 1})
+	walker.UpdateMapPosition()
+	if occupied := voxelMap.DebugGetOccupiedBlocks(1); len(occupied) != 27 {
+		t.Fatalf("the walker occupies %d blocks, want 27", len(occupied))
+	}
+
+	// the doors are one block wide, too narrow for the walker
+	humanoid := newPathingUnit(voxelMap, 2, voxel.Int3{X: 28, Y: 1, Z: 1})
+	nextRoom := voxel.Int3{X: 10, Y: 1, Z: 7}
+	if _, _, found := humanoid.PathTo(voxelMap, nil, nextRoom, 40); !found {
+		t.Fatal("the humanoid can't get to the next room")
+	}
+	if _, _, found := walker.PathTo(voxelMap, nil, nextRoom, 40); found {
+		t.Error("the walker squeezed through a door")
+	}
+	steps, _, found := walker.PathTo(voxelMap, nil, voxel.Int3{X: 20, Y: 1, Z: 2}, 40)
+	if !found {
+		t.Fatal("the walker can't move along its room")
+	}
+	for _, step := range steps {
+		if placeable, reason := voxelMap.IsUnitPlaceable(walker, step); !placeable {
+			t.Errorf("the walker doesn't fit at %s: %s", step.ToString(), reason)
+		}
+	}
+
+	// long units turn to fit in
+	footprint := Footprint{Width: 1, Length: 3, Height: 1}
+	if offsets := footprint.Offsets(voxel.SouthDir); !slices.Contains(offsets, voxel.Int3{Z: 1}) || slices.Contains(offsets, voxel.Int3{X: 1}) {
+		t.Errorf("facing south the footprint covers %v", offsets)
+	}
+	if offsets := footprint.Offsets(voxel.EastDir); !slices.Contains(offsets, voxel.Int3{X: 1}) || slices.Contains(offsets, voxel.Int3{Z: 1}) {
+		t.Errorf("facing east the footprint covers %v", offsets)
+	}
+}
@@ -0,0 +1,103 @@
+package game
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// ProtocolVersion is the version of the wire protocol spoken by this build.
+// Bump it whenever the framing or the meaning of an existing message changes.
+const ProtocolVersion = 2
+
+// MaxFrameSize is the upper bound for a single frame body. Anything larger is treated as a protocol error,
+// which is also what happens when a pre-framing client sends its plain text "Login\n" header.
+const MaxFrameSize = 16 * 1024 * 1024
+
+// Capability is an optional protocol feature that client and server agree on during the login handshake.
+type Capability string
+
+// CapabilityResume lets a client take its seat in a running game back after the connection dropped.
+const CapabilityResume Capability = "resume"
+
+// CapabilitySpectate lets a client watch a game it is not playing in.
+const CapabilitySpectate Capability = "spectate"
+
+// CapabilityLobby lets a client subscribe to live updates of the public game list.
+const CapabilityLobby Capability = "lobby"
+
+// CapabilityChat means the client wants to receive chat messages.
+const CapabilityChat Capability = "chat"
+
+// SupportedCapabilities lists every optional feature this build understands.
+var SupportedCapabilities = []Capability{CapabilityResume, CapabilitySpectate, CapabilityLobby, CapabilityChat}
+
+// NegotiateCapabilities returns the capabilities that were requested and are also supported by this build.
+func NegotiateCapabilities(requested []Capability) []Capability {
+	negotiated := make([]Capability, 0)
+	for _, capability := range requested {
+		if HasCapability(SupportedCapabilities, capability) {
+			negotiated = append(negotiated, capability)
+		}
+	}
+	return negotiated
+}
+
+func HasCapability(capabilities []Capability, wanted Capability) bool {
+	for _, capability := range capabilities {
+		if capability == wanted {
+			return true
+		}
+	}
+	return false
+}
+
+// our protocol is: body length (uint32) + message type length (uint16) + message type + data as json
+// all integers are big endian
+
+// EncodeFrame returns a complete frame, so it can be written to the connection with a single call.
+func EncodeFrame(messageType string, message []byte) ([]byte, error) {
+	if len(messageType) > 0xFFFF {
+		return nil, fmt.Errorf("message type too long: %d bytes", len(messageType))
+	}
+	bodyLength := 2 + len(messageType) + len(message)
+	if bodyLength > MaxFrameSize {
+		return nil, fmt.Errorf("frame too large: %d bytes", bodyLength)
+	}
+	frame := make([]byte, 4+bodyLength)
+	binary.BigEndian.PutUint32(frame[0:4], uint32(bodyLength))
+	binary.BigEndian.PutUint16(frame[4:6], uint16(len(messageType)))
+	copy(frame[6:], messageType)
+	copy(frame[6+len(messageType):], message)
+	return frame, nil
+}
+
+func WriteFrame(writer io.Writer, messageType string, message []byte) error {
+	frame, err := EncodeFrame(messageType, message)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(frame)
+	return err
+}
+
+func ReadFrame(reader io.Reader) (string, []byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return "", nil, err
+	}
+	bodyLength := binary.BigEndian.Uint32(header[:])
+	if bodyLength < 2 || bodyLength > MaxFrameSize {
+		return "", nil, fmt.Errorf("invalid frame length %d (incompatible peer?)", bodyLength)
+	}
+	body := make([]byte, bodyLength)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return "", nil, err
+	}
+	typeLength := uint32(binary.BigEndian.Uint16(body[0:2]))
+	if 2+typeLength > bodyLength {
+		return "", nil, fmt.Errorf("invalid message type length %d in frame of %d bytes", typeLength, bodyLength)
+	}
+	messageType := string(body[2 : 2+typeLength])
+	return messageType, body[2+typeLength:], nil
+}
@@ -0,0 +1,87 @@
+package game
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buffer bytes.Buffer
+	messages := []StringMessage{
+		{MessageType: "Login", Message: `{"Username":"multi\nline\nname"}`},
+		{MessageType: "EndTurn", Message: ""},
+		{MessageType: "DebugRequest", Message: `{"Command":"\r\n\u0000"}`},
+	}
+	for _, msg := range messages {
+		if err := WriteFrame(&buffer, msg.MessageType, []byte(msg.Message)); err != nil {
+			t.Fatalf("WriteFrame(%s): %v", msg.MessageType, err)
+		}
+	}
+	for _, want := range messages {
+		messageType, message, err := ReadFrame(&buffer)
+		if err != nil {
+			t.Fatalf("ReadFrame: %v", err)
+		}
+		if messageType != want.MessageType || string(message) != want.Message {
+			t.Errorf("got (%q, %q), want (%q, %q)", messageType, message, want.MessageType, want.Message)
+		}
+	}
+	if _, _, err := ReadFrame(&buffer); err != io.EOF {
+		t.Errorf("expected io.EOF after the last frame, got %v", err)
+	}
+}
+
+func TestFrameRoundTripJSON(t *testing.T) {
+	var buffer bytes.Buffer
+	sent := LoginMessage{Username: "creator\n", ProtocolVersion: ProtocolVersion, Capabilities: []Capability{"x"}}
+	asJson, _ := json.Marshal(sent)
+	if err := WriteFrame(&buffer, "Login", asJson); err != nil {
+		t.Fatal(err)
+	}
+	_, message, err := ReadFrame(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received LoginMessage
+	if err = json.Unmarshal(message, &received); err != nil {
+		t.Fatal(err)
+	}
+	if received.Username != sent.Username || received.ProtocolVersion != sent.ProtocolVersion || len(received.Capabilities) != 1 {
+		t.Errorf("got %+v, want %+v", received, sent)
+	}
+}
+
+func TestReadFrameRejectsLegacyClient(t *testing.T) {
+	legacy := bytes.NewBufferString("Login\n{\"Username\":\"old\"}\n")
+	if _, _, err := ReadFrame(legacy); err == nil {
+		t.Error("expected an error for a line based message")
+	}
+}
+
+func TestReadFrameRejectsBrokenHeaders(t *testing.T) {
+	var frame [6]byte
+	binary.BigEndian.PutUint32(frame[0:4], 2)
+	binary.BigEndian.PutUint16(frame[4:6], 10) // type longer than body
+	if _, _, err := ReadFrame(bytes.NewReader(frame[:])); err == nil {
+		t.Error("expected an error for a message type that exceeds the frame")
+	}
+
+	truncated, _ := EncodeFrame("Login", []byte("{}"))
+	if _, _, err := ReadFrame(bytes.NewReader(truncated[:len(truncated)-1])); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected io.ErrUnexpectedEOF for a truncated frame, got %v", err)
+	}
+}
+
+func TestNegotiateCapabilities(t *testing.T) {
+	original := SupportedCapabilities
+	defer func() { SupportedCapabilities = original }()
+	SupportedCapabilities = []Capability{"a", "b"}
+
+	negotiated := NegotiateCapabilities([]Capability{"b", "c"})
+	if len(negotiated) != 1 || negotiated[0] != "b" {
+		t.Errorf("got %v, want [b]", negotiated)
+	}
+}
@@ -0,0 +1,89 @@
+package game
+
+import (
+	"github.com/memmaker/battleground/engine/path"
+	"github.com/memmaker/battleground/engine/voxel"
+)
+
+// reachabilityMargin is how far outside of the reached blocks a change can still affect the paths: the
+// neighbors are looked at, and the stance of a unit depends on the blocks around it. Units with a footprint
+// add its reach.
+const reachabilityMargin = 3
+
+// reachability is the flood fill of the movement of a unit. It stays valid until something changes
+// in the columns around the blocks it reached.
+type reachability struct {
+	voxelMap   *voxel.Map
+	hazards    PathHazards
+	hazardGen  uint64
+	start      voxel.Int3
+	forward    voxel.Int3
+	stance     Stance
+	maxCost    float64
+	generation uint64
+	min, max   voxel.Int3
+	dist       map[voxel.Int3]float64
+	prev       map[voxel.Int3]voxel.Int3
+}
+
+func (r *reachability) isValidFor(u *UnitInstance, voxelMap *voxel.Map, hazards PathHazards, maxCost float64) bool {
+	return r.voxelMap == voxelMap &&
+		r.hazards == hazards &&
+		(hazards == nil || r.hazardGen == hazards.HazardGeneration()) &&
+		r.start == u.GetBlockPosition() &&
+		r.forward == u.GetForward2DCardinal() &&
+		r.stance == u.CurrentStance &&
+		r.maxCost == maxCost &&
+		!r.voxelMap.ChangedSince(r.generation, r.covers)
+}
+
+// covers ignores the height, since the ground below a block decides where a unit can stand.
+func (r *reachability) covers(position voxel.Int3) bool {
+	return position.X >= r.min.X && position.X <= r.max.X && position.Z >= r.min.Z && position.Z <= r.max.Z
+}
+
+// Reachable returns the movement costs to all blocks the unit can reach with maxCost and the previous
+// block on the path to each of them. The result is cached until the map or the hazards change and must
+// not be modified.
+func (u *UnitInstance) Reachable(voxelMap *voxel.Map, hazards PathHazards, maxCost float64) (dist map[voxel.Int3]float64, prev map[voxel.Int3]voxel.Int3) {
+	if u.reachable != nil && u.reachable.isValidFor(u, voxelMap, hazards, maxCost) {
+		u.reachable.generation = voxelMap.Generation()
+		return u.reachable.dist, u.reachable.prev
+	}
+	start := u.GetBlockPosition()
+	dist, prev = path.Dijkstra[voxel.Int3](path.NewNode(start), maxCost, NewPather(voxelMap, u, hazards))
+	r := &reachability{
+		voxelMap:   voxelMap,
+		hazards:    hazards,
+		start:      start,
+		forward:    u.GetForward2DCardinal(),
+		stance:     u.CurrentStance,
+		maxCost:    maxCost,
+		generation: voxelMap.Generation(),
+		min:        start,
+		max:        start,
+		dist:       dist,
+		prev:       prev,
+	}
+	if hazards != nil {
+		r.hazardGen = hazards.HazardGeneration()
+	}
+	for node := range dist {
+		r.min = voxel.Int3{X: min(r.min.X, node.X), Z: min(r.min.Z, node.Z)}
+		r.max = voxel.Int3{X: max(r.max.X, node.X), Z: max(r.max.Z, node.Z)}
+	}
+	margin := int32(reachabilityMargin)
+	if u.HasFootprint() {
+		margin += u.Definition.Footprint.Reach()
+	}
+	r.min = r.min.Sub(voxel.Int3{X: margin, Z: margin})
+	r.max = r.max.Add(voxel.Int3{X: margin, Z: margin})
+	u.reachable = r
+	return dist, prev
+}
+
+// PathTo finds the cheapest path of the unit to the target with A*, for targets beyond the moves of this turn.
+// The path does not contain the current position of the unit.
+func (u *UnitInstance) PathTo(voxelMap *voxel.Map, hazards PathHazards, target voxel.Int3, maxCost float64) ([]voxel.Int3, float64, bool) {
+	return path.AStar[voxel.Int3](u.GetBlockPosition(), target, maxCost, NewPather(voxelMap, u, hazards))
+}
@@ -0,0 +1,71 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ReplayVersion is increased whenever old replays can no longer be played back.
+const ReplayVersion = 1
+
+type ReplayEventKind string
+
+const (
+	ReplayEventCommand ReplayEventKind = "command" // client -> server, or a command the server gave itself
+	ReplayEventMessage ReplayEventKind = "message" // server -> client
+)
+
+type ReplayEvent struct {
+	Kind        ReplayEventKind
+	UserID      uint64
+	MessageType string
+	Message     json.RawMessage
+}
+
+// Replay is everything needed to play a game again and to check that it ends the same way.
+type Replay struct {
+	Version        int
+	GameID         string
+	MapFile        string
+	MissionDetails *MissionDetails
+	Seed           int64
+	Rules          *Ruleset
+	Owner          uint64
+	PlayerNames    map[uint64]string
+	Events         []ReplayEvent
+	FinalState     CompleteGameState
+}
+
+func (r *Replay) Commands() []ReplayEvent {
+	commands := make([]ReplayEvent, 0)
+	for _, event := range r.Events {
+		if event.Kind == ReplayEventCommand {
+			commands = append(commands, event)
+		}
+	}
+	return commands
+}
+
+func SaveReplay(filename string, replay *Replay) error {
+	asJson, err := json.Marshal(replay)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, asJson, 0644)
+}
+
+func LoadReplay(filename string) (*Replay, error) {
+	asJson, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var replay Replay
+	if err = json.Unmarshal(asJson, &replay); err != nil {
+		return nil, err
+	}
+	if replay.Version != ReplayVersion {
+		return nil, fmt.Errorf("replay version %d is not supported, expected %d", replay.Version, ReplayVersion)
+	}
+	return &replay, nil
+}
@@ -0,0 +1,274 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/memmaker/battleground/engine/util"
+	"github.com/memmaker/battleground/engine/voxel"
+	"os"
+	"sort"
+)
+
+// SaveGameVersion is increased whenever old saved games can no longer be loaded.
+const SaveGameVersion = 2
+
+// SavedUnit is the state of a UnitInstance. Definitions are stored by name and looked up again on load.
+type SavedUnit struct {
+	UnitID          uint64
+	Owner           uint64
+	Name            string
+	Faction         string
+	UnitType        string
+	Position        voxel.Int3
+	Forward         voxel.Int3
+	Stance          Stance
+	ActionPoints    float64
+	MovementPerAP   float64
+	Health          int
+	IsDead          bool
+	DamageZones     map[util.DamageZone]int
+	MovementPenalty float64
+	AimPenalty      float64
+	Weapon          string
+	AmmoCount       uint
+	WeaponPenalty   float64
+	Items           []string
+}
+
+type SavedOverwatch struct {
+	Position voxel.Int3
+	Watchers []uint64
+}
+
+// SavedGame is a running game written to disk, so it can be continued later.
+type SavedGame struct {
+	Version            int
+	GameID             string
+	MapFile            string
+	Owner              uint64
+	Public             bool
+	MissionDetails     *MissionDetails
+	Rules              *Ruleset
+	AIProfiles         map[uint64]AIProfile
+	ObjectiveDamage    []ObjectiveDamage
+	Players            []uint64
+	PlayerNames        map[uint64]string
+	PlayerFactions     map[uint64]string
+	Units              []SavedUnit
+	CurrentPlayerIndex int
+	TurnCounter        int
+	WaitForDeployment  bool
+	DeploymentRunning  bool
+	LOSMatrix          map[uint64]map[uint64]bool
+	PressureMatrix     map[uint64]map[uint64]float64
+	Overwatch          []SavedOverwatch
+	BlockEffects       []BlockEffectState
+	DestroyedBlocks    []voxel.Int3
+	BlockStates        []BlockStateChange
+	Seed               int64
+	RandomDraws        uint64
+}
+
+func saveUnit(unit *UnitInstance) SavedUnit {
+	saved := SavedUnit{
+		UnitID:          unit.UnitID(),
+		Owner:           unit.ControlledBy(),
+		Name:            unit.Name,
+		Faction:         unit.Definition.Faction,
+		UnitType:        unit.Definition.Name,
+		Position:        unit.GetBlockPosition(),
+		Forward:         unit.GetForward(),
+		Stance:          unit.CurrentStance,
+		ActionPoints:    unit.ActionPoints,
+		MovementPerAP:   unit.MovementPerAP,
+		Health:          unit.Health,
+		IsDead:          unit.IsDead,
+		DamageZones:     unit.DamageZones,
+		MovementPenalty: unit.MovementPenalty,
+		AimPenalty:      unit.AimPenalty,
+	}
+	if unit.Weapon != nil {
+		saved.Weapon = unit.Weapon.Definition.UniqueName
+		saved.AmmoCount = unit.Weapon.AmmoCount
+		saved.WeaponPenalty = unit.Weapon.AccuracyPenalty
+	}
+	for _, item := range unit.Inventory {
+		saved.Items = append(saved.Items, item.Definition.UniqueName)
+	}
+	return saved
+}
+
+// RestoreState copies the saved values onto a unit that was created from the saved definition.
+func (s SavedUnit) RestoreState(unit *UnitInstance) {
+	unit.SetUnitID(s.UnitID)
+	unit.SetControlledBy(s.Owner)
+	unit.ActionPoints = s.ActionPoints
+	unit.MovementPerAP = s.MovementPerAP
+	unit.Health = s.Health
+	unit.IsDead = s.IsDead
+	if s.DamageZones != nil {
+		unit.DamageZones = s.DamageZones
+	}
+	unit.MovementPenalty = s.MovementPenalty
+	unit.AimPenalty = s.AimPenalty
+	if unit.Weapon != nil {
+		unit.Weapon.AmmoCount = s.AmmoCount
+		unit.Weapon.AccuracyPenalty = s.WeaponPenalty
+	}
+	unit.SetBlockPosition(s.Position)
+	unit.UpdateStanceAndForward(s.Stance, s.Forward)
+}
+
+// SaveState captures the complete state of a started game. Player names are filled in by the caller.
+func (g *GameInstance) SaveState() *SavedGame {
+	saved := &SavedGame{
+		Version:            SaveGameVersion,
+		GameID:             g.id,
+		MapFile:            g.mapFile,
+		Owner:              g.owner,
+		Public:             g.public,
+		MissionDetails:     g.missionDetails,
+		Rules:              g.rules,
+		AIProfiles:         g.aiProfiles,
+		ObjectiveDamage:    g.missionDetails.GetObjectiveDamages(),
+		Players:            g.players,
+		PlayerNames:        make(map[uint64]string),
+		PlayerFactions:     g.GetPlayerFactions(),
+		CurrentPlayerIndex: g.currentPlayerIndex,
+		TurnCounter:        g.turnCounter,
+		WaitForDeployment:  g.waitForDeployment,
+		DeploymentRunning:  g.deploymentRunning,
+		LOSMatrix:          g.losMatrix,
+		PressureMatrix:     g.pressureMatrix,
+		BlockEffects:       g.GetActiveBlockEffects(),
+		DestroyedBlocks:    g.destroyedBlocks,
+		BlockStates:        g.GetChangedBlockStates(),
+		Seed:               g.GetRandom().Seed(),
+		RandomDraws:        g.GetRandom().Draws(),
+	}
+	for _, unit := range g.units {
+		saved.Units = append(saved.Units, saveUnit(unit))
+	}
+	sort.Slice(saved.Units, func(i, j int) bool { return saved.Units[i].UnitID < saved.Units[j].UnitID })
+	for position, watchers := range g.overwatch {
+		if len(watchers) == 0 {
+			continue
+		}
+		overwatch := SavedOverwatch{Position: position}
+		for _, watcher := range watchers {
+			overwatch.Watchers = append(overwatch.Watchers, watcher.UnitID())
+		}
+		saved.Overwatch = append(saved.Overwatch, overwatch)
+	}
+	return saved
+}
+
+// RestoreState puts a freshly created game back into the saved state. The units have to be created by the caller
+// from the saved definitions, ordered by their unit id, and must already carry their saved state.
+func (g *GameInstance) RestoreState(saved *SavedGame, factions map[uint64]*Faction, units []*UnitInstance) error {
+	g.owner = saved.Owner
+	g.public = saved.Public
+	if saved.Rules != nil {
+		g.SetRules(*saved.Rules)
+	}
+	g.aiProfiles = saved.AIProfiles
+	g.players = saved.Players
+	g.playerFactions = factions
+	for _, objective := range saved.ObjectiveDamage {
+		g.missionDetails.SetObjectiveDamage(objective.Position, objective.Damage)
+	}
+
+	for _, pos := range saved.DestroyedBlocks {
+		g.DestroyBlock(pos)
+	}
+	g.structureChecked = len(g.destroyedBlocks)
+	g.destroyedSent = len(g.destroyedBlocks)
+	g.ApplyBlockStates(saved.BlockStates)
+	g.TakeBlockStateChanges()
+	for _, unit := range units {
+		if _, exists := g.units[unit.UnitID()]; exists {
+			return fmt.Errorf("unit %d is saved twice", unit.UnitID())
+		}
+		g.units[unit.UnitID()] = unit
+		g.playerUnits[unit.ControlledBy()] = append(g.playerUnits[unit.ControlledBy()], unit.UnitID())
+		unit.SetVoxelMap(g.voxelMap)
+		if unit.IsActive() {
+			unit.UpdateMapPosition()
+		}
+	}
+	for _, overwatch := range saved.Overwatch {
+		for _, watcherID := range overwatch.Watchers {
+			watcher, exists := g.units[watcherID]
+			if !exists {
+				return fmt.Errorf("unit %d is watching %s, but does not exist", watcherID, overwatch.Position.ToString())
+			}
+			g.overwatch[overwatch.Position] = append(g.overwatch[overwatch.Position], watcher)
+		}
+	}
+	g.hazardsChanged()
+	g.SetActiveBlockEffects(saved.BlockEffects)
+	if saved.LOSMatrix != nil {
+		g.losMatrix = saved.LOSMatrix
+	}
+	if saved.PressureMatrix != nil {
+		g.pressureMatrix = saved.PressureMatrix
+	}
+
+	g.currentPlayerIndex = saved.CurrentPlayerIndex
+	g.turnCounter = saved.TurnCounter
+	g.waitForDeployment = saved.WaitForDeployment
+	g.deploymentRunning = saved.DeploymentRunning
+	g.random = util.RestoreRandom(saved.Seed, saved.RandomDraws)
+	g.started = true
+	return nil
+}
+
+// ReplacePlayer hands the seat of a player, together with all units, to another user.
+func (g *GameInstance) ReplacePlayer(oldID, newID uint64) {
+	for i, playerID := range g.players {
+		if playerID == oldID {
+			g.players[i] = newID
+		}
+	}
+	if faction, exists := g.playerFactions[oldID]; exists {
+		delete(g.playerFactions, oldID)
+		g.playerFactions[newID] = faction
+	}
+	if profile, isAI := g.aiProfiles[oldID]; isAI {
+		delete(g.aiProfiles, oldID)
+		g.aiProfiles[newID] = profile
+	}
+	if units, exists := g.playerUnits[oldID]; exists {
+		delete(g.playerUnits, oldID)
+		g.playerUnits[newID] = units
+		for _, unitID := range units {
+			g.units[unitID].SetControlledBy(newID)
+		}
+	}
+	if g.owner == oldID {
+		g.owner = newID
+	}
+}
+
+func SaveGameToFile(filename string, saved *SavedGame) error {
+	asJson, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, asJson, 0644)
+}
+
+func LoadSavedGame(filename string) (*SavedGame, error) {
+	asJson, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var saved SavedGame
+	if err = json.Unmarshal(asJson, &saved); err != nil {
+		return nil, err
+	}
+	if saved.Version != SaveGameVersion {
+		return nil, fmt.Errorf("saved game version %d is not supported, expected %d", saved.Version, SaveGameVersion)
+	}
+	return &saved, nil
+}
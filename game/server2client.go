@@ -1,5 +1,10 @@
 package game
 
+import (
+	"github.com/memmaker/battleground/engine/voxel"
+	"time"
+)
+
 type ActionResponse struct {
 	Success bool
 	Message string
@@ -10,9 +15,19 @@ func (a ActionResponse) MessageType() string {
 }
 
 type LoginResponse struct {
-	UserID  uint64
-	Success bool
-	Message string
+	UserID          uint64
+	Success         bool
+	Message         string
+	ProtocolVersion int
+	Capabilities    []Capability // Capabilities holds the negotiated subset of the capabilities the client asked for
+	SessionToken    string       // SessionToken can be used to log in again after the connection dropped
+	ResumedGame     string       // ResumedGame is the game the resumed session is still seated in
+	Mods            []ModInfo    // Mods are the active mods of the server, in load order
+	ContentHash     string
+}
+
+func (l LoginResponse) MessageType() string {
+	return "LoginResponse"
 }
 
 type GameStartedMessage struct {
@@ -27,17 +42,184 @@ type GameStartedMessage struct {
 	PressureMatrix   map[uint64]map[uint64]float64
 	VisibleUnits     []*UnitInstance
 	MissionDetails   *MissionDetails
+	Rules            *Ruleset
+	BlockMaterials   map[string]BlockMaterial
+	AIProfile        *AIProfile // AIProfile is only set for a seat played by the AI
+	FogImmunePlayers []uint64   // FogImmunePlayers are the AI seats that are told where all enemy units are
+}
+
+// GameResumedMessage is sent instead of GameStartedMessage to a player who reconnected to a running game.
+type GameResumedMessage struct {
+	GameStartedMessage
+	CurrentPlayer      uint64
+	YourTurn           bool
+	AwaitingDeployment bool
+	AwaitingMapLoaded  bool // AwaitingMapLoaded is set if the server never saw the MapLoaded message of the player
+	SecondsLeft        float64
+	ClockBanks         map[uint64]float64
+	BlockEffects       []BlockEffectState
+	DestroyedBlocks    []voxel.Int3
+	BlockStates        []BlockStateChange
+}
+
+func (g GameResumedMessage) MessageType() string {
+	return "GameResumed"
+}
+
+// PlayerConnectionMessage tells the other players that someone lost or regained the connection to the server.
+type PlayerConnectionMessage struct {
+	PlayerID           uint64
+	Name               string
+	Connected          bool
+	GracePeriodSeconds int
+}
+
+func (p PlayerConnectionMessage) MessageType() string {
+	return "PlayerConnection"
+}
+
+// SpectatorStateMessage is the complete, unfiltered state of a game. Spectators get one when they join and at the start of every turn.
+type SpectatorStateMessage struct {
+	GameID           string
+	MapFile          string
+	PlayerFactionMap map[uint64]string
+	PlayerNameMap    map[uint64]string
+	Units            []*UnitInstance
+	LOSMatrix        map[uint64]map[uint64]bool
+	PressureMatrix   map[uint64]map[uint64]float64
+	BlockEffects     []BlockEffectState
+	DestroyedBlocks  []voxel.Int3
+	BlockStates      []BlockStateChange
+	MissionDetails   *MissionDetails
+	Rules            *Ruleset
+	BlockMaterials   map[string]BlockMaterial
+	CurrentPlayer    uint64
+	Turn             int
+}
+
+func (s SpectatorStateMessage) MessageType() string {
+	return "SpectatorState"
+}
+
+// GameInfo describes the game the way a player would see it on start, with every unit visible and none owned.
+func (s SpectatorStateMessage) GameInfo(spectatorID uint64) GameStartedMessage {
+	return GameStartedMessage{
+		OwnID:            spectatorID,
+		GameID:           s.GameID,
+		PlayerFactionMap: s.PlayerFactionMap,
+		PlayerNameMap:    s.PlayerNameMap,
+		MapFile:          s.MapFile,
+		LOSMatrix:        s.LOSMatrix,
+		PressureMatrix:   s.PressureMatrix,
+		VisibleUnits:     s.Units,
+		MissionDetails:   s.MissionDetails,
+		Rules:            s.Rules,
+		BlockMaterials:   s.BlockMaterials,
+	}
+}
+
+// GameListEntry describes a public game that is still waiting for players.
+type GameListEntry struct {
+	GameID        string
+	Map           string
+	Scenario      MissionScenario
+	Ruleset       string
+	Players       int
+	PlayersNeeded int
+	Creator       string
+}
+
+type GameListMessage struct {
+	Games []GameListEntry
+}
+
+func (g GameListMessage) MessageType() string {
+	return "GameList"
+}
+
+// LobbyUpdateMessage is sent to subscribed clients whenever a listed game changes. Removed is set once
+// the game started or was closed.
+type LobbyUpdateMessage struct {
+	Game    GameListEntry
+	Removed bool
+}
+
+func (l LobbyUpdateMessage) MessageType() string {
+	return "LobbyUpdate"
+}
+
+type ChatLineMessage struct {
+	Channel    ChatChannel
+	SenderID   uint64
+	SenderName string
+	Text       string
+	Timestamp  time.Time
+}
+
+func (c ChatLineMessage) MessageType() string {
+	return "ChatLine"
+}
+
+// BlockStatesChangedMessage is sent to everyone after an action damaged or changed blocks. The server decides
+// the damage of blocks, the clients only apply this.
+type BlockStatesChangedMessage struct {
+	Changes   []BlockStateChange
+	Destroyed []voxel.Int3
+}
+
+func (b BlockStatesChangedMessage) MessageType() string {
+	return "BlockStatesChanged"
+}
+
+// BlocksCollapsedMessage is sent after blocks lost their connection to the ground and fell down. Every player
+// gets all the blocks, but only the units they can see, together with their new line of sight.
+type BlocksCollapsedMessage struct {
+	Blocks         []voxel.Int3
+	Units          []CollapsedUnit
+	Spotted        []*UnitInstance
+	LOSMatrix      map[uint64]map[uint64]bool
+	PressureMatrix map[uint64]map[uint64]float64
+}
+
+func (b BlocksCollapsedMessage) MessageType() string {
+	return "BlocksCollapsed"
+}
+
+// ChatHistoryMessage is the chat backlog of a game, sent to players who resumed their session.
+type ChatHistoryMessage struct {
+	Lines []ChatLineMessage
+}
+
+func (c ChatHistoryMessage) MessageType() string {
+	return "ChatHistory"
 }
 
 type NextPlayerMessage struct {
 	CurrentPlayer uint64
 	YourTurn      bool
+	// only set if the game has time controls
+	SecondsLeft      float64            // for the current turn
+	ClockBanks       map[uint64]float64 // player id -> seconds left on the chess clock
+	PreviousTimedOut bool               // the turn before ended because the time ran out
+	// RevealedUnits are all enemy units, sent at the beginning of its turn to an AI seat that sees through the fog
+	RevealedUnits []*UnitInstance
 }
 
 func (n NextPlayerMessage) MessageType() string {
 	return "NextPlayer"
 }
 
+// TurnTimeWarningMessage is sent to all players when the current turn is about to run out of time.
+type TurnTimeWarningMessage struct {
+	CurrentPlayer uint64
+	YourTurn      bool
+	SecondsLeft   float64
+}
+
+func (t TurnTimeWarningMessage) MessageType() string {
+	return "TurnTimeWarning"
+}
+
 type GameOverMessage struct {
 	WinnerID uint64
 	YouWon   bool
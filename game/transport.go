@@ -0,0 +1,171 @@
+package game
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Transport opens the connections of the clients to the server.
+type Transport interface {
+	Dial() (net.Conn, error)
+}
+
+// TCPTransport connects to a server over the network.
+type TCPTransport struct {
+	Endpoint string
+}
+
+func (t TCPTransport) Dial() (net.Conn, error) {
+	return net.Dial("tcp", t.Endpoint)
+}
+
+func (t TCPTransport) String() string {
+	return t.Endpoint
+}
+
+// memoryChunksInFlight is how many writes a memory connection buffers before the writer has to wait for the reader.
+const memoryChunksInFlight = 256
+
+// MemoryTransport connects clients to a server of the same process through channels, without any networking.
+// The server side is a net.Listener, so it can be handed to BattleServer.Serve.
+type MemoryTransport struct {
+	accepted  chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+	nextID    int
+	idLock    sync.Mutex
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{
+		accepted: make(chan net.Conn),
+		closed:   make(chan struct{}),
+	}
+}
+
+// Dial waits until the server accepts the connection.
+func (t *MemoryTransport) Dial() (net.Conn, error) {
+	t.idLock.Lock()
+	t.nextID++
+	id := t.nextID
+	t.idLock.Unlock()
+	clientSide, serverSide := newMemoryConnPair(memoryAddr(fmt.Sprintf("memory client %d", id)), memoryAddr("memory server"))
+	select {
+	case t.accepted <- serverSide:
+		return clientSide, nil
+	case <-t.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (t *MemoryTransport) Accept() (net.Conn, error) {
+	select {
+	case con := <-t.accepted:
+		return con, nil
+	case <-t.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting new connections, the open ones keep working.
+func (t *MemoryTransport) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+	return nil
+}
+
+func (t *MemoryTransport) Addr() net.Addr {
+	return memoryAddr("memory server")
+}
+
+type memoryAddr string
+
+func (a memoryAddr) Network() string { return "memory" }
+func (a memoryAddr) String() string  { return string(a) }
+
+// memoryPipe carries the writes of one side to the other one.
+type memoryPipe struct {
+	chunks    chan []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newMemoryPipe() *memoryPipe {
+	return &memoryPipe{chunks: make(chan []byte, memoryChunksInFlight), closed: make(chan struct{})}
+}
+
+func (p *memoryPipe) close() {
+	p.closeOnce.Do(func() { close(p.closed) })
+}
+
+// memoryConn is one end of a connection of the MemoryTransport. Reads return what is still buffered
+// before they report the end of the connection.
+type memoryConn struct {
+	in            *memoryPipe
+	out           *memoryPipe
+	pending       []byte
+	readLock      sync.Mutex
+	local, remote net.Addr
+}
+
+func newMemoryConnPair(clientAddr, serverAddr net.Addr) (*memoryConn, *memoryConn) {
+	toServer, toClient := newMemoryPipe(), newMemoryPipe()
+	client := &memoryConn{in: toClient, out: toServer, local: clientAddr, remote: serverAddr}
+	server := &memoryConn{in: toServer, out: toClient, local: serverAddr, remote: clientAddr}
+	return client, server
+}
+
+func (c *memoryConn) Read(b []byte) (int, error) {
+	c.readLock.Lock()
+	defer c.readLock.Unlock()
+	if len(c.pending) == 0 {
+		select {
+		case chunk := <-c.in.chunks:
+			c.pending = chunk
+		case <-c.in.closed:
+			select {
+			case chunk := <-c.in.chunks:
+				c.pending = chunk
+			default:
+				return 0, io.EOF
+			}
+		}
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *memoryConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.out.closed:
+		return 0, io.ErrClosedPipe
+	default:
+	}
+	chunk := make([]byte, len(b))
+	copy(chunk, b)
+	select {
+	case c.out.chunks <- chunk:
+		return len(b), nil
+	case <-c.out.closed:
+		return 0, io.ErrClosedPipe
+	}
+}
+
+// Close ends both directions, the other side still reads what was written before.
+func (c *memoryConn) Close() error {
+	c.in.close()
+	c.out.close()
+	return nil
+}
+
+func (c *memoryConn) LocalAddr() net.Addr  { return c.local }
+func (c *memoryConn) RemoteAddr() net.Addr { return c.remote }
+
+// the game never sets deadlines on its connections
+func (c *memoryConn) SetDeadline(t time.Time) error      { return os.ErrNoDeadline }
+func (c *memoryConn) SetReadDeadline(t time.Time) error  { return os.ErrNoDeadline }
+func (c *memoryConn) SetWriteDeadline(t time.Time) error { return os.ErrNoDeadline }
@@ -0,0 +1,74 @@
+package game
+
+import (
+	"errors"
+	"github.com/memmaker/battleground/engine/util"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestMemoryTransport(t *testing.T) {
+	transport := NewMemoryTransport()
+	accepted := make(chan net.Conn)
+	go func() {
+		con, err := transport.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- con
+	}()
+	client, err := transport.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := <-accepted
+
+	// the writer doesn't wait for the reader, like with a socket
+	for _, messageType := range []string{"Login", "CreateGame"} {
+		if err = WriteFrame(client, messageType, []byte("{}")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = WriteFrame(server, "LoginResponse", []byte(`{"Success":true}`)); err != nil {
+		t.Fatal(err)
+	}
+	messageType, message, err := ReadFrame(client)
+	if err != nil || messageType != "LoginResponse" || string(message) != `{"Success":true}` {
+		t.Fatalf("client read %s %s, %v", messageType, message, err)
+	}
+
+	// what was sent before the close still arrives
+	client.Close()
+	for _, want := range []string{"Login", "CreateGame"} {
+		if messageType, _, err = ReadFrame(server); err != nil || messageType != want {
+			t.Fatalf("server read %s, %v, want %s", messageType, err, want)
+		}
+	}
+	if _, _, err = ReadFrame(server); err != io.EOF {
+		t.Errorf("got %v after the close, want EOF", err)
+	}
+	if err = WriteFrame(server, "GameOver", []byte("{}")); err == nil {
+		t.Error("writing to a closed connection should fail")
+	}
+
+	transport.Close()
+	if _, err = transport.Dial(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("got %v from a closed transport, want net.ErrClosed", err)
+	}
+}
+
+func TestSendFailsWhileTheConnectionIsDown(t *testing.T) {
+	transport := NewMemoryTransport()
+	go transport.Accept()
+	client, err := transport.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection := &ServerConnection{connection: client, transport: transport, sessionToken: "session"}
+	client.Close()
+	if err = connection.EndTurn(); !errors.Is(err, util.ErrNotSent) {
+		t.Errorf("got %v for a command sent while the connection is down", err)
+	}
+	transport.Close()
+}
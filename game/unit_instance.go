@@ -24,13 +24,15 @@ type UnitCoreStats struct {
 // UnitDefinition is the definition of a unit type. It contains the static information about the unit type.
 // This is a basic unit archetype, from which the player chooses.
 type UnitDefinition struct {
-    ID uint64 // ID of the unit definition (= unit type)
+    Name    string // Name of the unit type, unique inside its faction
+    Faction string // Faction the unit type belongs to, set when the faction is loaded
 
     ClientRepresentation UnitClientDefinition
     CoreStats            UnitCoreStats
 
     ModelFile    string
     AnimationMap map[string]string
+    Footprint    Footprint // Footprint is only set for units bigger than a humanoid
 }
 
 // IDEA: we want a stance system, where the unit can be in different stances. A stance defines which blocks are occupied.
@@ -55,6 +57,7 @@ type UnitInstance struct {
     AimPenalty      float64
     CurrentStance   Stance
     Inventory       []*Item
+    reachable       *reachability // reachable caches the flood fill of the movement
 }
 
 func (u *UnitInstance) ControlledBy() uint64 {
@@ -158,6 +161,12 @@ func (u *UnitInstance) GetStance() HumanoidStance {
     return HumanStanceFromID(u.CurrentStance)
 }
 func (u *UnitInstance) GetOccupiedBlockOffsets(atPos voxel.Int3) []voxel.Int3 {
+    if u.HasFootprint() {
+        if atPos == u.GetBlockPosition() {
+            return u.Definition.Footprint.Offsets(u.GetForward2DCardinal())
+        }
+        return u.Definition.Footprint.Offsets(u.footprintForwardAt(atPos))
+    }
     if atPos == u.GetBlockPosition() {
         return u.GetStance().GetOccupiedBlockOffsets(u.GetForward2DCardinal())
     }
@@ -211,6 +220,10 @@ func (u *UnitInstance) UpdateMapPosition() {
 }
 
 func (u *UnitInstance) ForceMapPosition(pos voxel.Int3, direction voxel.Int3) {
+    if u.HasFootprint() {
+        u.voxelMap.SetUnitWithOffsets(u, pos, u.Definition.Footprint.Offsets(direction.ToCardinalDirection()))
+        return
+    }
     stance, forward := AutoChoseStanceAndForward(u.GetVoxelMap(), u.UnitID(), pos, direction)
     offsets := HumanStanceFromID(stance).GetOccupiedBlockOffsets(forward)
     u.voxelMap.SetUnitWithOffsets(u, pos, offsets)
@@ -224,6 +237,9 @@ func (u *UnitInstance) SetVoxelMap(voxelMap *voxel.Map) {
 }
 
 func (u *UnitInstance) GetEyeOffset() mgl32.Vec3 {
+    if u.HasFootprint() {
+        return u.Definition.Footprint.EyeOffset()
+    }
     return mgl32.Vec3{0, 1.75, 0}
 }
 
@@ -269,12 +285,16 @@ func (u *UnitInstance) GetVoxelMap() *voxel.Map {
 }
 
 func (u *UnitInstance) GetCenterOfMassPosition() mgl32.Vec3 {
+    centerOffset := mgl32.Vec3{0, 1.25, 0}
+    if u.HasFootprint() {
+        centerOffset = mgl32.Vec3{0, float32(u.Definition.Footprint.Height) / 2, 0}
+    }
     if u.model == nil || !u.model.HasBone("Torso") {
-        return u.GetPosition().Add(mgl32.Vec3{0, 1.25, 0})
+        return u.GetPosition().Add(centerOffset)
     }
     torso, exists := u.GetModel().GetNodeByName("Torso")
     if !exists {
-        return u.GetPosition().Add(mgl32.Vec3{0, 1.25, 0})
+        return u.GetPosition().Add(centerOffset)
     }
     return torso.GetWorldPosition()
 }
@@ -443,6 +463,12 @@ func (u *UnitInstance) AutoSetStanceAndForwardAndUpdateMap() {
     if !u.IsActive() {
         return
     }
+    if u.HasFootprint() {
+        // big units don't lean on walls, they turn to fit in
+        u.UpdateStanceAndForward(StanceWeaponReady, u.footprintForwardAt(u.GetBlockPosition()))
+        u.UpdateMapPosition()
+        return
+    }
     u.UpdateStanceAndForward(AutoChoseStanceAndForward(u.GetVoxelMap(), u.UnitID(), u.GetBlockPosition(), u.GetForward2DCardinal()))
     u.UpdateMapPosition()
 }
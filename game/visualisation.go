@@ -72,6 +72,12 @@ type VisualRangedAttack struct {
 	APCostForAttacker int
 	IsTurnEnding      bool
 }
+// BlockHit is a block a projectile hit or passed through, with the damage it had at that point.
+type BlockHit struct {
+	Position voxel.Int3
+	Damage   int
+}
+
 type VisualProjectile struct {
 	Origin          mgl32.Vec3
 	Destination     mgl32.Vec3
@@ -80,7 +86,7 @@ type VisualProjectile struct {
 	BodyPart        util.DamageZone
 	Damage          int
 	IsLethal        bool
-	BlocksHit       []voxel.Int3 // BlocksHit will only contain blocks that have an OnDamageReceived effect
+	BlocksHit       []BlockHit   // BlocksHit will only contain blocks that have an OnDamageReceived effect
 	VisitedBlocks   []voxel.Int3 // VisitedBlocks will contain all blocks that the projectile passed through
 	InsteadOfDamage MessageTargetedEffect
 }
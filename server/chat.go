@@ -0,0 +1,150 @@
+package server
+
+import (
+	"fmt"
+	"github.com/memmaker/battleground/engine/util"
+	"github.com/memmaker/battleground/game"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// A user may send ChatFloodLimit messages within ChatFloodWindow, everything beyond that is dropped.
+const ChatFloodLimit = 5
+const ChatFloodWindow = 5 * time.Second
+
+// ChatHistoryLength is the number of lines kept per game for players that reconnect.
+const ChatHistoryLength = 50
+
+func (b *BattleServer) Chat(userID uint64, msg game.ChatMessage) {
+	text := strings.TrimSpace(msg.Text)
+	if text == "" {
+		return
+	}
+	b.lock.Lock()
+	user, exists := b.connectedClients[userID]
+	if !exists {
+		b.lock.Unlock()
+		return
+	}
+	if utf8.RuneCountInString(text) > game.MaxChatMessageLength {
+		b.lock.Unlock()
+		b.respondWithMessage(user, game.ActionResponse{Success: false, Message: fmt.Sprintf("Chat messages are limited to %d characters", game.MaxChatMessageLength)})
+		return
+	}
+	if !user.allowChat(time.Now()) {
+		b.lock.Unlock()
+		b.respondWithMessage(user, game.ActionResponse{Success: false, Message: "You are sending messages too fast"})
+		return
+	}
+	inLobby := user.activeGame == "" && user.spectating == ""
+	runningGame, isInGame := b.runningGames[user.activeGame]
+	var lobbyRecipients []uint64
+	if inLobby {
+		lobbyRecipients = b.chatRecipients(b.lobbyUserIDs())
+	}
+	b.lock.Unlock()
+
+	line := game.ChatLineMessage{
+		Channel:    msg.Channel,
+		SenderID:   userID,
+		SenderName: user.name,
+		Text:       text,
+		Timestamp:  time.Now(),
+	}
+
+	switch msg.Channel {
+	case game.ChatChannelLobby:
+		if !inLobby {
+			b.respondWithMessage(user, game.ActionResponse{Success: false, Message: "You are not in the lobby"})
+			return
+		}
+		mb := game.NewMessageBuffer(lobbyRecipients, b.writeFromBuffer)
+		mb.AddMessageForAll(line)
+		mb.SendAll()
+	case game.ChatChannelTeam:
+		b.respondWithMessage(user, game.ActionResponse{Success: false, Message: "There is no team chat, every player is a side of their own"})
+		return
+	case game.ChatChannelAll:
+		if !isInGame || !runningGame.do(func() { b.relayGameChat(runningGame, line) }) {
+			b.respondWithMessage(user, game.ActionResponse{Success: false, Message: "You are not in a game"})
+			return
+		}
+	default:
+		b.respondWithMessage(user, game.ActionResponse{Success: false, Message: fmt.Sprintf("Unknown chat channel '%s'", msg.Channel)})
+		return
+	}
+	util.LogNetworkDebug(fmt.Sprintf("[BattleServer] Chat(%s) from %s: %s", msg.Channel, user.name, text))
+}
+
+// relayGameChat runs on the game goroutine.
+func (b *BattleServer) relayGameChat(g *gameActor, line game.ChatLineMessage) {
+	g.addToChatHistory(line)
+	b.lock.Lock()
+	recipients := b.chatRecipients(g.instance.GetPlayerIDs())
+	b.lock.Unlock()
+	mb := game.NewMessageBuffer(recipients, b.writeFromBuffer)
+	mb.SetSpectatorWriter(g.feed.publish)
+	mb.AddMessageForAll(line)
+	mb.SendAll()
+}
+
+// allowChat remembers when the user sent chat messages and tells if another one is allowed right now.
+func (u *UserConnection) allowChat(now time.Time) bool {
+	recent := u.recentChat[:0]
+	for _, sent := range u.recentChat {
+		if now.Sub(sent) < ChatFloodWindow {
+			recent = append(recent, sent)
+		}
+	}
+	u.recentChat = recent
+	if len(u.recentChat) >= ChatFloodLimit {
+		return false
+	}
+	u.recentChat = append(u.recentChat, now)
+	return true
+}
+
+// lobbyUserIDs expects the caller to hold the server lock.
+func (b *BattleServer) lobbyUserIDs() []uint64 {
+	userIDs := make([]uint64, 0)
+	for userID, user := range b.connectedClients {
+		if user.activeGame == "" && user.spectating == "" {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs
+}
+
+// chatRecipients drops everyone whose client did not ask for chat, the caller holds the server lock.
+func (b *BattleServer) chatRecipients(userIDs []uint64) []uint64 {
+	recipients := make([]uint64, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if user, exists := b.connectedClients[userID]; exists && game.HasCapability(user.capabilities, game.CapabilityChat) {
+			recipients = append(recipients, userID)
+		}
+	}
+	return recipients
+}
+
+func (g *gameActor) addToChatHistory(line game.ChatLineMessage) {
+	history := append(g.chatHistory, line)
+	if len(history) > ChatHistoryLength {
+		history = history[len(history)-ChatHistoryLength:]
+	}
+	g.chatHistory = history
+}
+
+// sendChatHistory sends the backlog of the game.
+func (b *BattleServer) sendChatHistory(g *gameActor, user *UserConnection) {
+	b.lock.Lock()
+	wantsChat := game.HasCapability(user.capabilities, game.CapabilityChat)
+	b.lock.Unlock()
+	if !wantsChat {
+		return
+	}
+	if len(g.chatHistory) > 0 {
+		b.respondWithMessage(user, game.ChatHistoryMessage{Lines: slices.Clone(g.chatHistory)})
+	}
+}
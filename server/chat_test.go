@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/memmaker/battleground/game"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChatFloodProtection(t *testing.T) {
+	user := &UserConnection{}
+	now := time.Now()
+	for i := 0; i < ChatFloodLimit; i++ {
+		if !user.allowChat(now) {
+			t.Fatalf("message %d was blocked", i)
+		}
+	}
+	if user.allowChat(now) {
+		t.Error("expected the message over the limit to be blocked")
+	}
+	if !user.allowChat(now.Add(ChatFloodWindow)) {
+		t.Error("expected chat to be allowed again after the window")
+	}
+}
+
+func sendChat(t *testing.T, server *BattleServer, text string) (string, []byte) {
+	t.Helper()
+	return sendChatOn(t, server, game.ChatChannelLobby, text)
+}
+
+func sendChatOn(t *testing.T, server *BattleServer, channel game.ChatChannel, text string) (string, []byte) {
+	t.Helper()
+	_, con := connectAndLogin(t, server, 1, game.LoginMessage{
+		Username:        "tester",
+		ProtocolVersion: game.ProtocolVersion,
+		Capabilities:    []game.Capability{game.CapabilityChat},
+	})
+	defer con.Close()
+	asJson, _ := json.Marshal(game.ChatMessage{Channel: channel, Text: text})
+	if err := game.WriteFrame(con, "Chat", asJson); err != nil {
+		t.Fatal(err)
+	}
+	messageType, message, err := game.ReadFrame(con)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return messageType, message
+}
+
+func TestLobbyChatIsRelayed(t *testing.T) {
+	messageType, message := sendChat(t, NewBattleServer(), "gl hf")
+	if messageType != "ChatLine" {
+		t.Fatalf("expected ChatLine, got %s", messageType)
+	}
+	var line game.ChatLineMessage
+	if err := json.Unmarshal(message, &line); err != nil {
+		t.Fatal(err)
+	}
+	if line.SenderName != "tester" || line.Text != "gl hf" || line.Timestamp.IsZero() {
+		t.Errorf("got %+v, want a stamped line from tester", line)
+	}
+}
+
+func TestChatRejectsLongMessages(t *testing.T) {
+	messageType, _ := sendChat(t, NewBattleServer(), strings.Repeat("a", game.MaxChatMessageLength+1))
+	if messageType != "ActionResponse" {
+		t.Errorf("expected ActionResponse, got %s", messageType)
+	}
+}
+
+func TestTeamChatIsRefused(t *testing.T) {
+	messageType, message := sendChatOn(t, NewBattleServer(), game.ChatChannelTeam, "flank left")
+	var response game.ActionResponse
+	json.Unmarshal(message, &response)
+	if messageType != "ActionResponse" || response.Success {
+		t.Errorf("expected the team message to be refused, got %s %+v", messageType, response)
+	}
+}
+
+func TestChatOfADroppedUserIsIgnored(t *testing.T) {
+	NewBattleServer().Chat(42, game.ChatMessage{Channel: game.ChatChannelLobby, Text: "still there?"})
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"fmt"
+	"github.com/memmaker/battleground/engine/util"
+	"github.com/memmaker/battleground/game"
+	"net"
+	"sync"
+)
+
+// OutboxSize is the number of messages that may wait for a client, a client falling further behind is disconnected.
+const OutboxSize = 1024
+
+type outgoingFrame struct {
+	messageType []byte
+	message     []byte
+}
+
+// clientWriter sends the frames for one connection from its own goroutine, so a slow client never blocks a game.
+type clientWriter struct {
+	raw    net.Conn
+	lock   sync.Mutex
+	closed bool
+	outbox chan outgoingFrame
+}
+
+func newClientWriter(raw net.Conn) *clientWriter {
+	w := &clientWriter{raw: raw, outbox: make(chan outgoingFrame, OutboxSize)}
+	go w.run()
+	return w
+}
+
+func (w *clientWriter) run() {
+	for frame := range w.outbox {
+		if err := game.WriteFrame(w.raw, string(frame.messageType), frame.message); err != nil {
+			util.LogNetworkError(err.Error())
+			break
+		}
+	}
+	w.raw.Close()
+}
+
+func (w *clientWriter) send(messageType, message []byte) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return
+	}
+	select {
+	case w.outbox <- outgoingFrame{messageType: messageType, message: message}:
+	default:
+		util.LogNetworkError(fmt.Sprintf("[BattleServer] Client at %s is not keeping up, closing the connection", w.raw.RemoteAddr()))
+		w.closed = true
+		close(w.outbox)
+	}
+}
+
+// close sends what is still queued and hangs up.
+func (w *clientWriter) close() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if !w.closed {
+		w.closed = true
+		close(w.outbox)
+	}
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/memmaker/battleground/engine/voxel"
+	"github.com/memmaker/battleground/game"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// emptyMap lets the tests create games without loading any assets.
+type emptyMap struct {
+	details *game.MissionDetails
+}
+
+func (m emptyMap) GetMapFilename() string                  { return "empty" }
+func (m emptyMap) GetMissionDetails() *game.MissionDetails { return m.details }
+func (m emptyMap) GetMetaData() *game.MapMetadata          { return &game.MapMetadata{} }
+func (m emptyMap) GetMap() *voxel.Map                      { return nil }
+func (m emptyMap) GetBlockLibrary() *game.BlockLibrary     { return nil }
+
+func newEmptyGame(gameID string, ownerID uint64) *game.GameInstance {
+	return newEmptyGameWithDetails(gameID, ownerID, &game.MissionDetails{})
+}
+
+func newEmptyGameWithDetails(gameID string, ownerID uint64, details *game.MissionDetails) *game.GameInstance {
+	gameInstance := game.NewGameInstanceWithMap(gameID, nil, emptyMap{details: details})
+	gameInstance.SetOwner(ownerID)
+	gameInstance.SetPublic(true)
+	gameInstance.AddPlayer(ownerID)
+	return gameInstance
+}
+
+// simulatedClient keeps reading everything the server sends, like a real client would.
+type simulatedClient struct {
+	t        *testing.T
+	con      net.Conn
+	received chan string
+}
+
+func newSimulatedClient(t *testing.T, server *BattleServer, id uint64) *simulatedClient {
+	_, con := connectAndLogin(t, server, id, game.LoginMessage{
+		Username:        fmt.Sprintf("client %d", id),
+		ProtocolVersion: game.ProtocolVersion,
+		Capabilities:    game.SupportedCapabilities,
+	})
+	client := &simulatedClient{t: t, con: con, received: make(chan string, OutboxSize)}
+	go func() {
+		defer close(client.received)
+		for {
+			messageType, _, err := game.ReadFrame(con)
+			if err != nil {
+				return
+			}
+			client.received <- messageType
+		}
+	}()
+	return client
+}
+
+func (c *simulatedClient) send(messageType string, message any) {
+	asJson, _ := json.Marshal(message)
+	if err := game.WriteFrame(c.con, messageType, asJson); err != nil {
+		c.t.Error(err)
+	}
+}
+
+func (c *simulatedClient) await(messageType string) {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case received, isOpen := <-c.received:
+			if !isOpen {
+				c.t.Errorf("connection closed while waiting for %s", messageType)
+				return
+			}
+			if received == messageType {
+				return
+			}
+		case <-timeout:
+			c.t.Errorf("timed out waiting for %s", messageType)
+			return
+		}
+	}
+}
+
+func TestManyClientsPlayConcurrently(t *testing.T) {
+	const games = 16
+	server := NewBattleServer()
+	server.SetReconnectGracePeriod(10 * time.Millisecond)
+	server.AddFaction(game.FactionDefinition{Name: "Red"})
+
+	hosts := make([]*simulatedClient, games)
+	for i := range hosts {
+		hosts[i] = newSimulatedClient(t, server, uint64(i))
+		host, _ := server.getUser(uint64(i))
+		server.addGame(fmt.Sprintf("game %d", i), newEmptyGame(fmt.Sprintf("game %d", i), uint64(i)), i%2, host)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < games; i++ {
+		gameID := fmt.Sprintf("game %d", i)
+		host := hosts[i]
+		guest := newSimulatedClient(t, server, uint64(games+i))
+		spectator := newSimulatedClient(t, server, uint64(2*games+i))
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			host.send("Chat", game.ChatMessage{Channel: game.ChatChannelAll, Text: "hello"})
+			host.send("SelectFaction", game.SelectFactionMessage{FactionName: "Red"})
+			host.await("SelectFactionResponse")
+			host.send("EndTurn", nil)
+			host.con.Close()
+		}()
+		go func() {
+			defer wg.Done()
+			guest.send("ListGames", game.ListGamesMessage{Subscribe: true})
+			guest.send("Chat", game.ChatMessage{Channel: game.ChatChannelLobby, Text: "anyone?"})
+			guest.send("JoinGame", game.JoinGameMessage{GameID: gameID})
+			guest.await("JoinGameResponse")
+			guest.send("Chat", game.ChatMessage{Channel: game.ChatChannelTeam, Text: "gl"})
+			guest.send("SelectFaction", game.SelectFactionMessage{FactionName: "Red"})
+			guest.await("SelectFactionResponse")
+			guest.con.Close()
+		}()
+		go func() {
+			defer wg.Done()
+			spectator.send("SpectateGame", game.SpectateGameMessage{GameID: gameID})
+			spectator.await("SpectateGameResponse")
+			spectator.send("ListGames", game.ListGamesMessage{})
+			spectator.await("GameList")
+			spectator.con.Close()
+		}()
+	}
+	wg.Wait()
+
+	// every game lost its players, so all of them have to be closed once the grace period is over
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		server.lock.Lock()
+		remaining := len(server.runningGames) + len(server.connectedClients)
+		server.lock.Unlock()
+		if remaining == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("expected all games and clients to be removed")
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"github.com/memmaker/battleground/game"
+	"sync"
+)
+
+// gameActor owns a game. Everything that touches the GameInstance is sent to the goroutine of the game as a
+// command, so the players of one game are handled one after another while different games run side by side.
+//
+// Commands must never call do() themselves: only connection and timer goroutines hand work to a game.
+type gameActor struct {
+	id       string
+	instance *game.GameInstance
+	commands chan func()
+	done     chan struct{}
+	stopOnce sync.Once
+
+	// owned by the game goroutine
+	ready       map[uint64]bool // player id -> has loaded the map or finished the deployment
+	feed        *spectatorFeed
+	chatHistory []game.ChatLineMessage
+	clock       *turnClock // nil without time controls
+	recorder    *replayRecorder
+	vacantSeats map[uint64]string // placeholder player id -> name, while a restored game waits for its players
+	playerNames map[uint64]string // player id -> name, recorded when the seat is taken
+	replaying   bool              // the game plays back a replay, nothing is saved
+
+	// the lobby entry is written by the game and read by the lobby, both under the server lock
+	listing game.GameListEntry
+	listed  bool
+}
+
+func newGameActor(gameID string, instance *game.GameInstance, feed *spectatorFeed) *gameActor {
+	g := &gameActor{
+		id:          gameID,
+		instance:    instance,
+		commands:    make(chan func()),
+		done:        make(chan struct{}),
+		ready:       make(map[uint64]bool),
+		feed:        feed,
+		playerNames: make(map[uint64]string),
+	}
+	if details := instance.GetMissionDetails(); details != nil && details.TimeControl.IsEnabled() {
+		g.clock = newTurnClock(details.TimeControl)
+	}
+	return g
+}
+
+func (g *gameActor) run() {
+	for {
+		select {
+		case command := <-g.commands:
+			command()
+		case <-g.done:
+			return
+		}
+	}
+}
+
+// do queues a command for the game, it returns false if the game is already over.
+func (g *gameActor) do(command func()) bool {
+	select {
+	case g.commands <- command:
+		return true
+	case <-g.done:
+		return false
+	}
+}
+
+// stop ends the game goroutine after the current command.
+func (g *gameActor) stop() {
+	g.stopOnce.Do(func() { close(g.done) })
+}
+
+func (g *gameActor) allReady() bool {
+	for _, playerID := range g.instance.GetPlayerIDs() {
+		if !g.ready[playerID] {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *gameActor) resetReady() {
+	g.ready = make(map[uint64]bool)
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"github.com/memmaker/battleground/game"
+	"sort"
+)
+
+// ListGames answers with all public games that have not started yet.
+func (b *BattleServer) ListGames(userID uint64, msg game.ListGamesMessage) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	user, exists := b.connectedClients[userID]
+	if !exists {
+		return
+	}
+	games := make([]game.GameListEntry, 0)
+	for _, runningGame := range b.runningGames {
+		if runningGame.listed {
+			games = append(games, runningGame.listing)
+		}
+	}
+	sort.Slice(games, func(i, j int) bool { return games[i].GameID < games[j].GameID })
+
+	user.inLobby = msg.Subscribe && game.HasCapability(user.capabilities, game.CapabilityLobby)
+	b.respondWithMessage(user, game.GameListMessage{Games: games})
+}
+
+func isListed(gameInstance *game.GameInstance) bool {
+	return gameInstance.IsPublic() && !gameInstance.IsStarted()
+}
+
+// lobbyEntryFor reads the game instance, so it runs on the game goroutine. The creator is filled in by the caller.
+func lobbyEntryFor(g *gameActor) game.GameListEntry {
+	gameInstance := g.instance
+	entry := game.GameListEntry{
+		GameID:        g.id,
+		Map:           gameInstance.GetMapFile(),
+		Players:       len(gameInstance.GetPlayerIDs()),
+		PlayersNeeded: gameInstance.GetPlayersNeeded(),
+	}
+	if details := gameInstance.GetMissionDetails(); details != nil {
+		entry.Scenario = details.Scenario
+	}
+	if rules := gameInstance.GetRules(); rules != nil {
+		entry.Ruleset = rules.Name
+	}
+	return entry
+}
+
+// notifyLobby updates the lobby entry of the game and tells every subscribed client about a change to a public game.
+func (b *BattleServer) notifyLobby(g *gameActor, removed bool) {
+	entry := lobbyEntryFor(g)
+	owner := g.instance.GetOwner()
+	isPublic := g.instance.IsPublic()
+	listed := !removed && isListed(g.instance)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if creator, exists := b.connectedClients[owner]; exists {
+		entry.Creator = creator.name
+	}
+	g.listing = entry
+	g.listed = listed
+	if !isPublic {
+		return
+	}
+	update := game.LobbyUpdateMessage{Game: entry, Removed: !listed}
+	for _, user := range b.connectedClients {
+		if user.inLobby {
+			b.respondWithMessage(user, update)
+		}
+	}
+}
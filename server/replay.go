@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/memmaker/battleground/engine/util"
+	"github.com/memmaker/battleground/game"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// replayRecorder collects the replay of one game. Commands are recorded by the game goroutine,
+// messages by whoever sends them, so it has its own lock. A nil recorder records nothing,
+// restored games have none because they can not be played back from the start.
+type replayRecorder struct {
+	lock   sync.Mutex
+	replay game.Replay
+}
+
+func newReplayRecorder(gameID string, gameInstance *game.GameInstance) *replayRecorder {
+	recorder := &replayRecorder{replay: game.Replay{
+		Version:     game.ReplayVersion,
+		GameID:      gameID,
+		MapFile:     gameInstance.GetMapFile(),
+		Owner:       gameInstance.GetOwner(),
+		Seed:        gameInstance.GetSeed(),
+		Rules:       gameInstance.GetRules(),
+		PlayerNames: make(map[uint64]string),
+	}}
+	if details := gameInstance.GetMissionDetails(); details != nil {
+		detailsAtStart := *details
+		recorder.replay.MissionDetails = &detailsAtStart
+	}
+	return recorder
+}
+
+func (r *replayRecorder) record(kind game.ReplayEventKind, userID uint64, messageType string, message []byte) {
+	if r == nil {
+		return
+	}
+	if !json.Valid(message) {
+		message = nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.replay.Events = append(r.replay.Events, game.ReplayEvent{
+		Kind:        kind,
+		UserID:      userID,
+		MessageType: messageType,
+		Message:     message,
+	})
+}
+
+func (r *replayRecorder) recordCommand(userID uint64, messageType string, message any) {
+	asJson, _ := json.Marshal(message)
+	r.record(game.ReplayEventCommand, userID, messageType, asJson)
+}
+
+func (r *replayRecorder) setPlayerName(userID uint64, name string) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.replay.PlayerNames[userID] = name
+}
+
+// finish returns a copy of the replay with the final state of the game.
+func (r *replayRecorder) finish(finalState game.CompleteGameState) game.Replay {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.replay.FinalState = finalState
+	replay := r.replay
+	replay.Events = append([]game.ReplayEvent(nil), r.replay.Events...)
+	return replay
+}
+
+// SetReplayDirectory enables saving a replay of every game that was started.
+func (b *BattleServer) SetReplayDirectory(directory string) {
+	b.replayDirectory = directory
+}
+
+func (b *BattleServer) saveReplay(g *gameActor) {
+	if b.replayDirectory == "" || g.recorder == nil || g.replaying || !g.instance.IsStarted() {
+		return
+	}
+	replay := g.recorder.finish(g.instance.DebugGetCompleteState())
+	if err := os.MkdirAll(b.replayDirectory, 0755); err != nil {
+		util.LogIOError(err.Error())
+		return
+	}
+	filename := path.Join(b.replayDirectory, fmt.Sprintf("%s_%s.json", time.Now().Format("2006-01-02_15-04-05"), g.id))
+	if err := game.SaveReplay(filename, &replay); err != nil {
+		util.LogIOError(err.Error())
+		return
+	}
+	util.LogGameInfo(fmt.Sprintf("[BattleServer] Replay of game '%s' saved to %s", g.id, filename))
+}
+
+// PlayReplay runs the recorded commands against a fresh game and checks that it ends in the recorded state.
+// The server needs the same maps, factions, weapons and items as the one that recorded the game.
+func (b *BattleServer) PlayReplay(replay *game.Replay) error {
+	if replay.MissionDetails == nil {
+		return fmt.Errorf("replay of game '%s' has no mission details", replay.GameID)
+	}
+	details := *replay.MissionDetails
+	gameInstance := b.newGameInstance(replay.GameID, replay.MapFile, &details)
+	return b.playReplayOn(gameInstance, replay)
+}
+
+func (b *BattleServer) playReplayOn(gameInstance *game.GameInstance, replay *game.Replay) error {
+	gameInstance.SetSeed(replay.Seed)
+	if replay.Rules != nil {
+		gameInstance.SetRules(*replay.Rules)
+	}
+	gameInstance.SetOwner(replay.Owner)
+	gameInstance.AddPlayer(replay.Owner)
+	// nobody is watching, the clock is taken from the recorded timeouts and the saves would overwrite the live ones
+	g := newGameActor(replay.GameID, gameInstance, newSpectatorFeed(0, func(uint64, []byte, []byte) {}))
+	g.clock = nil
+	g.replaying = true
+
+	players := make(map[uint64]*UserConnection)
+	playerFor := func(userID uint64) *UserConnection {
+		if _, exists := players[userID]; !exists {
+			players[userID] = &UserConnection{id: userID, name: replay.PlayerNames[userID]}
+		}
+		return players[userID]
+	}
+
+	for _, command := range replay.Commands() {
+		switch command.MessageType {
+		case "JoinGame":
+			gameInstance.AddPlayer(command.UserID)
+		case "TurnTimedOut":
+			b.endTurn(g, true)
+		case "SaveGame":
+			continue
+		default:
+			b.handleGameMessage(g, playerFor(command.UserID), command.MessageType, string(command.Message))
+		}
+	}
+
+	if equal, reason := replay.FinalState.Equals(gameInstance.DebugGetCompleteState()); !equal {
+		return fmt.Errorf("replay of game '%s' diverged: %s", replay.GameID, reason)
+	}
+	return nil
+}
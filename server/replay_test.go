@@ -0,0 +1,82 @@
+package server
+
+import (
+	"github.com/memmaker/battleground/game"
+	"os"
+	"testing"
+)
+
+func TestReplayRecordsCommandsAndMessages(t *testing.T) {
+	server := NewBattleServer()
+	_, con := connectAndLogin(t, server, 1, game.LoginMessage{Username: "tester", ProtocolVersion: game.ProtocolVersion})
+	defer con.Close()
+
+	gameInstance := newEmptyGame("recorded", 1)
+	gameInstance.Start()
+	user, _ := server.getUser(1)
+	runningGame, _ := server.addGame("recorded", gameInstance, 0, user)
+	server.forwardToGame(1, "EndTurn", "")
+	if _, _, err := game.ReadFrame(con); err != nil {
+		t.Fatal(err)
+	}
+
+	replay := runningGame.recorder.finish(game.CompleteGameState{})
+	commands := replay.Commands()
+	if len(commands) != 1 || commands[0].MessageType != "EndTurn" || commands[0].UserID != 1 {
+		t.Errorf("got commands %+v, want the end of the turn", commands)
+	}
+	if len(replay.Events) < 2 || replay.Events[1].Kind != game.ReplayEventMessage {
+		t.Errorf("got events %+v, want the answer to be recorded after the command", replay.Events)
+	}
+	if replay.PlayerNames[1] != "tester" {
+		t.Errorf("got player names %v, want the name of the creator", replay.PlayerNames)
+	}
+}
+
+func TestReplayDetectsDivergence(t *testing.T) {
+	server := NewBattleServer()
+	replay := &game.Replay{
+		Version: game.ReplayVersion,
+		GameID:  "replayed",
+		Owner:   1,
+		Events: []game.ReplayEvent{
+			{Kind: game.ReplayEventCommand, UserID: 2, MessageType: "JoinGame"},
+			{Kind: game.ReplayEventMessage, UserID: 2, MessageType: "JoinGameResponse"},
+		},
+		FinalState: game.CompleteGameState{AllUnits: map[uint64]game.CompleteUnitState{}},
+	}
+	if err := server.playReplayOn(game.NewGameInstanceWithMap("replayed", nil, emptyMap{details: &game.MissionDetails{}}), replay); err != nil {
+		t.Errorf("replay of an unchanged game failed: %v", err)
+	}
+
+	replay.FinalState.AllUnits[7] = game.CompleteUnitState{}
+	if err := server.playReplayOn(game.NewGameInstanceWithMap("replayed", nil, emptyMap{details: &game.MissionDetails{}}), replay); err == nil {
+		t.Error("expected a replay with a different final state to fail")
+	}
+}
+
+func TestReplayWithoutMissionDetailsIsRefused(t *testing.T) {
+	if err := NewBattleServer().PlayReplay(&game.Replay{Version: game.ReplayVersion, GameID: "broken"}); err == nil {
+		t.Error("expected a replay without mission details to be refused")
+	}
+}
+
+func TestReplayedGameIsNotSaved(t *testing.T) {
+	server := NewBattleServer()
+	directory := t.TempDir()
+	server.SetSaveDirectory(directory)
+	server.SetReplayDirectory(directory)
+
+	gameInstance := newEmptyGame("replayed", 1)
+	gameInstance.AddPlayer(2)
+	gameInstance.Start()
+	g := newGameActor("replayed", gameInstance, newSpectatorFeed(0, func(uint64, []byte, []byte) {}))
+	g.recorder = newReplayRecorder("replayed", gameInstance)
+	g.replaying = true
+	server.SendNextPlayer(g, false)
+	server.saveReplay(g)
+
+	if files, _ := os.ReadDir(directory); len(files) > 0 {
+		t.Errorf("the replay wrote %d files", len(files))
+	}
+}
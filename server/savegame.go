@@ -0,0 +1,242 @@
+package server
+
+import (
+	"fmt"
+	"github.com/memmaker/battleground/engine/util"
+	"github.com/memmaker/battleground/game"
+	"math"
+	"net/url"
+	"os"
+	"path"
+)
+
+// SetSaveDirectory enables saving games, every game is also saved at the start of each turn.
+func (b *BattleServer) SetSaveDirectory(directory string) {
+	b.saveDirectory = directory
+}
+
+func (b *BattleServer) savedGamePath(gameID string) string {
+	return path.Join(b.saveDirectory, url.PathEscape(gameID)+".json")
+}
+
+func (b *BattleServer) SaveGame(g *gameActor, user *UserConnection) {
+	if b.saveDirectory == "" {
+		b.respond(user, "SaveGameResponse", game.ActionResponse{Success: false, Message: "Saving games is disabled on this server"})
+		return
+	}
+	if err := b.saveGame(g); err != nil {
+		util.LogIOError(err.Error())
+		b.respond(user, "SaveGameResponse", game.ActionResponse{Success: false, Message: "The game could not be saved"})
+		return
+	}
+	b.respond(user, "SaveGameResponse", game.ActionResponse{Success: true, Message: "Game saved"})
+}
+
+func (b *BattleServer) autosave(g *gameActor) {
+	if b.saveDirectory == "" || g.replaying {
+		return
+	}
+	if err := b.saveGame(g); err != nil {
+		util.LogIOError(err.Error())
+	}
+}
+
+func (b *BattleServer) saveGame(g *gameActor) error {
+	if !g.instance.IsStarted() || len(g.vacantSeats) > 0 {
+		return fmt.Errorf("game '%s' can only be saved while it is being played", g.id)
+	}
+	saved := g.instance.SaveState()
+	for _, playerID := range saved.Players {
+		// the session of a dropped player may be gone already, so the game keeps the names itself
+		if name, ok := g.playerNames[playerID]; ok {
+			saved.PlayerNames[playerID] = name
+		}
+	}
+	if err := os.MkdirAll(b.saveDirectory, 0755); err != nil {
+		return err
+	}
+	filename := b.savedGamePath(g.id)
+	if err := game.SaveGameToFile(filename, saved); err != nil {
+		return err
+	}
+	util.LogGameInfo(fmt.Sprintf("[BattleServer] Game '%s' saved to %s", g.id, filename))
+	return nil
+}
+
+// LoadGame brings a saved game back. The user takes the seat played under the same name,
+// the other players get theirs back by joining the game.
+func (b *BattleServer) LoadGame(userID uint64, msg game.LoadGameMessage) {
+	user, _ := b.getUser(userID)
+	if b.saveDirectory == "" {
+		b.respond(user, "LoadGameResponse", game.ActionResponse{Success: false, Message: "Saving games is disabled on this server"})
+		return
+	}
+	if _, alreadyExists := b.getGame(msg.GameID); alreadyExists {
+		b.respond(user, "LoadGameResponse", game.ActionResponse{Success: false, Message: "Game is already running"})
+		return
+	}
+	saved, err := game.LoadSavedGame(b.savedGamePath(msg.GameID))
+	if err != nil {
+		util.LogIOError(err.Error())
+		b.respond(user, "LoadGameResponse", game.ActionResponse{Success: false, Message: "No saved game with that name"})
+		return
+	}
+	if !hasPlayerNamed(saved, user.name) {
+		b.respond(user, "LoadGameResponse", game.ActionResponse{Success: false, Message: "You did not play in this game"})
+		return
+	}
+	gameInstance := b.newGameInstance(saved.GameID, saved.MapFile, saved.MissionDetails)
+	vacantSeats, err := b.restoreGameOn(gameInstance, saved)
+	if err != nil {
+		util.LogGameError(fmt.Sprintf("[BattleServer] Could not restore game '%s': %s", saved.GameID, err.Error()))
+		b.respond(user, "LoadGameResponse", game.ActionResponse{Success: false, Message: "The saved game does not match the content of this server"})
+		return
+	}
+	runningGame, created := b.addRestoredGame(saved.GameID, gameInstance, vacantSeats)
+	if !created || !runningGame.do(func() { b.takeSavedSeat(runningGame, user, "LoadGameResponse") }) {
+		b.respond(user, "LoadGameResponse", game.ActionResponse{Success: false, Message: "Game is already running"})
+	}
+}
+
+func hasPlayerNamed(saved *game.SavedGame, name string) bool {
+	for _, playerName := range saved.PlayerNames {
+		if playerName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// restoreGameOn puts the saved state into a fresh game. The players are moved to placeholder seats,
+// because their old user ids may belong to somebody else by now. It returns the names of the seats.
+func (b *BattleServer) restoreGameOn(gameInstance *game.GameInstance, saved *game.SavedGame) (map[uint64]string, error) {
+	seats := make(map[uint64]uint64)
+	vacantSeats := make(map[uint64]string)
+	for i, playerID := range saved.Players {
+		seat := math.MaxUint64 - uint64(i)
+		seats[playerID] = seat
+		vacantSeats[seat] = saved.PlayerNames[playerID]
+	}
+	players := make([]uint64, len(saved.Players))
+	for i, playerID := range saved.Players {
+		players[i] = seats[playerID]
+	}
+	saved.Players = players
+	saved.Owner = seats[saved.Owner]
+	aiProfiles := make(map[uint64]game.AIProfile)
+	for playerID, profile := range saved.AIProfiles {
+		aiProfiles[seats[playerID]] = profile
+	}
+	saved.AIProfiles = aiProfiles
+
+	factions := make(map[uint64]*game.Faction)
+	for playerID, factionName := range saved.PlayerFactions {
+		faction, exists := b.availableFactions[factionName]
+		if !exists {
+			return nil, fmt.Errorf("faction '%s' does not exist", factionName)
+		}
+		factions[seats[playerID]] = faction
+	}
+
+	units := make([]*game.UnitInstance, 0, len(saved.Units))
+	for _, savedUnit := range saved.Units {
+		savedUnit.Owner = seats[savedUnit.Owner]
+		unit, err := b.restoreUnit(gameInstance, savedUnit)
+		if err != nil {
+			return nil, err
+		}
+		units = append(units, unit)
+	}
+	return vacantSeats, gameInstance.RestoreState(saved, factions, units)
+}
+
+func (b *BattleServer) restoreUnit(gameInstance *game.GameInstance, saved game.SavedUnit) (*game.UnitInstance, error) {
+	definition, exists := b.availableUnits[saved.Faction][saved.UnitType]
+	if !exists {
+		return nil, fmt.Errorf("unit type '%s' of faction '%s' does not exist", saved.UnitType, saved.Faction)
+	}
+	unit := game.NewUnitInstance(gameInstance.GetAssets(), saved.Name, definition)
+	if saved.Weapon != "" {
+		weapon, exists := b.availableWeapons[saved.Weapon]
+		if !exists {
+			return nil, fmt.Errorf("weapon '%s' does not exist", saved.Weapon)
+		}
+		unit.SetWeapon(game.NewWeapon(weapon))
+	}
+	for _, itemName := range saved.Items {
+		item, exists := b.availableItems[itemName]
+		if !exists {
+			return nil, fmt.Errorf("item '%s' does not exist", itemName)
+		}
+		unit.AddItem(game.NewItem(item))
+	}
+	saved.RestoreState(unit)
+	return unit, nil
+}
+
+// addRestoredGame registers a restored game that waits for its players to take their seats again.
+func (b *BattleServer) addRestoredGame(gameID string, gameInstance *game.GameInstance, vacantSeats map[uint64]string) (*gameActor, bool) {
+	runningGame := newGameActor(gameID, gameInstance, newSpectatorFeed(0, b.spectatorWriter(gameID)))
+	runningGame.vacantSeats = vacantSeats
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if _, alreadyExists := b.runningGames[gameID]; alreadyExists {
+		return nil, false
+	}
+	b.runningGames[gameID] = runningGame
+	go runningGame.run()
+	return runningGame, true
+}
+
+// takeSavedSeat gives the user the seat of the player with the same name. Once every seat is taken,
+// the players load the map and the game continues where it was saved.
+func (b *BattleServer) takeSavedSeat(g *gameActor, user *UserConnection, responseType string) {
+	seat, found := uint64(0), false
+	for vacantSeat, playerName := range g.vacantSeats {
+		if playerName == user.name {
+			seat, found = vacantSeat, true
+			break
+		}
+	}
+	if !found {
+		b.respond(user, responseType, game.ActionResponse{Success: false, Message: "There is no free seat for you in this game"})
+		return
+	}
+	b.lock.Lock()
+	if user.activeGame != "" {
+		b.lock.Unlock()
+		b.respond(user, responseType, game.ActionResponse{Success: false, Message: "You are already in a game"})
+		return
+	}
+	b.stopSpectating(user)
+	user.activeGame = g.id
+	user.inLobby = false
+	b.lock.Unlock()
+
+	delete(g.vacantSeats, seat)
+	g.instance.ReplacePlayer(seat, user.id)
+	g.playerNames[user.id] = user.name
+	g.ready[user.id] = false
+	b.respond(user, responseType, game.ActionResponse{Success: true, Message: "Seat taken"})
+
+	if len(g.vacantSeats) > 0 {
+		return
+	}
+	util.LogGameInfo(fmt.Sprintf("[BattleServer] Continuing saved game %s", g.id))
+	for _, playerID := range g.instance.GetPlayerIDs() {
+		if player, exists := b.getUser(playerID); exists {
+			b.respond(player, "GameStarted", b.gameStateFor(g, playerID))
+		}
+	}
+	b.publishSpectatorState(g)
+}
+
+// continueSavedGame tells everybody where the game stands, once all players have loaded the map of a restored game.
+func (b *BattleServer) continueSavedGame(g *gameActor) {
+	b.startTurnClock(g, g.instance.GetCurrentPlayerID())
+	for _, playerID := range g.instance.GetPlayerIDs() {
+		if user, exists := b.getUser(playerID); exists {
+			b.respondWithMessage(user, b.resumeSnapshot(g, user))
+		}
+	}
+}
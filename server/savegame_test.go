@@ -0,0 +1,234 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/memmaker/battleground/engine/util"
+	"github.com/memmaker/battleground/engine/voxel"
+	"github.com/memmaker/battleground/game"
+	"net"
+	"path"
+	"testing"
+)
+
+func expectMessage(t *testing.T, con net.Conn, wantedType string) []byte {
+	t.Helper()
+	messageType, message, err := game.ReadFrame(con)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messageType != wantedType {
+		t.Fatalf("got %s, want %s", messageType, wantedType)
+	}
+	return message
+}
+
+func TestSavedGameContinuesWhenPlayersRejoin(t *testing.T) {
+	server := NewBattleServer()
+	server.AddFaction(game.FactionDefinition{Name: "Red"})
+	red := server.availableFactions["Red"]
+
+	original := newEmptyGame("saved", 1)
+	original.AddPlayer(2)
+	original.SetFaction(1, red)
+	original.SetFaction(2, red)
+	original.SetAIProfile(2, game.AIProfile{Difficulty: "hard", Personality: "aggressive"})
+	original.Start()
+	original.NextPlayer()
+	saved := original.SaveState()
+	saved.PlayerNames = map[uint64]string{1: "alice", 2: "bob"}
+
+	filename := path.Join(t.TempDir(), "saved.json")
+	if err := game.SaveGameToFile(filename, saved); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := game.LoadSavedGame(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := game.NewGameInstanceWithMap("saved", nil, emptyMap{details: loaded.MissionDetails})
+	vacantSeats, err := server.restoreGameOn(restored, loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.addRestoredGame("saved", restored, vacantSeats)
+
+	// the old user ids are taken by somebody else now
+	_, bob := connectAndLogin(t, server, 1, game.LoginMessage{Username: "bob", ProtocolVersion: game.ProtocolVersion})
+	defer bob.Close()
+	_, alice := connectAndLogin(t, server, 7, game.LoginMessage{Username: "alice", ProtocolVersion: game.ProtocolVersion})
+	defer alice.Close()
+
+	joinAs := func(con net.Conn) {
+		asJson, _ := json.Marshal(game.JoinGameMessage{GameID: "saved"})
+		if err := game.WriteFrame(con, "JoinGame", asJson); err != nil {
+			t.Fatal(err)
+		}
+		var response game.ActionResponse
+		json.Unmarshal(expectMessage(t, con, "JoinGameResponse"), &response)
+		if !response.Success {
+			t.Fatalf("could not take the seat: %s", response.Message)
+		}
+	}
+	joinAs(bob)
+	joinAs(alice)
+
+	for _, con := range []net.Conn{bob, alice} {
+		expectMessage(t, con, "GameStarted")
+		if err := game.WriteFrame(con, "MapLoaded", []byte("{}")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for con, wantTurn := range map[net.Conn]bool{bob: true, alice: false} {
+		var resumed game.GameResumedMessage
+		json.Unmarshal(expectMessage(t, con, "GameResumed"), &resumed)
+		if resumed.YourTurn != wantTurn || resumed.PlayerFactionMap[resumed.OwnID] != "Red" {
+			t.Errorf("got %+v, want the turn of the second player to continue", resumed)
+		}
+	}
+	// bob took the seat of the AI with the user id of alice before the save
+	if profile := restored.GetAIProfile(1); profile == nil || profile.Difficulty != "hard" || profile.Personality != "aggressive" {
+		t.Errorf("the AI seat has the profile %v after the restore", profile)
+	}
+	if profile := restored.GetAIProfile(7); profile != nil {
+		t.Errorf("the human seat got the AI profile %v", profile)
+	}
+}
+
+func TestRestoredGameWaitsForAllSeats(t *testing.T) {
+	server := NewBattleServer()
+	_, con := connectAndLogin(t, server, 1, game.LoginMessage{Username: "alice", ProtocolVersion: game.ProtocolVersion})
+	defer con.Close()
+
+	original := newEmptyGame("saved", 1)
+	original.AddPlayer(2)
+	original.Start()
+	saved := original.SaveState()
+	saved.PlayerNames = map[uint64]string{1: "alice", 2: "bob"}
+	restored := game.NewGameInstanceWithMap("saved", nil, emptyMap{details: saved.MissionDetails})
+	vacantSeats, _ := server.restoreGameOn(restored, saved)
+	server.addRestoredGame("saved", restored, vacantSeats)
+
+	server.JoinGame(1, game.JoinGameMessage{GameID: "saved"})
+	expectMessage(t, con, "JoinGameResponse")
+	server.forwardToGame(1, "EndTurn", "")
+	var response game.ActionResponse
+	json.Unmarshal(expectMessage(t, con, "ActionResponse"), &response)
+	if response.Success {
+		t.Error("expected the game to wait for the second player")
+	}
+}
+
+func TestSavedGameKeepsTheNamesOfDroppedPlayers(t *testing.T) {
+	server := NewBattleServer()
+	server.SetSaveDirectory(t.TempDir())
+	_, alice := connectAndLogin(t, server, 1, game.LoginMessage{Username: "alice", ProtocolVersion: game.ProtocolVersion})
+	defer alice.Close()
+	_, bob := connectAndLogin(t, server, 2, game.LoginMessage{Username: "bob", ProtocolVersion: game.ProtocolVersion})
+	defer bob.Close()
+
+	gameInstance := newEmptyGame("named", 1)
+	creator, _ := server.getUser(1)
+	runningGame, _ := server.addGame("named", gameInstance, 0, creator)
+	asJson, _ := json.Marshal(game.JoinGameMessage{GameID: "named"})
+	if err := game.WriteFrame(bob, "JoinGame", asJson); err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, bob, "JoinGameResponse")
+
+	// bob dropped and their session expired before the game was saved
+	server.lock.Lock()
+	delete(server.connectedClients, 2)
+	server.lock.Unlock()
+
+	saved := make(chan error)
+	runningGame.do(func() {
+		gameInstance.Start()
+		saved <- server.saveGame(runningGame)
+	})
+	if err := <-saved; err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := game.LoadSavedGame(server.savedGamePath("named"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.PlayerNames[1] != "alice" || loaded.PlayerNames[2] != "bob" {
+		t.Errorf("got player names %v, want the names of both seats", loaded.PlayerNames)
+	}
+}
+
+// flatMap is a floor of bedrock without any block library, shots at the sky never hit a block.
+type flatMap struct {
+	emptyMap
+	voxelMap *voxel.Map
+}
+
+func (m flatMap) GetMap() *voxel.Map { return m.voxelMap }
+
+func newFlatGame() *game.GameInstance {
+	voxelMap := voxel.NewMapWithEmptyChunks(1, 1, 1, 16, 16)
+	voxelMap.SetFloorAtHeight(0, voxel.NewBlock(1))
+	return game.NewGameInstanceWithMap("shots", nil, flatMap{emptyMap: emptyMap{details: &game.MissionDetails{}}, voxelMap: voxelMap})
+}
+
+func newShooter() *game.UnitInstance {
+	shooter := &game.UnitInstance{
+		Transform:     util.NewScaledTransform("shooter", 1),
+		Definition:    &game.UnitDefinition{CoreStats: game.UnitCoreStats{Health: 10, Accuracy: 0.5, MaxActionPoints: 40}},
+		ActionPoints:  40,
+		Health:        10,
+		DamageZones:   make(map[util.DamageZone]int),
+		CurrentStance: game.StanceWeaponReady,
+		Weapon: game.NewWeapon(&game.WeaponDefinition{
+			UniqueName: "Shotgun", WeaponType: game.WeaponShotgun, AccuracyModifier: 0.5, BulletsPerShot: 6,
+			EffectiveRange: 10, MaxRange: 30, MagazineSize: 8, BaseDamagePerBullet: 2, BaseAPForShot: 1,
+		}),
+	}
+	shooter.Transform.SetBlockPosition(voxel.Int3{X: 8, Y: 1, Z: 8})
+	return shooter
+}
+
+// fireAtTheSky returns the projectiles of a free aim shot that only depend on the random numbers of the game.
+func fireAtTheSky(gameInstance *game.GameInstance, shooter *game.UnitInstance) []byte {
+	var projectiles []byte
+	messages := game.NewMessageBuffer([]uint64{1}, func(userID uint64, messageType, response []byte) {
+		projectiles = response
+	})
+	shot := NewServerActionFreeShot(gameInstance, shooter, shooter.GetEyePosition(), [][2]float32{{0, 60}})
+	shot.Execute(messages)
+	messages.SendAll()
+	return projectiles
+}
+
+func TestRestoredGameRollsTheSameShots(t *testing.T) {
+	// no seed is set, the save has to carry the one taken from the clock
+	original := newFlatGame()
+	original.SetOwner(1)
+	original.AddPlayer(1)
+	original.Start()
+	shooter := newShooter()
+	original.ClientAddUnit(1, shooter)
+	fireAtTheSky(original, shooter)
+
+	filename := path.Join(t.TempDir(), "shots.json")
+	if err := game.SaveGameToFile(filename, original.SaveState()); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := game.LoadSavedGame(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := newFlatGame()
+	restoredShooter := newShooter()
+	if err = restored.RestoreState(loaded, nil, []*game.UnitInstance{restoredShooter}); err != nil {
+		t.Fatal(err)
+	}
+
+	for shot := 1; shot <= 3; shot++ {
+		want, got := fireAtTheSky(original, shooter), fireAtTheSky(restored, restoredShooter)
+		if !bytes.Equal(want, got) {
+			t.Fatalf("shot %d after the restore went elsewhere:\n%s\n%s", shot, want, got)
+		}
+	}
+}
@@ -2,95 +2,181 @@ package server
 
 import (
 	"bufio"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/memmaker/battleground/engine/util"
 	"github.com/memmaker/battleground/game"
 	"log"
 	"net"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
+// DefaultReconnectGracePeriod is how long a dropped player keeps the seat in a running game.
+const DefaultReconnectGracePeriod = 2 * time.Minute
+
 type BattleServer struct {
-	// global state for the whole server
+	// global state for the whole server, only written during the setup
 	availableMaps     map[string]string
 	availableFactions map[string]*game.Faction
-	availableUnits    []*game.UnitDefinition
+	availableUnits    map[string]map[string]*game.UnitDefinition // faction name -> unit type name -> unit
 	availableWeapons  map[string]*game.WeaponDefinition
 	availableItems    map[string]*game.ItemDefinition
-
+	rulePresets       map[string]game.Ruleset
+	aiDifficulties    map[string]game.AIDifficulty
+	aiPersonalities   map[string]game.AIPersonality
+	aiSeesThroughFog  bool // clients can ask for any AI profile, so only trusted servers let them see through the fog
+	blockMaterials    map[string]game.BlockMaterial
+	modBlocks         []string
+	modDirectories    []string
+	activeMods        []game.ModInfo
+	contentHash       string // clients have to log in with the same hash, if set
+
+	// lock guards the maps below and the lobby state of the users, the games are guarded by their own goroutine
+	lock             sync.Mutex
 	connectedClients map[uint64]*UserConnection
 
+	// session token -> user id, for players resuming after a dropped connection
+	sessions             map[string]uint64
+	reconnectGracePeriod time.Duration
+
 	// game instances
-	runningGames map[string]*game.GameInstance
+	runningGames    map[string]*gameActor
+	replayDirectory string
+	saveDirectory   string
 }
 
-func (b *BattleServer) GenerateResponse(con net.Conn, id uint64, msgType string, message string) {
+func (b *BattleServer) GenerateResponse(id uint64, msgType string, message string) {
 	// decode msg as json
 	// check header
 	switch msgType {
-	case "Login":
-		var loginMsg game.LoginMessage
-		if FromJson(message, &loginMsg) {
-			b.Login(con, id, loginMsg)
-		}
 	case "CreateGame":
 		var createGameMsg game.CreateGameMessage
 		if FromJson(message, &createGameMsg) {
 			b.CreateGame(id, createGameMsg)
 		}
+	case "JoinGame":
+		var joinGameMsg game.JoinGameMessage
+		if FromJson(message, &joinGameMsg) {
+			b.JoinGame(id, joinGameMsg)
+		}
+	case "ListGames":
+		var listGamesMsg game.ListGamesMessage
+		if FromJson(message, &listGamesMsg) {
+			b.ListGames(id, listGamesMsg)
+		}
+	case "SpectateGame":
+		var spectateGameMsg game.SpectateGameMessage
+		if FromJson(message, &spectateGameMsg) {
+			b.SpectateGame(id, spectateGameMsg)
+		}
+	case "Chat":
+		var chatMsg game.ChatMessage
+		if FromJson(message, &chatMsg) {
+			b.Chat(id, chatMsg)
+		}
+	case "LoadGame":
+		var loadGameMsg game.LoadGameMessage
+		if FromJson(message, &loadGameMsg) {
+			b.LoadGame(id, loadGameMsg)
+		}
+	case "SelectFaction", "SelectUnits", "SelectDeployment", "UnitAction", "ThrownUnitAction", "FreeAimAction", "MapLoaded", "Reload", "DebugRequest", "EndTurn", "SaveGame":
+		b.forwardToGame(id, msgType, message)
+	}
+}
+
+// forwardToGame hands a message over to the goroutine of the game the user is playing in.
+func (b *BattleServer) forwardToGame(userID uint64, msgType string, message string) {
+	responseType := responseTypeFor(msgType)
+	user, runningGame, isInGame := b.getUserAndGame(userID, responseType)
+	if !isInGame {
+		return
+	}
+	handleMessage := func() {
+		runningGame.recorder.record(game.ReplayEventCommand, userID, msgType, []byte(message))
+		b.handleGameMessage(runningGame, user, msgType, message)
+	}
+	if !runningGame.do(handleMessage) {
+		b.respond(user, responseType, game.ActionResponse{Success: false, Message: "Game does not exist"})
+	}
+}
+
+// gameMessageResponses are the game messages that are not answered with a plain ActionResponse
+var gameMessageResponses = map[string]string{
+	"SelectFaction": "SelectFactionResponse",
+	"SelectUnits":   "SelectUnitsResponse",
+	"MapLoaded":     "MapLoadedResponse",
+	"SaveGame":      "SaveGameResponse",
+}
+
+func responseTypeFor(msgType string) string {
+	if responseType, hasOwnResponse := gameMessageResponses[msgType]; hasOwnResponse {
+		return responseType
+	}
+	return "ActionResponse"
+}
+
+func (b *BattleServer) handleGameMessage(g *gameActor, user *UserConnection, msgType string, message string) {
+	if len(g.vacantSeats) > 0 {
+		b.respond(user, responseTypeFor(msgType), game.ActionResponse{Success: false, Message: "Waiting for the other players to take their seats"})
+		return
+	}
+	switch msgType {
 	case "SelectFaction":
 		var selectFactionMsg game.SelectFactionMessage
 		if FromJson(message, &selectFactionMsg) {
-			b.SelectFaction(id, selectFactionMsg)
+			b.SelectFaction(g, user, selectFactionMsg)
 		}
 	case "SelectUnits":
 		var selectUnitsMsg game.SelectUnitsMessage
 		if FromJson(message, &selectUnitsMsg) {
-			b.SelectUnits(id, selectUnitsMsg)
+			b.SelectUnits(g, user, selectUnitsMsg)
 		}
 	case "SelectDeployment":
 		var deployMsg game.DeploymentMessage
 		if FromJson(message, &deployMsg) {
-			b.SelectDeployment(id, deployMsg)
-		}
-	case "JoinGame":
-		var joinGameMsg game.JoinGameMessage
-		if FromJson(message, &joinGameMsg) {
-			b.JoinGame(id, joinGameMsg)
+			b.SelectDeployment(g, user, deployMsg)
 		}
 	case "UnitAction":
 		var targetedUnitActionMsg game.TargetedUnitActionMessage
 		if FromJson(message, &targetedUnitActionMsg) {
-			b.UnitAction(id, targetedUnitActionMsg)
+			b.UnitAction(g, user, targetedUnitActionMsg)
 		}
 	case "ThrownUnitAction":
 		var thrownUnitAction game.ThrownUnitActionMessage
 		if FromJson(message, &thrownUnitAction) {
-			b.UnitAction(id, thrownUnitAction)
+			b.UnitAction(g, user, thrownUnitAction)
 		}
 	case "FreeAimAction":
 		var freeAimActionMsg game.FreeAimActionMessage
 		if FromJson(message, &freeAimActionMsg) {
-			b.UnitAction(id, freeAimActionMsg)
+			b.UnitAction(g, user, freeAimActionMsg)
 		}
 	case "MapLoaded":
 		var mapLoadedMsg game.MapLoadedMessage
 		if FromJson(message, &mapLoadedMsg) {
-			b.MapLoaded(id, mapLoadedMsg)
+			b.MapLoaded(g, user, mapLoadedMsg)
 		}
 	case "Reload":
 		var reloadMsg game.UnitMessage
 		if FromJson(message, &reloadMsg) {
-			b.Reload(id, reloadMsg.UnitID())
+			b.Reload(g, user, reloadMsg.UnitID())
 		}
 	case "DebugRequest":
 		var debugRequestMsg game.DebugRequest
 		if FromJson(message, &debugRequestMsg) {
-			b.DebugRequest(id, debugRequestMsg)
+			b.DebugRequest(g, user, debugRequestMsg)
 		}
 	case "EndTurn":
-		b.EndTurn(id)
+		b.EndTurn(g, user)
+	case "SaveGame":
+		b.SaveGame(g, user)
 	}
 }
 
@@ -102,21 +188,31 @@ func (b *BattleServer) AddFaction(def game.FactionDefinition) {
 	b.availableFactions[def.Name] = faction
 	for _, u := range def.Units {
 		unit := u
+		unit.Faction = def.Name
 		b.AddUnitDefinition(&unit)
 	}
 }
 
 func (b *BattleServer) AddUnitDefinition(unit *game.UnitDefinition) {
-	b.availableUnits = append(b.availableUnits, unit)
+	if b.availableUnits[unit.Faction] == nil {
+		b.availableUnits[unit.Faction] = make(map[string]*game.UnitDefinition)
+	}
+	b.availableUnits[unit.Faction][unit.Name] = unit
 }
 func (b *BattleServer) ListenTCP(endpoint string) {
-	clientID := uint64(0)
 	listener, err := net.Listen("tcp", endpoint)
 	if err != nil {
 		log.Fatalln(err)
 	}
+	b.Serve(listener)
+}
+
+// Serve accepts clients until the listener is closed. A game.MemoryTransport serves the clients
+// of the same process without networking.
+func (b *BattleServer) Serve(listener net.Listener) {
+	clientID := uint64(0)
 	defer listener.Close()
-	util.LogNetworkInfo(fmt.Sprintf("Server started on %s", endpoint))
+	util.LogNetworkInfo(fmt.Sprintf("Server started on %s", listener.Addr()))
 
 	endianess, err := util.GetSystemNativeEndianess()
 	if err != nil {
@@ -126,6 +222,9 @@ func (b *BattleServer) ListenTCP(endpoint string) {
 	}
 	for {
 		con, listenError := listener.Accept()
+		if errors.Is(listenError, net.ErrClosed) {
+			return
+		}
 		if listenError != nil {
 			log.Println(listenError)
 			continue
@@ -136,32 +235,162 @@ func (b *BattleServer) ListenTCP(endpoint string) {
 	}
 }
 
+func (b *BattleServer) SetReconnectGracePeriod(gracePeriod time.Duration) {
+	b.reconnectGracePeriod = gracePeriod
+}
+
 func (b *BattleServer) handleClientRequest(con net.Conn, id uint64) {
-	connectionDropped := func() {
-		util.LogNetworkInfo(fmt.Sprintf("[BattleServer] Client(%d) disconnected!", id))
-		delete(b.connectedClients, id)
-		con.Close()
-	}
-	defer connectionDropped()
+	out := newClientWriter(con)
+	// a resumed session takes over the user id of the dropped connection
+	userID := id
+	defer func() { b.connectionDropped(out, userID) }()
 	clientReader := bufio.NewReader(con)
 	util.LogNetworkInfo(fmt.Sprintf("[BattleServer] New client(%d) connected! Waiting for client messages.", id))
 	for {
-		messageType, err := clientReader.ReadString('\n')
+		messageType, rawMessage, err := game.ReadFrame(clientReader)
 		if err != nil {
-			util.LogNetworkError(fmt.Sprintf(err.Error()))
+			util.LogNetworkError(fmt.Sprintf("[BattleServer] Client(%d): %s", id, err.Error()))
 			return
 		}
-		message, err := clientReader.ReadString('\n')
-		if err != nil {
-			util.LogNetworkError(fmt.Sprintf(err.Error()))
-			return
-		}
-		message = strings.TrimSpace(message)
-		messageType = strings.TrimSpace(messageType)
+		message := string(rawMessage)
 		//println(fmt.Sprintf("[BattleServer] Client(%d)->Server msg(%s): %s", id, messageType, message))
 		util.LogNetworkDebug(fmt.Sprintf("\n[Server] FROM Client(%d) msg(%s):\n%s\n", id, messageType, message))
 
-		b.GenerateResponse(con, id, messageType, message)
+		if messageType == "Login" {
+			var loginMsg game.LoginMessage
+			if !FromJson(message, &loginMsg) {
+				return
+			}
+			var loggedIn bool
+			if userID, loggedIn = b.Login(out, id, loginMsg); !loggedIn {
+				return // handshake failed, the client was told why
+			}
+			continue
+		}
+
+		if !b.isConnectedAs(userID, out) {
+			util.LogNetworkError(fmt.Sprintf("[BattleServer] Client(%d) sent %s before logging in", id, messageType))
+			continue
+		}
+
+		b.GenerateResponse(userID, messageType, message)
+	}
+}
+
+func (b *BattleServer) isConnectedAs(userID uint64, out *clientWriter) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	user, isLoggedIn := b.connectedClients[userID]
+	return isLoggedIn && user.out == out
+}
+
+// connectionDropped keeps the seat of a player in a game for the grace period, if the client is able to resume.
+func (b *BattleServer) connectionDropped(out *clientWriter, userID uint64) {
+	out.close()
+	b.lock.Lock()
+	user, isLoggedIn := b.connectedClients[userID]
+	if !isLoggedIn || user.out != out {
+		b.lock.Unlock()
+		// never logged in or the session has already moved to a new connection
+		util.LogNetworkInfo(fmt.Sprintf("[BattleServer] Connection of client(%d) closed", userID))
+		return
+	}
+	runningGame, isInGame := b.runningGames[user.activeGame]
+	if user.sessionToken == "" || !isInGame {
+		b.removeUser(user)
+		b.lock.Unlock()
+		util.LogNetworkInfo(fmt.Sprintf("[BattleServer] Client(%d) disconnected!", userID))
+		return
+	}
+	util.LogNetworkInfo(fmt.Sprintf("[BattleServer] Client(%d) dropped, keeping the seat in game %s for %s", userID, user.activeGame, b.reconnectGracePeriod))
+	user.setWriter(nil)
+	user.droppedAt = time.Now()
+	droppedAt := user.droppedAt
+	b.lock.Unlock()
+
+	runningGame.do(func() { b.notifyConnectionChanged(runningGame, user, false) })
+	time.AfterFunc(b.reconnectGracePeriod, func() { b.sessionExpired(user, droppedAt) })
+}
+
+func (b *BattleServer) sessionExpired(user *UserConnection, droppedAt time.Time) {
+	b.lock.Lock()
+	if user.out != nil || user.droppedAt != droppedAt || b.connectedClients[user.id] != user {
+		b.lock.Unlock()
+		return // resumed in time, maybe dropped again since
+	}
+	util.LogNetworkInfo(fmt.Sprintf("[BattleServer] Session of client(%d) expired", user.id))
+	runningGame, isInGame := b.runningGames[user.activeGame]
+	b.removeUser(user)
+	b.lock.Unlock()
+
+	if isInGame {
+		runningGame.do(func() { b.abandonGame(runningGame, user) })
+	}
+}
+
+// abandonGame ends a game that lost one of its players. Running games are won by the first remaining player.
+func (b *BattleServer) abandonGame(g *gameActor, leaver *UserConnection) {
+	gameInstance := g.instance
+	if gameInstance.IsStarted() {
+		for _, playerID := range gameInstance.GetPlayerIDs() {
+			if playerID != leaver.id {
+				b.SendGameOver(g, playerID)
+				return
+			}
+		}
+	}
+	b.lock.Lock()
+	for _, playerID := range gameInstance.GetPlayerIDs() {
+		connectedUser, exists := b.connectedClients[playerID]
+		if !exists || connectedUser.activeGame != g.id {
+			continue
+		}
+		connectedUser.activeGame = ""
+		connectedUser.setRecorder(nil)
+		if playerID != leaver.id {
+			b.respondWithMessage(connectedUser, game.ActionResponse{Success: false, Message: fmt.Sprintf("Game closed, %s left", leaver.name)})
+		}
+	}
+	b.lock.Unlock()
+	b.notifyLobby(g, true)
+	b.removeGame(g, game.GameOverMessage{})
+}
+
+// removeGame has to be called from the game goroutine, which ends afterwards.
+func (b *BattleServer) removeGame(g *gameActor, result game.GameOverMessage) {
+	if g.clock != nil {
+		g.clock.stopTimers()
+	}
+	b.saveReplay(g)
+	b.closeSpectatorFeed(g, result)
+	b.lock.Lock()
+	delete(b.runningGames, g.id)
+	b.lock.Unlock()
+	g.stop()
+	util.LogGameInfo(fmt.Sprintf("[BattleServer] Game '%s' removed", g.id))
+}
+
+// removeUser expects the caller to hold the server lock.
+func (b *BattleServer) removeUser(user *UserConnection) {
+	b.stopSpectating(user)
+	delete(b.connectedClients, user.id)
+	if user.sessionToken != "" {
+		delete(b.sessions, user.sessionToken)
+	}
+}
+
+// notifyConnectionChanged tells the other players of the game whether the user is currently connected.
+func (b *BattleServer) notifyConnectionChanged(g *gameActor, user *UserConnection, connected bool) {
+	msg := game.PlayerConnectionMessage{
+		PlayerID:           user.id,
+		Name:               user.name,
+		Connected:          connected,
+		GracePeriodSeconds: int(b.reconnectGracePeriod.Seconds()),
+	}
+	for _, playerID := range g.instance.GetPlayerIDs() {
+		if playerID != user.id {
+			b.respondTo(playerID, msg)
+		}
 	}
 }
 
@@ -174,14 +403,42 @@ func FromJson(message string, msg interface{}) bool {
 	return true
 }
 
+// UserConnection is guarded by the server lock, apart from id and name, which never change.
 type UserConnection struct {
-	raw        net.Conn
-	id         uint64
-	name       string
-	activeGame string
-	isReady    bool
+	// out is nil while a dropped client may still resume, out and recorder are written with both locks held
+	writerLock   sync.Mutex
+	out          *clientWriter
+	recorder     *replayRecorder // of the game the user is playing in
+	id           uint64
+	name         string
+	activeGame   string
+	capabilities []game.Capability
+	sessionToken string
+	droppedAt    time.Time
+	spectating   string
+	inLobby      bool
+	recentChat   []time.Time
+}
+
+func (u *UserConnection) setWriter(out *clientWriter) {
+	u.writerLock.Lock()
+	defer u.writerLock.Unlock()
+	u.out = out
+}
+
+func (u *UserConnection) setRecorder(recorder *replayRecorder) {
+	u.writerLock.Lock()
+	defer u.writerLock.Unlock()
+	u.recorder = recorder
 }
 
+func (u *UserConnection) writer() (*clientWriter, *replayRecorder) {
+	u.writerLock.Lock()
+	defer u.writerLock.Unlock()
+	return u.out, u.recorder
+}
+
+// respond never blocks, so it is fine to call it while holding the server lock.
 func (b *BattleServer) respond(connection *UserConnection, messageType string, response any) {
 	asJson, _ := json.Marshal(response)
 	b.writeToClient(connection, []byte(messageType), asJson)
@@ -190,194 +447,426 @@ func (b *BattleServer) respondWithMessage(connection *UserConnection, response g
 	b.respond(connection, response.MessageType(), response)
 }
 
+// respondTo looks the user up, so it must not be called while holding the server lock.
+func (b *BattleServer) respondTo(userID uint64, response game.Message) {
+	asJson, _ := json.Marshal(response)
+	b.writeFromBuffer(userID, []byte(response.MessageType()), asJson)
+}
+
+func (b *BattleServer) getUser(userID uint64) (*UserConnection, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	user, exists := b.connectedClients[userID]
+	return user, exists
+}
+
 func (b *BattleServer) writeFromBuffer(userID uint64, msgType, msg []byte) {
-	connection := b.connectedClients[userID]
-	if connection == nil {
+	connection, exists := b.getUser(userID)
+	if !exists {
 		return
 	}
 	b.writeToClient(connection, msgType, msg)
 }
 func (b *BattleServer) writeToClient(connection *UserConnection, messageType, response []byte) {
-	util.LogNetworkDebug(fmt.Sprintf("\n[Server] TO Client(%d) msg(%s):\n%v\n", connection.id, string(messageType), string(response)))
-	_, err := connection.raw.Write(append(messageType, '\n'))
-	if err != nil {
-		util.LogNetworkError(fmt.Sprintf(err.Error()))
-		return
+	out, recorder := connection.writer()
+	if recorder != nil {
+		recorder.record(game.ReplayEventMessage, connection.id, string(messageType), response)
 	}
-	_, err = connection.raw.Write(append(response, '\n'))
-	if err != nil {
-		util.LogNetworkError(fmt.Sprintf(err.Error()))
-		return
+	if out == nil {
+		return // the client gets a complete snapshot when it resumes
 	}
+	util.LogNetworkDebug(fmt.Sprintf("\n[Server] TO Client(%d) msg(%s):\n%v\n", connection.id, string(messageType), string(response)))
+	out.send(messageType, response)
 }
-func (b *BattleServer) Login(con net.Conn, userID uint64, msg game.LoginMessage) {
-	userConnection := &UserConnection{raw: con, id: userID, name: msg.Username}
+
+// Login returns the user id the connection acts as from now on, which differs from the connection id for resumed sessions.
+func (b *BattleServer) Login(out *clientWriter, userID uint64, msg game.LoginMessage) (uint64, bool) {
+	userConnection := &UserConnection{out: out, id: userID, name: msg.Username}
+	if msg.ProtocolVersion != game.ProtocolVersion {
+		util.LogNetworkError(fmt.Sprintf("[BattleServer] Client(%d) speaks protocol version %d, rejecting", userID, msg.ProtocolVersion))
+		b.respondWithMessage(userConnection, game.LoginResponse{
+			UserID:          userID,
+			Success:         false,
+			Message:         fmt.Sprintf("Incompatible protocol version %d, server requires %d", msg.ProtocolVersion, game.ProtocolVersion),
+			ProtocolVersion: game.ProtocolVersion,
+		})
+		return userID, false
+	}
+	if b.contentHash != "" && msg.ContentHash != b.contentHash {
+		util.LogNetworkError(fmt.Sprintf("[BattleServer] Client(%d) has different game content, rejecting", userID))
+		b.respondWithMessage(userConnection, game.LoginResponse{
+			UserID:          userID,
+			Success:         false,
+			Message:         "Your game content does not match the server, it runs " + describeMods(b.activeMods),
+			ProtocolVersion: game.ProtocolVersion,
+			Mods:            b.activeMods,
+			ContentHash:     b.contentHash,
+		})
+		return userID, false
+	}
+	userConnection.capabilities = game.NegotiateCapabilities(msg.Capabilities)
+	if msg.SessionToken != "" {
+		return b.resumeSession(userConnection, msg.SessionToken)
+	}
+	if game.HasCapability(userConnection.capabilities, game.CapabilityResume) {
+		userConnection.sessionToken = newSessionToken()
+	}
+	// answer before anybody else can find the user and send something
+	b.respondWithMessage(userConnection, game.LoginResponse{
+		UserID:          userID,
+		Success:         true,
+		Message:         "Welcome to BattleGrounds",
+		ProtocolVersion: game.ProtocolVersion,
+		Capabilities:    userConnection.capabilities,
+		SessionToken:    userConnection.sessionToken,
+		Mods:            b.activeMods,
+		ContentHash:     b.contentHash,
+	})
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if userConnection.sessionToken != "" {
+		b.sessions[userConnection.sessionToken] = userID
+	}
 	b.connectedClients[userID] = userConnection
-	b.respond(userConnection, "LoginResponse", game.ActionResponse{Success: true, Message: "Welcome to BattleGrounds"})
+	return userID, true
 }
 
-func (b *BattleServer) SelectFaction(userID uint64, msg game.SelectFactionMessage) {
-	user := b.connectedClients[userID]
-	gameID := user.activeGame
-	if gameID == "" {
-		b.respond(user, "SelectFactionResponse", game.ActionResponse{Success: false, Message: "You are not in a game"})
-		return
+// resumeSession moves a known session over to the new connection and sends the player a snapshot of the game.
+func (b *BattleServer) resumeSession(newConnection *UserConnection, sessionToken string) (uint64, bool) {
+	b.lock.Lock()
+	userID, known := b.sessions[sessionToken]
+	user, isLoggedIn := b.connectedClients[userID]
+	if !known || !isLoggedIn {
+		b.lock.Unlock()
+		util.LogNetworkError(fmt.Sprintf("[BattleServer] Client(%d) tried to resume an unknown session", newConnection.id))
+		b.respondWithMessage(newConnection, game.LoginResponse{
+			UserID:          newConnection.id,
+			Success:         false,
+			Message:         "Unknown or expired session",
+			ProtocolVersion: game.ProtocolVersion,
+		})
+		return newConnection.id, false
 	}
-	gameInstance, exists := b.runningGames[gameID]
-	if !exists {
-		b.respond(user, "SelectFactionResponse", game.ActionResponse{Success: false, Message: "Game does not exist"})
-		return
+	b.respondWithMessage(newConnection, game.LoginResponse{
+		UserID:          userID,
+		Success:         true,
+		Message:         "Welcome back",
+		ProtocolVersion: game.ProtocolVersion,
+		Capabilities:    newConnection.capabilities,
+		SessionToken:    user.sessionToken,
+		ResumedGame:     user.activeGame,
+		Mods:            b.activeMods,
+		ContentHash:     b.contentHash,
+	})
+	// the old connection may be half-open, the new one wins
+	oldConnection := user.out
+	user.setWriter(newConnection.out)
+	user.capabilities = newConnection.capabilities
+	runningGame, isInGame := b.runningGames[user.activeGame]
+	b.lock.Unlock()
+
+	if oldConnection != nil {
+		oldConnection.close()
+	}
+	util.LogNetworkInfo(fmt.Sprintf("[BattleServer] Client(%d) resumed the session of client(%d)", newConnection.id, userID))
+
+	if isInGame {
+		runningGame.do(func() {
+			b.notifyConnectionChanged(runningGame, user, true)
+			if runningGame.instance.IsStarted() {
+				b.respondWithMessage(user, b.resumeSnapshot(runningGame, user))
+			}
+			b.sendChatHistory(runningGame, user)
+		})
+	}
+	return userID, true
+}
+
+func (b *BattleServer) resumeSnapshot(g *gameActor, user *UserConnection) game.GameResumedMessage {
+	gameInstance := g.instance
+	turnsStarted := gameInstance.HasTurnsStarted()
+	snapshot := game.GameResumedMessage{
+		GameStartedMessage: b.gameStateFor(g, user.id),
+		CurrentPlayer:      gameInstance.GetCurrentPlayerID(),
+		YourTurn:           turnsStarted && gameInstance.IsPlayerTurn(user.id),
+		AwaitingDeployment: gameInstance.IsDeploymentRunning() && !g.ready[user.id],
+		AwaitingMapLoaded:  !turnsStarted && !gameInstance.IsDeploymentRunning() && !g.ready[user.id],
+		BlockEffects:       gameInstance.GetActiveBlockEffects(),
+		DestroyedBlocks:    gameInstance.GetDestroyedBlocks(),
+		BlockStates:        gameInstance.GetChangedBlockStates(),
+	}
+	if g.clock != nil && turnsStarted {
+		snapshot.SecondsLeft = g.clock.timeLeft().Seconds()
+		snapshot.ClockBanks = g.clock.bankSeconds()
+	}
+	return snapshot
+}
+
+func newSessionToken() string {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		log.Fatalln(err)
 	}
+	return hex.EncodeToString(token)
+}
 
+func (b *BattleServer) SelectFaction(g *gameActor, user *UserConnection, msg game.SelectFactionMessage) {
+	gameInstance := g.instance
 	faction, exists := b.availableFactions[msg.FactionName]
 	if !exists {
 		b.respond(user, "SelectFactionResponse", game.ActionResponse{Success: false, Message: "Faction does not exist"})
 		return
 	}
 
-	gameInstance.SetFaction(userID, faction)
+	gameInstance.SetFaction(user.id, faction)
 
 	b.respond(user, "SelectFactionResponse", game.ActionResponse{Success: true, Message: "Faction selected"})
 
 	if gameInstance.IsReady() {
-		b.startGame(gameInstance)
+		b.startGame(g)
 	}
 }
 
 func (b *BattleServer) CreateGame(userId uint64, msg game.CreateGameMessage) {
 	gameID := msg.GameIdentifier
-	user := b.connectedClients[userId]
-	if _, alreadyExists := b.runningGames[gameID]; alreadyExists {
+	user, _ := b.getUser(userId)
+	if _, alreadyExists := b.getGame(gameID); alreadyExists {
 		b.respond(user, "CreateGameResponse", game.ActionResponse{Success: false, Message: "Game already exists"})
 		return
 	}
 
-	battleGame := game.NewGameInstanceWithDetails(gameID, msg.Map, msg.MissionDetails)
-	//battleGame := game.NewGameInstanceWithBiome(gameID, game.NewBiomeDesert())
-	battleGame.SetEnvironment("Server")
+	if msg.MissionDetails != nil && !msg.MissionDetails.TimeControl.IsValid() {
+		b.respond(user, "CreateGameResponse", game.ActionResponse{Success: false, Message: "Invalid time control"})
+		return
+	}
+
+	rules, knownRules := b.rulesetNamed(msg.Ruleset)
+	if !knownRules {
+		b.respond(user, "CreateGameResponse", game.ActionResponse{Success: false, Message: fmt.Sprintf("Unknown ruleset '%s'", msg.Ruleset)})
+		return
+	}
+
+	var aiProfile game.AIProfile
+	if msg.AI != nil {
+		var problem string
+		if aiProfile, problem = b.aiProfileFor(*msg.AI); problem != "" {
+			b.respond(user, "CreateGameResponse", game.ActionResponse{Success: false, Message: problem})
+			return
+		}
+	}
+
+	battleGame := b.newGameInstance(gameID, msg.Map, msg.MissionDetails)
+	if rules != nil {
+		battleGame.SetRules(*rules)
+	}
+	if msg.AI != nil {
+		battleGame.SetAIProfile(userId, aiProfile)
+	}
+	battleGame.SetOwner(userId)
+	battleGame.SetPublic(msg.IsPublic)
 	battleGame.AddPlayer(userId)
 
-	listOfBlocks := game.GetDebugBlockNames()
-	indexMap := util.CreateIndexMapFromDirectory("assets/textures/blocks/star_odyssey", listOfBlocks)
+	if _, created := b.addGame(gameID, battleGame, msg.SpectatorTurnDelay, user); !created {
+		b.respond(user, "CreateGameResponse", game.ActionResponse{Success: false, Message: "Game already exists"})
+		return
+	}
+	b.respond(user, "CreateGameResponse", game.ActionResponse{Success: true, Message: "Game created"})
+}
+
+func (b *BattleServer) newGameInstance(gameID string, mapFile string, details *game.MissionDetails) *game.GameInstance {
+	battleGame := game.NewGameInstanceWithDetails(gameID, game.NewAssetsWithMods(b.modDirectories, b.modBlocks), mapFile, details)
+	//battleGame := game.NewGameInstanceWithBiome(gameID, game.NewAssetsWithMods(b.modDirectories, b.modBlocks), game.NewBiomeDesert())
+	battleGame.SetEnvironment("Server")
+
+	listOfBlocks := append(game.GetDebugBlockNames(), b.modBlocks...)
+	indexMap := util.CreateIndexMapFromDirectory("assets/textures/blocks/star_odyssey", slices.Clone(listOfBlocks))
 
 	bl := game.NewBlockLibrary(listOfBlocks, indexMap)
 	bl.ApplyGameplayRules(battleGame)
 
 	battleGame.SetBlockLibrary(bl)
-	user.isReady = false
-	user.activeGame = gameID
+	battleGame.SetBlockMaterials(b.blockMaterials)
+	return battleGame
+}
+
+// addGame registers the game and starts its goroutine, unless the id is already taken.
+// The creator, if any, is seated in the game.
+func (b *BattleServer) addGame(gameID string, battleGame *game.GameInstance, spectatorTurnDelay int, creator *UserConnection) (*gameActor, bool) {
+	runningGame := newGameActor(gameID, battleGame, newSpectatorFeed(spectatorTurnDelay, b.spectatorWriter(gameID)))
+	runningGame.recorder = newReplayRecorder(gameID, battleGame)
+	b.lock.Lock()
+	if _, alreadyExists := b.runningGames[gameID]; alreadyExists {
+		b.lock.Unlock()
+		return nil, false
+	}
+	b.runningGames[gameID] = runningGame
+	if creator != nil {
+		b.stopSpectating(creator)
+		creator.activeGame = gameID
+		creator.inLobby = false
+		creator.setRecorder(runningGame.recorder)
+		runningGame.recorder.setPlayerName(creator.id, creator.name)
+		runningGame.playerNames[creator.id] = creator.name
+	}
+	b.lock.Unlock()
 
-	b.runningGames[gameID] = battleGame
+	// nobody can hand commands to the game before it runs, so the instance is still ours here
+	b.notifyLobby(runningGame, false)
+	go runningGame.run()
+	return runningGame, true
+}
 
-	b.respond(user, "CreateGameResponse", game.ActionResponse{Success: true, Message: "Game created"})
+func (b *BattleServer) getGame(gameID string) (*gameActor, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	runningGame, exists := b.runningGames[gameID]
+	return runningGame, exists
 }
 
 func (b *BattleServer) JoinGame(id uint64, msg game.JoinGameMessage) {
-	gameID := msg.GameID
-	user := b.connectedClients[id]
-	if _, alreadyExists := b.runningGames[gameID]; !alreadyExists {
+	user, _ := b.getUser(id)
+	runningGame, exists := b.getGame(msg.GameID)
+	var aiProfile *game.AIProfile
+	if msg.AI != nil {
+		profile, problem := b.aiProfileFor(*msg.AI)
+		if problem != "" {
+			b.respond(user, "JoinGameResponse", game.ActionResponse{Success: false, Message: problem})
+			return
+		}
+		aiProfile = &profile
+	}
+	if !exists || !runningGame.do(func() { b.joinGame(runningGame, user, aiProfile) }) {
 		b.respond(user, "JoinGameResponse", game.ActionResponse{Success: false, Message: "Game does not exist"})
+	}
+}
+
+func (b *BattleServer) joinGame(g *gameActor, user *UserConnection, aiProfile *game.AIProfile) {
+	if len(g.vacantSeats) > 0 {
+		b.takeSavedSeat(g, user, "JoinGameResponse")
 		return
 	}
-	user.isReady = false
-	user.activeGame = gameID
-	gameInstance := b.runningGames[gameID]
-	gameInstance.AddPlayer(id)
+	gameInstance := g.instance
+	if gameInstance.IsFull() {
+		b.respond(user, "JoinGameResponse", game.ActionResponse{Success: false, Message: "Game is full, you can still spectate"})
+		return
+	}
+	b.lock.Lock()
+	if user.activeGame != "" {
+		b.lock.Unlock()
+		b.respond(user, "JoinGameResponse", game.ActionResponse{Success: false, Message: "You are already in a game"})
+		return
+	}
+	b.stopSpectating(user)
+	user.activeGame = g.id
+	user.inLobby = false
+	user.setRecorder(g.recorder)
+	b.lock.Unlock()
+	g.ready[user.id] = false
+	gameInstance.AddPlayer(user.id)
+	if aiProfile != nil {
+		gameInstance.SetAIProfile(user.id, *aiProfile)
+	}
+	g.recorder.recordCommand(user.id, "JoinGame", game.JoinGameMessage{GameID: g.id})
+	g.recorder.setPlayerName(user.id, user.name)
+	g.playerNames[user.id] = user.name
 
 	b.respond(user, "JoinGameResponse", game.ActionResponse{Success: true, Message: "Game joined"})
+	b.notifyLobby(g, false)
 
 	if gameInstance.IsReady() {
-		b.startGame(gameInstance)
+		b.startGame(g)
 	}
 }
 
-func (b *BattleServer) startGame(battleGame *game.GameInstance) {
-	util.LogGameInfo(fmt.Sprintf("[BattleServer] Starting game %s", battleGame.GetID()))
+func (b *BattleServer) startGame(g *gameActor) {
+	battleGame := g.instance
+	util.LogGameInfo(fmt.Sprintf("[BattleServer] Starting game %s", g.id))
 	battleGame.Start()
-	playerNames := make(map[uint64]string)
-	playerFactions := battleGame.GetPlayerFactions()
+	b.notifyLobby(g, true)
+
+	// also send the initial LOS state
+	battleGame.InitLOSAndPressure()
 
 	for _, playerID := range battleGame.GetPlayerIDs() {
-		user, exists := b.connectedClients[playerID]
+		user, exists := b.getUser(playerID)
 		if !exists {
 			util.LogGameError(fmt.Sprintf("[BattleServer] ERR -> Player %d does not exist", playerID))
 			continue
 		}
-		playerNames[playerID] = user.name
-	}
-
-	// also send the initial LOS state
-	battleGame.InitLOSAndPressure()
-
-	for spawnIndex, playerID := range battleGame.GetPlayerIDs() {
-		user := b.connectedClients[playerID]
-
 		// broadcast game started event to all players, tell everyone who's turn it is
-		units := battleGame.GetPlayerUnits(playerID)
-		whoCanSeeWho, visibleUnits := battleGame.GetLOSState(playerID)
-		pressure := battleGame.GetPressureMatrix()
-
-		b.respond(user, "GameStarted", game.GameStartedMessage{
-			GameID:           battleGame.GetID(),
-			PlayerNameMap:    playerNames,
-			PlayerFactionMap: playerFactions,
-			OwnID:            playerID,
-			SpawnIndex:       uint64(spawnIndex),
-			OwnUnits:         units,
-			MapFile:          battleGame.GetMapFile(),
-			LOSMatrix:        whoCanSeeWho,
-			PressureMatrix:   pressure,
-			VisibleUnits:     visibleUnits,
-			MissionDetails:   battleGame.GetMissionDetails(),
-		})
+		b.respond(user, "GameStarted", b.gameStateFor(g, playerID))
 	}
+	b.publishSpectatorState(g)
 }
-func (b *BattleServer) SelectDeployment(userID uint64, msg game.DeploymentMessage) {
-	user, gameInstance, exists := b.getUserAndGame(userID)
-	if !exists {
-		return
+
+// playerNames looks up the names of the connected players.
+func (b *BattleServer) playerNames(playerIDs []uint64) map[uint64]string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	playerNames := make(map[uint64]string)
+	for _, id := range playerIDs {
+		if user, exists := b.connectedClients[id]; exists {
+			playerNames[id] = user.name
+		}
 	}
+	return playerNames
+}
 
-	util.LogNetworkDebug(fmt.Sprintf("[BattleServer] %d selected deployment: %v", userID, msg.Deployment))
+// gameStateFor is everything a player needs to know to (re-)build the game on the client side.
+func (b *BattleServer) gameStateFor(g *gameActor, playerID uint64) game.GameStartedMessage {
+	battleGame := g.instance
+	units := battleGame.GetPlayerUnits(playerID)
+	whoCanSeeWho, visibleUnits := battleGame.GetLOSState(playerID)
+	pressure := battleGame.GetPressureMatrix()
+
+	return game.GameStartedMessage{
+		GameID:           g.id,
+		PlayerNameMap:    b.playerNames(battleGame.GetPlayerIDs()),
+		PlayerFactionMap: battleGame.GetPlayerFactions(),
+		OwnID:            playerID,
+		SpawnIndex:       uint64(battleGame.IndexOfPlayer(playerID)),
+		OwnUnits:         units,
+		MapFile:          battleGame.GetMapFile(),
+		LOSMatrix:        whoCanSeeWho,
+		PressureMatrix:   pressure,
+		VisibleUnits:     visibleUnits,
+		MissionDetails:   battleGame.GetMissionDetails(),
+		Rules:            battleGame.GetRules(),
+		BlockMaterials:   battleGame.GetBlockMaterials(),
+		AIProfile:        battleGame.GetAIProfile(playerID),
+		FogImmunePlayers: b.fogImmunePlayers(battleGame),
+	}
+}
+func (b *BattleServer) SelectDeployment(g *gameActor, user *UserConnection, msg game.DeploymentMessage) {
+	gameInstance := g.instance
+	util.LogNetworkDebug(fmt.Sprintf("[BattleServer] %d selected deployment: %v", user.id, msg.Deployment))
 
-	if !gameInstance.TryDeploy(userID, msg.Deployment) {
+	if !gameInstance.TryDeploy(user.id, msg.Deployment) {
 		b.respond(user, "DeploymentResponse", game.ActionResponse{Success: false, Message: "Deployment failed"})
 		return
 	}
 
 	b.respond(user, "DeploymentResponse", game.ActionResponse{Success: true, Message: "Deployment successful"})
 
-	user.isReady = true
-
-	allReady := true
-	for _, playerID := range gameInstance.GetPlayerIDs() {
-		connectedUser := b.connectedClients[playerID]
-		if !connectedUser.isReady {
-			allReady = false
-			break
-		}
-	}
+	g.ready[user.id] = true
 
-	if allReady {
+	if g.allReady() {
 		gameInstance.DeploymentDone()
-		b.SendNextPlayer(gameInstance)
+		b.SendNextPlayer(g, false)
 	}
 }
-func (b *BattleServer) SelectUnits(userID uint64, msg game.SelectUnitsMessage) {
-	user := b.connectedClients[userID]
-	gameID := user.activeGame
-	if gameID == "" {
-		b.respond(user, "SelectUnitsResponse", game.ActionResponse{Success: false, Message: "You are not in a game"})
-		return
-	}
-	gameInstance, exists := b.runningGames[gameID]
-	if !exists {
-		b.respond(user, "SelectUnitsResponse", game.ActionResponse{Success: false, Message: "Game does not exist"})
+func (b *BattleServer) SelectUnits(g *gameActor, user *UserConnection, msg game.SelectUnitsMessage) {
+	gameInstance := g.instance
+	userID := user.id
+	factionName, hasFaction := gameInstance.GetPlayerFactions()[userID]
+	if !hasFaction {
+		b.respond(user, "SelectUnitsResponse", game.ActionResponse{Success: false, Message: "Select a faction first"})
 		return
 	}
+	factionUnits := b.availableUnits[factionName]
 	for _, unitRequest := range msg.Units {
-		if unitRequest.UnitTypeID >= uint64(len(b.availableUnits)) {
-			b.respond(user, "SelectUnitsResponse", game.ActionResponse{Success: false, Message: fmt.Sprintf("Unit %d does not exist", unitRequest.UnitTypeID)})
+		if _, exists := factionUnits[unitRequest.UnitType]; !exists {
+			b.respond(user, "SelectUnitsResponse", game.ActionResponse{Success: false, Message: fmt.Sprintf("Unit '%s' does not exist in faction '%s'", unitRequest.UnitType, factionName)})
 			return
 		}
 	}
@@ -386,7 +875,7 @@ func (b *BattleServer) SelectUnits(userID uint64, msg game.SelectUnitsMessage) {
 	for _, unitRequest := range msg.Units {
 		unitChoice := unitRequest
 		// get unit definition
-		spawnedUnitDef := b.availableUnits[unitChoice.UnitTypeID]
+		spawnedUnitDef := factionUnits[unitChoice.UnitType]
 
 		// create unit
 		unit := game.NewUnitInstance(assetLoader, unitChoice.Name, spawnedUnitDef)
@@ -418,21 +907,17 @@ func (b *BattleServer) SelectUnits(userID uint64, msg game.SelectUnitsMessage) {
 		unit.StartStanceAnimation()
 
 		util.LogGlobalUnitDebug(unit.DebugString("ServerSpawnUnit(+UpdateAnim)"))
-		util.LogGameInfo(fmt.Sprintf("[BattleServer] User %d selected unit of type %d: %s(%d)", userID, spawnedUnitDef.ID, unitChoice.Name, unitID))
+		util.LogGameInfo(fmt.Sprintf("[BattleServer] User %d selected unit of type '%s': %s(%d)", userID, spawnedUnitDef.Name, unitChoice.Name, unitID))
 	}
 
 	b.respond(user, "SelectUnitsResponse", game.ActionResponse{Success: true, Message: "Units selected"})
 
 	if gameInstance.IsReady() {
-		b.startGame(gameInstance)
+		b.startGame(g)
 	}
 }
-func (b *BattleServer) UnitAction(userID uint64, msg game.UnitActionMessage) {
-	user, gameInstance, isValid := b.getUserAndGame(userID)
-	if !isValid {
-		return
-	}
-
+func (b *BattleServer) UnitAction(g *gameActor, user *UserConnection, msg game.UnitActionMessage) {
+	gameInstance := g.instance
 	unit, isValidUnit := b.getUnit(gameInstance, user, msg.UnitID())
 	if !isValidUnit {
 		return
@@ -447,7 +932,20 @@ func (b *BattleServer) UnitAction(userID uint64, msg game.UnitActionMessage) {
 	}
 
 	mb := game.NewMessageBuffer(gameInstance.GetPlayerIDs(), b.writeFromBuffer)
+	mb.SetSpectatorWriter(g.feed.publish)
 	action.Execute(mb)
+	collapse := gameInstance.CollapseUnsupportedBlocks()
+	changes, destroyed := gameInstance.TakeBlockStateChanges(), gameInstance.TakeDestroyedBlocks()
+	if len(changes) > 0 || len(destroyed) > 0 {
+		mb.AddMessageForAll(game.BlockStatesChangedMessage{Changes: changes, Destroyed: destroyed})
+	}
+	if len(collapse.Blocks) > 0 {
+		for _, playerID := range mb.UserIDs() {
+			mb.AddMessageFor(playerID, gameInstance.CollapseSeenBy(playerID, collapse))
+		}
+		collapse.LOSMatrix, collapse.PressureMatrix = gameInstance.GetCompleteLOSMatrix(), gameInstance.GetPressureMatrix()
+		mb.AddMessageForSpectators(collapse)
+	}
 
 	if action.IsTurnEnding() {
 		unit.EndTurn()
@@ -478,20 +976,9 @@ func (b *BattleServer) getUnit(gameInstance *game.GameInstance, user *UserConnec
 	}
 	return unit, true
 }
-func (b *BattleServer) EndTurn(userID uint64) {
-	user := b.connectedClients[userID]
-	gameID := user.activeGame
-	if gameID == "" {
-		b.respondWithMessage(user, game.ActionResponse{Success: false, Message: "You are not in a game"})
-		return
-	}
-	gameInstance, exists := b.runningGames[gameID]
-	if !exists {
-		b.respondWithMessage(user, game.ActionResponse{Success: false, Message: "Game does not exist"})
-		return
-	}
-
-	if !gameInstance.IsPlayerTurn(userID) {
+func (b *BattleServer) EndTurn(g *gameActor, user *UserConnection) {
+	gameInstance := g.instance
+	if !gameInstance.IsPlayerTurn(user.id) {
 		b.respondWithMessage(user, game.ActionResponse{Success: false, Message: "It is not your turn"})
 		return
 	}
@@ -501,29 +988,39 @@ func (b *BattleServer) EndTurn(userID uint64) {
 		return
 	}
 
-	isGameOver, winner := gameInstance.IsGameOver()
+	b.endTurn(g, false)
+}
+
+// endTurn is the end of every turn, whether the player ended it or the time ran out.
+func (b *BattleServer) endTurn(g *gameActor, timedOut bool) {
+	isGameOver, winner := g.instance.IsGameOver()
 	if isGameOver {
-		b.SendGameOver(gameInstance, winner)
+		b.SendGameOver(g, winner)
 	} else {
-		b.SendNextPlayer(gameInstance)
+		b.SendNextPlayer(g, timedOut)
 	}
 }
 
-func (b *BattleServer) SendGameOver(instance *game.GameInstance, winner uint64) {
-	println(fmt.Sprintf("[BattleServer] Game '%s' is over, winner is %d", instance.GetID(), winner))
-	for _, playerID := range instance.GetPlayerIDs() {
-		connectedUser := b.connectedClients[playerID]
+func (b *BattleServer) SendGameOver(g *gameActor, winner uint64) {
+	println(fmt.Sprintf("[BattleServer] Game '%s' is over, winner is %d", g.id, winner))
+	b.lock.Lock()
+	for _, playerID := range g.instance.GetPlayerIDs() {
+		connectedUser, exists := b.connectedClients[playerID]
+		if !exists {
+			continue // the session of a dropped player expired
+		}
 		connectedUser.activeGame = ""
-		connectedUser.isReady = false
 		b.respond(connectedUser, "GameOver", game.GameOverMessage{
 			WinnerID: winner,
 			YouWon:   playerID == winner,
 		})
+		connectedUser.setRecorder(nil)
 	}
-	delete(b.runningGames, instance.GetID())
-	util.LogGameInfo(fmt.Sprintf("[BattleServer] Game '%s' removed", instance.GetID()))
+	b.lock.Unlock()
+	b.removeGame(g, game.GameOverMessage{WinnerID: winner})
 }
-func (b *BattleServer) SendNextPlayer(gameInstance *game.GameInstance) {
+func (b *BattleServer) SendNextPlayer(g *gameActor, previousTimedOut bool) {
+	gameInstance := g.instance
 	//println("[BattleServer] Ending turn. New map state:")
 	//gameInstance.GetVoxelMap().PrintArea2D(16, 16)
 	/*
@@ -532,68 +1029,82 @@ func (b *BattleServer) SendNextPlayer(gameInstance *game.GameInstance) {
 		}
 
 	*/
-	util.LogNetworkInfo(fmt.Sprintf("[BattleServer] New turn for game %s", gameInstance.GetID()))
+	util.LogNetworkInfo(fmt.Sprintf("[BattleServer] New turn for game %s", g.id))
 
 	nextPlayer := gameInstance.NextPlayer()
+	secondsLeft, clockBanks := b.startTurnClock(g, nextPlayer)
 	for _, playerID := range gameInstance.GetPlayerIDs() {
-		connectedUser := b.connectedClients[playerID]
-		b.respondWithMessage(connectedUser, game.NextPlayerMessage{
-			CurrentPlayer: nextPlayer,
-			YourTurn:      playerID == nextPlayer,
-		})
+		message := game.NextPlayerMessage{
+			CurrentPlayer:    nextPlayer,
+			YourTurn:         playerID == nextPlayer,
+			SecondsLeft:      secondsLeft,
+			ClockBanks:       clockBanks,
+			PreviousTimedOut: previousTimedOut,
+		}
+		if message.YourTurn && b.seesThroughFog(gameInstance, playerID) {
+			message.RevealedUnits = enemyUnitsOf(gameInstance, playerID)
+		}
+		b.respondTo(playerID, message)
 	}
+	g.feed.nextTurn()
+	g.feed.publishMessage(b.spectatorStateFor(g))
+	b.autosave(g)
+	g.feed.publishMessage(game.NextPlayerMessage{CurrentPlayer: nextPlayer, SecondsLeft: secondsLeft, ClockBanks: clockBanks, PreviousTimedOut: previousTimedOut})
 
 	// the server would now wait for messages from the next player
 	// if it is an AI player, we could generate the moves for it right here instead.
 	// but that would blur the line and we would lose interesting options
 }
 
-func (b *BattleServer) SendStartDeployment(gameInstance *game.GameInstance) {
-	for _, playerID := range gameInstance.GetPlayerIDs() {
-		connectedUser := b.connectedClients[playerID]
-		b.respondWithMessage(connectedUser, game.StartDeploymentMessage{})
-	}
+// seesThroughFog is true for the AI seats that get all enemy units at the beginning of their turns.
+func (b *BattleServer) seesThroughFog(gameInstance *game.GameInstance, playerID uint64) bool {
+	profile := gameInstance.GetAIProfile(playerID)
+	return b.aiSeesThroughFog && profile != nil && profile.SeesThroughFog
 }
 
-func (b *BattleServer) MapLoaded(userID uint64, msg game.MapLoadedMessage) {
-	// get the player and mark him as ready
-	user, exists := b.connectedClients[userID]
-	if !exists {
-		println(fmt.Sprintf("[BattleServer] ERR -> Player %d does not exist", userID))
-		return
-	}
-
-	gameID := user.activeGame
-	if gameID == "" {
-		b.respond(user, "MapLoadedResponse", game.ActionResponse{Success: false, Message: "You are not in a game"})
-		return
+// fogImmunePlayers lists the seats that see through the fog, so every player knows about them.
+func (b *BattleServer) fogImmunePlayers(gameInstance *game.GameInstance) []uint64 {
+	var fogImmune []uint64
+	for _, playerID := range gameInstance.GetPlayerIDs() {
+		if b.seesThroughFog(gameInstance, playerID) {
+			fogImmune = append(fogImmune, playerID)
+		}
 	}
+	return fogImmune
+}
 
-	gameInstance, exists := b.runningGames[gameID]
-	if !exists {
-		b.respond(user, "MapLoadedResponse", game.ActionResponse{Success: false, Message: "Game does not exist"})
-		return
+// enemyUnitsOf lists the active units that the player does not control.
+func enemyUnitsOf(gameInstance *game.GameInstance, playerID uint64) []*game.UnitInstance {
+	var enemies []*game.UnitInstance
+	for _, unit := range gameInstance.GetAllUnits() {
+		if unit.ControlledBy() != playerID && unit.IsActive() {
+			enemies = append(enemies, unit)
+		}
 	}
-	user.isReady = true
+	sort.Slice(enemies, func(i, j int) bool { return enemies[i].UnitID() < enemies[j].UnitID() })
+	return enemies
+}
 
-	allReady := true
-	for _, playerID := range gameInstance.GetPlayerIDs() {
-		connectedUser := b.connectedClients[playerID]
-		if !connectedUser.isReady {
-			allReady = false
-			break
-		}
+func (b *BattleServer) SendStartDeployment(g *gameActor) {
+	g.instance.StartDeployment()
+	for _, playerID := range g.instance.GetPlayerIDs() {
+		b.respondTo(playerID, game.StartDeploymentMessage{})
 	}
+}
 
-	if allReady {
-		if gameInstance.GetMissionDetails().Placement == game.PlacementModeManual {
-			for _, playerID := range gameInstance.GetPlayerIDs() {
-				connectedUser := b.connectedClients[playerID]
-				connectedUser.isReady = false // reset ready, wait for deployment
-			}
-			b.SendStartDeployment(gameInstance)
+func (b *BattleServer) MapLoaded(g *gameActor, user *UserConnection, msg game.MapLoadedMessage) {
+	// mark the player as ready
+	gameInstance := g.instance
+	g.ready[user.id] = true
+
+	if g.allReady() {
+		if gameInstance.HasTurnsStarted() {
+			b.continueSavedGame(g) // only restored games load the map after the turns have started
+		} else if gameInstance.GetMissionDetails().Placement == game.PlacementModeManual {
+			g.resetReady() // wait for deployment
+			b.SendStartDeployment(g)
 		} else {
-			b.SendNextPlayer(gameInstance) // this is the right thing, if the place is pre-determined..
+			b.SendNextPlayer(g, false) // this is the right thing, if the place is pre-determined..
 		}
 	}
 }
@@ -606,13 +1117,119 @@ func (b *BattleServer) AddItem(itemDefinition game.ItemDefinition) {
 	b.availableItems[itemDefinition.UniqueName] = &itemDefinition
 }
 
-func (b *BattleServer) Reload(userID uint64, unitID uint64) {
-	user, gameInstance, exists := b.getUserAndGame(userID)
+// AddMods offers the content of the base game and the mods layered over it. From now on,
+// only clients with the same content hash are let in.
+func (b *BattleServer) AddMods(mods *game.ModSet) {
+	b.AddContent(mods.Content)
+	for _, displayName := range sortedMapNames(mods.Maps) {
+		b.AddMap(displayName, mods.Maps[displayName])
+	}
+	b.modBlocks = mods.Blocks
+	b.modDirectories = mods.Directories
+	b.activeMods = mods.Mods
+	b.contentHash = mods.ContentHash
+	for _, conflict := range mods.Conflicts {
+		util.LogGameError("[BattleServer] Mod conflict: " + conflict)
+	}
+	util.LogGameInfo("[BattleServer] Running " + describeMods(mods.Mods))
+}
+
+func sortedMapNames(maps map[string]string) []string {
+	names := make([]string, 0, len(maps))
+	for name := range maps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func describeMods(mods []game.ModInfo) string {
+	if len(mods) == 0 {
+		return "the base game without mods"
+	}
+	names := make([]string, len(mods))
+	for i, mod := range mods {
+		names[i] = fmt.Sprintf("%s %s", mod.Name, mod.Version)
+	}
+	return "the mods " + strings.Join(names, ", ")
+}
+
+// AddContent offers all factions, weapons and items that were loaded from a data directory.
+func (b *BattleServer) AddContent(content *game.ContentDefinitions) {
+	for _, faction := range content.Factions {
+		b.AddFaction(faction)
+	}
+	for _, weapon := range content.Weapons {
+		b.AddWeapon(weapon)
+	}
+	for _, item := range content.Items {
+		b.AddItem(item)
+	}
+	for name, rules := range content.RulePresets {
+		b.AddRulePreset(name, rules)
+	}
+	for name, difficulty := range content.AIDifficulties {
+		b.aiDifficulties[name] = difficulty
+	}
+	for name, personality := range content.AIPersonalities {
+		b.aiPersonalities[name] = personality
+	}
+	b.blockMaterials = content.BlockMaterials
+}
+
+// AllowAIToSeeThroughFog lets the AI seats with a difficulty that sees through the fog get all enemy units.
+// The server can not tell an AI client from a human asking for the same profile, so only servers whose AI
+// clients run in the same process should allow it.
+func (b *BattleServer) AllowAIToSeeThroughFog(allowed bool) {
+	b.aiSeesThroughFog = allowed
+}
+
+func (b *BattleServer) AddRulePreset(name string, rules game.Ruleset) {
+	rules.Name = name
+	b.rulePresets[name] = rules
+}
+
+// rulesetNamed finds the preset a new game asked for. Without any presets, games keep the built-in default rules.
+func (b *BattleServer) rulesetNamed(name string) (*game.Ruleset, bool) {
+	if name == "" {
+		name = game.DefaultRulesetName
+	}
+	rules, exists := b.rulePresets[name]
 	if !exists {
-		return
+		return nil, len(b.rulePresets) == 0 && name == game.DefaultRulesetName
 	}
+	return &rules, true
+}
 
-	unit, unitExists := gameInstance.GetUnit(unitID)
+// aiProfileFor combines the difficulty and the personality of an AI seat. Without any profiles in the game data,
+// only the defaults are accepted. The returned string explains what is wrong with the seat.
+func (b *BattleServer) aiProfileFor(seat game.AISeat) (game.AIProfile, string) {
+	if seat.Difficulty == "" {
+		seat.Difficulty = game.DefaultAIDifficulty
+	}
+	if seat.Personality == "" {
+		seat.Personality = game.DefaultAIPersonality
+	}
+	if len(b.aiDifficulties) == 0 && len(b.aiPersonalities) == 0 {
+		if seat.Difficulty != game.DefaultAIDifficulty || seat.Personality != game.DefaultAIPersonality {
+			return game.AIProfile{}, "This server only has the default AI"
+		}
+		return game.NewDefaultAIProfile(), ""
+	}
+	difficulty, knownDifficulty := b.aiDifficulties[seat.Difficulty]
+	if !knownDifficulty {
+		return game.AIProfile{}, fmt.Sprintf("Unknown AI difficulty '%s'", seat.Difficulty)
+	}
+	personality, knownPersonality := b.aiPersonalities[seat.Personality]
+	if !knownPersonality {
+		return game.AIProfile{}, fmt.Sprintf("Unknown AI personality '%s'", seat.Personality)
+	}
+	difficulty.SeesThroughFog = difficulty.SeesThroughFog && b.aiSeesThroughFog
+	return game.NewAIProfile(seat.Difficulty, difficulty, seat.Personality, personality), ""
+}
+
+func (b *BattleServer) Reload(g *gameActor, user *UserConnection, unitID uint64) {
+	unit, unitExists := g.instance.GetUnit(unitID)
 	if !unitExists {
 		b.respond(user, "ActionResponse", game.ActionResponse{Success: false, Message: "Unit does not exist"})
 		return
@@ -633,46 +1250,49 @@ func (b *BattleServer) Reload(userID uint64, unitID uint64) {
 	b.respond(user, "Reload", game.UnitMessage{GameUnitID: unit.UnitID()})
 }
 
-func (b *BattleServer) DebugRequest(userID uint64, msg game.DebugRequest) {
-	user, gameInstance, exists := b.getUserAndGame(userID)
-	if !exists {
-		return
-	}
-
-	debugState := gameInstance.DebugGetCompleteState()
+func (b *BattleServer) DebugRequest(g *gameActor, user *UserConnection, msg game.DebugRequest) {
+	debugState := g.instance.DebugGetCompleteState()
 	b.respond(user, "DebugResponse", debugState)
 }
 
-func (b *BattleServer) getUserAndGame(userID uint64) (*UserConnection, *game.GameInstance, bool) {
+// getUserAndGame finds the game the user is playing in, or tells the user why there is none.
+func (b *BattleServer) getUserAndGame(userID uint64, responseType string) (*UserConnection, *gameActor, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
 	user, exists := b.connectedClients[userID]
 	if !exists {
-		b.respond(user, "ActionResponse", game.ActionResponse{Success: false, Message: "User does not exist"})
 		return nil, nil, false
 	}
 
 	gameID := user.activeGame
 
 	if gameID == "" {
-		b.respond(user, "ActionResponse", game.ActionResponse{Success: false, Message: "You are not in a game"})
+		b.respond(user, responseType, game.ActionResponse{Success: false, Message: "You are not in a game"})
 		return nil, nil, false
 	}
 
-	gameInstance, exists := b.runningGames[gameID]
+	runningGame, exists := b.runningGames[gameID]
 	if !exists {
-		b.respond(user, "ActionResponse", game.ActionResponse{Success: false, Message: "Game does not exist"})
+		b.respond(user, responseType, game.ActionResponse{Success: false, Message: "Game does not exist"})
 		return nil, nil, false
 	}
 
-	return user, gameInstance, true
+	return user, runningGame, true
 }
 
 func NewBattleServer() *BattleServer {
 	return &BattleServer{
-		availableMaps:     make(map[string]string),             // filename -> display name
-		availableFactions: make(map[string]*game.Faction),      // faction name -> faction
-		connectedClients:  make(map[uint64]*UserConnection),    // client id -> client
-		runningGames:      make(map[string]*game.GameInstance), // game id -> game
-		availableWeapons:  make(map[string]*game.WeaponDefinition),
-		availableItems:    make(map[string]*game.ItemDefinition),
+		availableMaps:        make(map[string]string),          // filename -> display name
+		availableFactions:    make(map[string]*game.Faction),   // faction name -> faction
+		connectedClients:     make(map[uint64]*UserConnection), // client id -> client
+		runningGames:         make(map[string]*gameActor),      // game id -> game
+		sessions:             make(map[string]uint64),          // session token -> client id
+		reconnectGracePeriod: DefaultReconnectGracePeriod,
+		availableUnits:       make(map[string]map[string]*game.UnitDefinition),
+		availableWeapons:     make(map[string]*game.WeaponDefinition),
+		availableItems:       make(map[string]*game.ItemDefinition),
+		rulePresets:          make(map[string]game.Ruleset),
+		aiDifficulties:       make(map[string]game.AIDifficulty),
+		aiPersonalities:      make(map[string]game.AIPersonality),
 	}
 }
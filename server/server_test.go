@@ -0,0 +1,288 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/memmaker/battleground/game"
+	"net"
+	"testing"
+	"time"
+)
+
+func login(t *testing.T, version int) (game.LoginResponse, net.Conn) {
+	t.Helper()
+	return connectAndLogin(t, NewBattleServer(), 1, game.LoginMessage{Username: "tester", ProtocolVersion: version})
+}
+
+func connectAndLogin(t *testing.T, server *BattleServer, connectionID uint64, msg game.LoginMessage) (game.LoginResponse, net.Conn) {
+	t.Helper()
+	serverSide, clientSide := net.Pipe()
+	go server.handleClientRequest(serverSide, connectionID)
+
+	asJson, _ := json.Marshal(msg)
+	if err := game.WriteFrame(clientSide, "Login", asJson); err != nil {
+		t.Fatal(err)
+	}
+	messageType, message, err := game.ReadFrame(clientSide)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messageType != "LoginResponse" {
+		t.Fatalf("expected LoginResponse, got %s", messageType)
+	}
+	var response game.LoginResponse
+	if err = json.Unmarshal(message, &response); err != nil {
+		t.Fatal(err)
+	}
+	return response, clientSide
+}
+
+func TestLoginHandshake(t *testing.T) {
+	response, con := login(t, game.ProtocolVersion)
+	defer con.Close()
+	if !response.Success {
+		t.Errorf("login failed: %s", response.Message)
+	}
+	if response.ProtocolVersion != game.ProtocolVersion {
+		t.Errorf("server announced version %d, want %d", response.ProtocolVersion, game.ProtocolVersion)
+	}
+}
+
+func TestLoginRejectsIncompatibleVersion(t *testing.T) {
+	response, con := login(t, game.ProtocolVersion+1)
+	defer con.Close()
+	if response.Success {
+		t.Fatal("expected the login to be rejected")
+	}
+	// the server hangs up after rejecting
+	if _, _, err := game.ReadFrame(con); err == nil {
+		t.Error("expected the connection to be closed")
+	}
+}
+
+func TestLoginRejectsDifferentContent(t *testing.T) {
+	server := NewBattleServer()
+	server.AddMods(&game.ModSet{
+		Content:     &game.ContentDefinitions{},
+		Mods:        []game.ModInfo{{Name: "Heavy Weapons", Version: "1.0", Hash: "abc"}},
+		ContentHash: "server content",
+	})
+	response, con := connectAndLogin(t, server, 1, game.LoginMessage{Username: "modded", ProtocolVersion: game.ProtocolVersion, ContentHash: "client content"})
+	con.Close()
+	if response.Success || len(response.Mods) != 1 || response.ContentHash != "server content" {
+		t.Fatalf("expected a rejection naming the mods of the server, got %+v", response)
+	}
+
+	response, con = connectAndLogin(t, server, 2, game.LoginMessage{Username: "modded", ProtocolVersion: game.ProtocolVersion, ContentHash: "server content"})
+	defer con.Close()
+	if !response.Success || response.Mods[0].Name != "Heavy Weapons" {
+		t.Fatalf("expected the login to succeed and list the mods, got %+v", response)
+	}
+}
+
+func resumableLogin(token string) game.LoginMessage {
+	return game.LoginMessage{
+		Username:        "tester",
+		ProtocolVersion: game.ProtocolVersion,
+		Capabilities:    []game.Capability{game.CapabilityResume},
+		SessionToken:    token,
+	}
+}
+
+// seatInGame puts a logged-in user into a game that has not started yet.
+func seatInGame(server *BattleServer, userID uint64, gameID string) {
+	user, _ := server.getUser(userID)
+	server.addGame(gameID, new(game.GameInstance), 0, user)
+}
+
+func TestResumeSession(t *testing.T) {
+	server := NewBattleServer()
+	response, con := connectAndLogin(t, server, 1, resumableLogin(""))
+	if response.SessionToken == "" {
+		t.Fatal("expected a session token")
+	}
+	seatInGame(server, 1, "lan party")
+	con.Close()
+
+	resumed, newCon := connectAndLogin(t, server, 2, resumableLogin(response.SessionToken))
+	defer newCon.Close()
+	if !resumed.Success {
+		t.Fatalf("resume failed: %s", resumed.Message)
+	}
+	if resumed.UserID != 1 {
+		t.Errorf("resumed as user %d, want 1", resumed.UserID)
+	}
+	if resumed.ResumedGame != "lan party" {
+		t.Errorf("resumed into game %q, want %q", resumed.ResumedGame, "lan party")
+	}
+}
+
+func TestResumeUnknownSession(t *testing.T) {
+	response, con := connectAndLogin(t, NewBattleServer(), 1, resumableLogin("not a session"))
+	defer con.Close()
+	if response.Success {
+		t.Error("expected the resume to be rejected")
+	}
+}
+
+func TestSessionExpiresAfterGracePeriod(t *testing.T) {
+	server := NewBattleServer()
+	server.SetReconnectGracePeriod(10 * time.Millisecond)
+	response, con := connectAndLogin(t, server, 1, resumableLogin(""))
+	seatInGame(server, 1, "lan party")
+	con.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	resumed, newCon := connectAndLogin(t, server, 2, resumableLogin(response.SessionToken))
+	defer newCon.Close()
+	if resumed.Success {
+		t.Error("expected the expired session to be rejected")
+	}
+	if _, exists := server.getGame("lan party"); exists {
+		t.Error("expected the abandoned game to be removed")
+	}
+}
+
+func TestListGamesShowsOpenPublicGames(t *testing.T) {
+	server := NewBattleServer()
+	_, con := connectAndLogin(t, server, 1, game.LoginMessage{Username: "tester", ProtocolVersion: game.ProtocolVersion})
+	defer con.Close()
+
+	open := new(game.GameInstance)
+	open.SetPublic(true)
+	open.SetOwner(1)
+	private := new(game.GameInstance)
+	started := new(game.GameInstance)
+	started.SetPublic(true)
+	started.AddPlayer(1)
+	started.Start()
+	server.addGame("open", open, 0, nil)
+	server.addGame("private", private, 0, nil)
+	server.addGame("started", started, 0, nil)
+
+	asJson, _ := json.Marshal(game.ListGamesMessage{})
+	if err := game.WriteFrame(con, "ListGames", asJson); err != nil {
+		t.Fatal(err)
+	}
+	messageType, message, err := game.ReadFrame(con)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messageType != "GameList" {
+		t.Fatalf("expected GameList, got %s", messageType)
+	}
+	var list game.GameListMessage
+	if err = json.Unmarshal(message, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Games) != 1 || list.Games[0].Creator != "tester" {
+		t.Errorf("got %+v, want only the open game created by tester", list.Games)
+	}
+}
+
+func TestListGamesOfADroppedUserIsIgnored(t *testing.T) {
+	NewBattleServer().ListGames(42, game.ListGamesMessage{Subscribe: true})
+}
+
+func TestCreateGameRejectsUnknownRuleset(t *testing.T) {
+	server := NewBattleServer()
+	server.AddRulePreset(game.DefaultRulesetName, game.Ruleset{MaxPressureDistance: 4})
+	_, con := connectAndLogin(t, server, 1, game.LoginMessage{Username: "tester", ProtocolVersion: game.ProtocolVersion})
+	defer con.Close()
+
+	asJson, _ := json.Marshal(game.CreateGameMessage{Map: "map", GameIdentifier: "chaos game", Ruleset: "chaos"})
+	if err := game.WriteFrame(con, "CreateGame", asJson); err != nil {
+		t.Fatal(err)
+	}
+	messageType, message, err := game.ReadFrame(con)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var response game.ActionResponse
+	if err = json.Unmarshal(message, &response); err != nil {
+		t.Fatal(err)
+	}
+	if messageType != "CreateGameResponse" || response.Success {
+		t.Fatalf("expected the game to be refused, got %s %+v", messageType, response)
+	}
+	if _, exists := server.getGame("chaos game"); exists {
+		t.Error("expected no game to be created")
+	}
+}
+
+func TestRulesetNamed(t *testing.T) {
+	server := NewBattleServer()
+	if rules, known := server.rulesetNamed(""); !known || rules != nil {
+		t.Errorf("expected the built-in rules without presets, got %v %v", rules, known)
+	}
+	server.AddRulePreset(game.DefaultRulesetName, game.Ruleset{MaxPressureDistance: 4})
+	server.AddRulePreset("tactical", game.Ruleset{MaxPressureDistance: 6})
+	if rules, known := server.rulesetNamed(""); !known || rules.Name != game.DefaultRulesetName {
+		t.Errorf("expected the default preset, got %v %v", rules, known)
+	}
+	if rules, known := server.rulesetNamed("tactical"); !known || rules.MaxPressureDistance != 6 {
+		t.Errorf("expected the tactical preset, got %v %v", rules, known)
+	}
+	if _, known := server.rulesetNamed("chaos"); known {
+		t.Error("expected an unknown preset to be refused")
+	}
+}
+
+func TestAIProfileFor(t *testing.T) {
+	server := NewBattleServer()
+	if profile, problem := server.aiProfileFor(game.AISeat{}); problem != "" || profile != game.NewDefaultAIProfile() {
+		t.Errorf("expected the built-in profile without AI data, got %+v %q", profile, problem)
+	}
+	if _, problem := server.aiProfileFor(game.AISeat{Difficulty: "hard"}); problem == "" {
+		t.Error("expected other difficulties to be refused without AI data")
+	}
+
+	server.AddContent(&game.ContentDefinitions{
+		AIDifficulties:  map[string]game.AIDifficulty{game.DefaultAIDifficulty: {MinHitChance: 0.25}, "hard": {SeesThroughFog: true}},
+		AIPersonalities: map[string]game.AIPersonality{game.DefaultAIPersonality: {Cover: 1}, "defensive": {Cover: 3}},
+	})
+	profile, problem := server.aiProfileFor(game.AISeat{Difficulty: "hard", Personality: "defensive"})
+	if problem != "" || profile.SeesThroughFog || profile.Weights.Cover != 3 || profile.Personality != "defensive" {
+		t.Errorf("unexpected profile %+v %q", profile, problem)
+	}
+	server.AllowAIToSeeThroughFog(true)
+	if profile, _ = server.aiProfileFor(game.AISeat{Difficulty: "hard"}); !profile.SeesThroughFog {
+		t.Error("expected the hard AI to see through the fog on a server that allows it")
+	}
+	if _, problem = server.aiProfileFor(game.AISeat{Personality: "reckless"}); problem != "Unknown AI personality 'reckless'" {
+		t.Errorf("expected an unknown personality to be refused, got %q", problem)
+	}
+}
+
+func TestHumanAskingForTheHardAIGetsNoRevealedUnits(t *testing.T) {
+	server := NewBattleServer()
+	server.AddContent(&game.ContentDefinitions{
+		AIDifficulties:  map[string]game.AIDifficulty{game.DefaultAIDifficulty: {}, "hard": {SeesThroughFog: true}},
+		AIPersonalities: map[string]game.AIPersonality{game.DefaultAIPersonality: {}},
+	})
+	_, owner := connectAndLogin(t, server, 1, game.LoginMessage{Username: "alice", ProtocolVersion: game.ProtocolVersion})
+	defer owner.Close()
+	_, human := connectAndLogin(t, server, 2, game.LoginMessage{Username: "bob", ProtocolVersion: game.ProtocolVersion})
+	defer human.Close()
+
+	battleGame := newEmptyGame("fog", 1)
+	battleGame.ClientAddUnit(1, &game.UnitInstance{GameUnitID: 1, Owner: 1, Definition: &game.UnitDefinition{}})
+	creator, _ := server.getUser(1)
+	g, _ := server.addGame("fog", battleGame, 0, creator)
+	server.JoinGame(2, game.JoinGameMessage{GameID: "fog", AI: &game.AISeat{Difficulty: "hard"}})
+	expectMessage(t, human, "JoinGameResponse")
+
+	var fogImmune []uint64
+	g.do(func() {
+		battleGame.Start()
+		fogImmune = server.gameStateFor(g, 1).FogImmunePlayers
+		server.SendNextPlayer(g, false)
+	})
+	var nextPlayer game.NextPlayerMessage
+	json.Unmarshal(expectMessage(t, human, "NextPlayer"), &nextPlayer)
+	if !nextPlayer.YourTurn || len(nextPlayer.RevealedUnits) > 0 {
+		t.Errorf("the human got %d enemy units revealed on their turn", len(nextPlayer.RevealedUnits))
+	}
+	if len(fogImmune) > 0 {
+		t.Errorf("the players were told that %v see through the fog", fogImmune)
+	}
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/memmaker/battleground/engine/util"
+	"github.com/memmaker/battleground/game"
+)
+
+type spectatorMessage struct {
+	turn        int
+	messageType []byte
+	message     []byte
+}
+
+// spectatorFeed relays what happens in a game to its spectators. With a turn delay, every message is
+// held back until the game is that many turns further, so spectators can't tell the players what they see.
+type spectatorFeed struct {
+	turnDelay  int
+	turn       int
+	spectators []uint64
+	pending    []spectatorMessage
+	// the last released state and everything released after it, for spectators joining late
+	lastState  *spectatorMessage
+	sinceState []spectatorMessage
+	send       func(userID uint64, messageType, message []byte)
+}
+
+func newSpectatorFeed(turnDelay int, writer func(userID uint64, messageType, message []byte)) *spectatorFeed {
+	return &spectatorFeed{turnDelay: turnDelay, send: writer}
+}
+
+func (f *spectatorFeed) publish(messageType, message []byte) {
+	f.pending = append(f.pending, spectatorMessage{turn: f.turn, messageType: messageType, message: message})
+	f.release(f.turn - f.turnDelay)
+}
+
+func (f *spectatorFeed) publishMessage(message game.Message) {
+	asJson, _ := json.Marshal(message)
+	f.publish([]byte(message.MessageType()), asJson)
+}
+
+func (f *spectatorFeed) nextTurn() {
+	f.turn++
+	f.release(f.turn - f.turnDelay)
+}
+
+// flush releases everything, there is nothing left to hide once the game is over.
+func (f *spectatorFeed) flush() {
+	f.release(f.turn)
+}
+
+func (f *spectatorFeed) release(upToTurn int) {
+	released := 0
+	for _, message := range f.pending {
+		if message.turn > upToTurn {
+			break
+		}
+		released++
+		if string(message.messageType) == (game.SpectatorStateMessage{}).MessageType() {
+			state := message
+			f.lastState = &state
+			f.sinceState = nil
+		} else {
+			f.sinceState = append(f.sinceState, message)
+		}
+		for _, spectatorID := range f.spectators {
+			f.send(spectatorID, message.messageType, message.message)
+		}
+	}
+	f.pending = f.pending[released:]
+}
+
+// addSpectator catches the new spectator up with the released part of the game.
+func (f *spectatorFeed) addSpectator(userID uint64) {
+	if !f.isSpectator(userID) {
+		f.spectators = append(f.spectators, userID)
+	}
+	if f.lastState == nil {
+		return // the game has not started yet
+	}
+	f.send(userID, f.lastState.messageType, f.lastState.message)
+	for _, message := range f.sinceState {
+		f.send(userID, message.messageType, message.message)
+	}
+}
+
+func (f *spectatorFeed) isSpectator(userID uint64) bool {
+	for _, spectatorID := range f.spectators {
+		if spectatorID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *BattleServer) SpectateGame(userID uint64, msg game.SpectateGameMessage) {
+	b.lock.Lock()
+	user, exists := b.connectedClients[userID]
+	if !exists {
+		b.lock.Unlock()
+		return
+	}
+	if !game.HasCapability(user.capabilities, game.CapabilitySpectate) {
+		b.lock.Unlock()
+		b.respond(user, "SpectateGameResponse", game.ActionResponse{Success: false, Message: "Your client does not support spectating"})
+		return
+	}
+	if user.activeGame != "" || user.spectating != "" {
+		b.lock.Unlock()
+		b.respond(user, "SpectateGameResponse", game.ActionResponse{Success: false, Message: "You are already in a game"})
+		return
+	}
+	runningGame, exists := b.runningGames[msg.GameID]
+	if !exists {
+		b.lock.Unlock()
+		b.respond(user, "SpectateGameResponse", game.ActionResponse{Success: false, Message: "Game does not exist"})
+		return
+	}
+	user.spectating = msg.GameID
+	user.inLobby = false
+	b.respond(user, "SpectateGameResponse", game.ActionResponse{Success: true, Message: fmt.Sprintf("Spectating with a delay of %d turns", runningGame.feed.turnDelay)})
+	b.lock.Unlock()
+
+	if !runningGame.do(func() { runningGame.feed.addSpectator(userID) }) {
+		b.lock.Lock()
+		b.stopSpectating(user) // the game ended in the meantime
+		b.lock.Unlock()
+		return
+	}
+	util.LogServerGameInfo(fmt.Sprintf("[BattleServer] Client(%d) is now spectating game %s", userID, msg.GameID))
+}
+
+// stopSpectating expects the caller to hold the server lock. The feed skips users that watch something else,
+// so they don't have to be removed from it right away.
+func (b *BattleServer) stopSpectating(user *UserConnection) {
+	user.spectating = ""
+}
+
+// spectatorWriter sends the messages of a feed to those spectators that are still watching the game.
+func (b *BattleServer) spectatorWriter(gameID string) func(userID uint64, messageType, message []byte) {
+	return func(userID uint64, messageType, message []byte) {
+		b.lock.Lock()
+		spectator, exists := b.connectedClients[userID]
+		isWatching := exists && spectator.spectating == gameID
+		b.lock.Unlock()
+		if isWatching {
+			b.writeToClient(spectator, messageType, message)
+		}
+	}
+}
+
+func (b *BattleServer) publishSpectatorState(g *gameActor) {
+	g.feed.publishMessage(b.spectatorStateFor(g))
+}
+
+func (b *BattleServer) spectatorStateFor(g *gameActor) game.SpectatorStateMessage {
+	gameInstance := g.instance
+	units := make([]*game.UnitInstance, 0, len(gameInstance.GetAllUnits()))
+	for _, unit := range gameInstance.GetAllUnits() {
+		units = append(units, unit)
+	}
+	return game.SpectatorStateMessage{
+		GameID:           g.id,
+		MapFile:          gameInstance.GetMapFile(),
+		PlayerFactionMap: gameInstance.GetPlayerFactions(),
+		PlayerNameMap:    b.playerNames(gameInstance.GetPlayerIDs()),
+		Units:            units,
+		LOSMatrix:        gameInstance.GetCompleteLOSMatrix(),
+		PressureMatrix:   gameInstance.GetPressureMatrix(),
+		BlockEffects:     gameInstance.GetActiveBlockEffects(),
+		DestroyedBlocks:  gameInstance.GetDestroyedBlocks(),
+		BlockStates:      gameInstance.GetChangedBlockStates(),
+		MissionDetails:   gameInstance.GetMissionDetails(),
+		Rules:            gameInstance.GetRules(),
+		BlockMaterials:   gameInstance.GetBlockMaterials(),
+		CurrentPlayer:    gameInstance.GetCurrentPlayerID(),
+		Turn:             gameInstance.GetTurnCounter(),
+	}
+}
+
+// closeSpectatorFeed shows the spectators the rest of the game and the result.
+func (b *BattleServer) closeSpectatorFeed(g *gameActor, result game.GameOverMessage) {
+	g.feed.flush()
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, spectatorID := range g.feed.spectators {
+		if spectator, isConnected := b.connectedClients[spectatorID]; isConnected && spectator.spectating == g.id {
+			b.stopSpectating(spectator)
+			b.respond(spectator, "GameOver", result)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"github.com/memmaker/battleground/game"
+	"testing"
+)
+
+type sentMessage struct {
+	userID      uint64
+	messageType string
+}
+
+func recordingFeed(turnDelay int) (*spectatorFeed, *[]sentMessage) {
+	sent := make([]sentMessage, 0)
+	feed := newSpectatorFeed(turnDelay, func(userID uint64, messageType, message []byte) {
+		sent = append(sent, sentMessage{userID: userID, messageType: string(messageType)})
+	})
+	return feed, &sent
+}
+
+func TestSpectatorFeedIsLiveWithoutDelay(t *testing.T) {
+	feed, sent := recordingFeed(0)
+	feed.addSpectator(7)
+	feed.publishMessage(game.VisualBeginOverwatch{})
+	if len(*sent) != 1 || (*sent)[0].userID != 7 {
+		t.Errorf("got %v, want the message sent to spectator 7 right away", *sent)
+	}
+}
+
+func TestSpectatorFeedHoldsBackMessages(t *testing.T) {
+	feed, sent := recordingFeed(2)
+	feed.addSpectator(7)
+	feed.publishMessage(game.SpectatorStateMessage{})
+	feed.publishMessage(game.VisualBeginOverwatch{})
+	feed.nextTurn()
+	if len(*sent) != 0 {
+		t.Fatalf("got %v after one turn, want nothing", *sent)
+	}
+	feed.nextTurn()
+	if len(*sent) != 2 {
+		t.Fatalf("got %v after two turns, want both messages", *sent)
+	}
+}
+
+func TestSpectatorFeedCatchesUpLateSpectators(t *testing.T) {
+	feed, sent := recordingFeed(0)
+	feed.publishMessage(game.SpectatorStateMessage{})
+	feed.publishMessage(game.VisualBeginOverwatch{})
+	feed.nextTurn()
+	feed.publishMessage(game.SpectatorStateMessage{})
+	feed.publishMessage(game.NextPlayerMessage{})
+
+	feed.addSpectator(7)
+	want := []string{"SpectatorState", "NextPlayer"}
+	if len(*sent) != len(want) {
+		t.Fatalf("got %v, want %v", *sent, want)
+	}
+	for i, messageType := range want {
+		if (*sent)[i].messageType != messageType {
+			t.Errorf("message %d is %s, want %s", i, (*sent)[i].messageType, messageType)
+		}
+	}
+}
+
+func TestSpectateGameOfADroppedUserIsIgnored(t *testing.T) {
+	NewBattleServer().SpectateGame(42, game.SpectateGameMessage{GameID: "gone"})
+}
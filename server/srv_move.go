@@ -5,13 +5,17 @@ import (
 	"github.com/memmaker/battleground/engine/util"
 	"github.com/memmaker/battleground/engine/voxel"
 	"github.com/memmaker/battleground/game"
+	"slices"
 )
 
 type ServerActionMove struct {
 	engine     *game.GameInstance
 	gameAction *game.ActionMove
 	unit       *game.UnitInstance
-	targets    []voxel.Int3
+	targets    []voxel.Int3 // targets are the waypoints of the route, the last one is the destination
+	route      []voxel.Int3
+	routeCosts []float64
+	problem    string
 }
 
 func (a ServerActionMove) SetAPCost(newCost int) {
@@ -23,45 +27,34 @@ func (a ServerActionMove) IsTurnEnding() bool {
 }
 
 func (a ServerActionMove) IsValid() (bool, string) {
-	if len(a.targets) != 1 {
-		return false, fmt.Sprintf("Expected 1 movement target for now, got %d", len(a.targets))
-	}
-	for _, target := range a.targets {
-		if !a.gameAction.IsValidTarget(target) {
-			return false, fmt.Sprintf("Target %s is not valid", target.ToString())
-		}
-
-		dist := a.gameAction.GetCost(target)
-		movesLeft := a.unit.MovesLeft()
-
-		if dist > float64(movesLeft) {
-			return false, fmt.Sprintf("Targets %s is too far away (dist: %0.2f, moves left: %d)", target.ToString(), dist, movesLeft)
-		}
+	if a.problem != "" {
+		return false, a.problem
 	}
 	return true, ""
 }
 
 func NewServerActionMove(engine *game.GameInstance, unit *game.UnitInstance, targets []voxel.Int3) *ServerActionMove {
-	return &ServerActionMove{
+	a := &ServerActionMove{
 		engine:     engine,
-		gameAction: game.NewActionMove(engine.GetVoxelMap(), unit),
+		gameAction: game.NewActionMove(engine.GetVoxelMap(), unit, engine),
 		unit:       unit,
 		targets:    targets,
 	}
+	a.route, a.routeCosts, a.problem = a.gameAction.GetRoute(targets)
+	return a
 }
 func (a ServerActionMove) Execute(mb *game.MessageBuffer) {
 	currentPos := a.unit.GetBlockPosition()
-	moveTarget := a.targets[0]
-	distance := a.gameAction.GetCost(moveTarget)
-	util.LogServerUnitDebug(fmt.Sprintf("Moving %s(%d): from %s to %s (dist: %0.2f)", a.unit.GetName(), a.unit.UnitID(), currentPos.ToString(), moveTarget.ToString(), distance))
+	moveTarget := a.targets[len(a.targets)-1]
+	distance := a.routeCosts[len(a.routeCosts)-1]
+	util.LogServerUnitDebug(fmt.Sprintf("Moving %s(%d): from %s to %s via %d waypoints (dist: %0.2f)", a.unit.GetName(), a.unit.UnitID(), currentPos.ToString(), moveTarget.ToString(), len(a.targets)-1, distance))
 
-	foundPath := a.gameAction.GetPath(moveTarget)
+	foundPath := slices.Clone(a.route)
 	destination := foundPath[len(foundPath)-1]
 	controller := a.unit.ControlledBy()
 
 	var triggeredOverwatchBy []*game.UnitInstance
 	var visibles []*game.UnitInstance
-	var invisibles []*game.UnitInstance
 	var unitForward voxel.Int3
 
 	if len(foundPath) > 1 {
@@ -115,7 +108,7 @@ func (a ServerActionMove) Execute(mb *game.MessageBuffer) {
 
 		// check if we can spot a new enemy unit from here
 		var newContact bool
-		if visibles, invisibles, newContact = a.engine.GetLOSChanges(a.unit, pos); newContact {
+		if visibles, _, newContact = a.engine.GetLOSChanges(a.unit, pos); newContact {
 			util.LogServerUnitDebug(fmt.Sprintf(" --> can spot %d new enemies from here: ", len(visibles)))
 			destination = pos
 			foundPath = foundPath[:index+1]
@@ -130,36 +123,14 @@ func (a ServerActionMove) Execute(mb *game.MessageBuffer) {
 	}
 
 	// DO THE MOVEMENT
-	moveCost := a.gameAction.GetCost(destination)
+	moveCost := a.routeCosts[len(foundPath)-1]
 	a.unit.UseMovement(moveCost)
 	a.unit.SetForward(unitForward)
 	a.unit.SetBlockPositionAndUpdateStance(destination)
 
 	util.LogServerUnitDebug(fmt.Sprintf(" --> FINAL: %s(%d) is now at %s facing %s", a.unit.GetName(), a.unit.UnitID(), a.unit.GetBlockPosition().ToString(), a.unit.GetForward2DCardinal().ToString()))
 
-	// apply changes to LOS
-	for _, unit := range visibles {
-		a.engine.SetLOS(a.unit.UnitID(), unit.UnitID(), true)
-	}
-	for _, unit := range invisibles {
-		a.engine.SetLOS(a.unit.UnitID(), unit.UnitID(), false)
-	}
-
-	for _, enemyUserID := range mb.UserIDs() {
-		if enemyUserID == a.unit.ControlledBy() {
-			continue
-		}
-		seenByUser, hiddenToUser := a.engine.GetReverseLOSChangesForUser(enemyUserID, a.unit)
-		// apply changes to LOS
-		for _, unit := range seenByUser {
-			a.engine.SetLOS(unit, a.unit.UnitID(), true)
-		}
-		for _, unit := range hiddenToUser {
-			a.engine.SetLOS(unit, a.unit.UnitID(), false)
-		}
-	}
-
-	a.engine.UpdatePressureAfterMove(a.unit)
+	a.engine.UpdateLOSAfterMove(a.unit)
 
 	losMatrixForMovingPlayer, visibleEnemies := a.engine.GetLOSState(a.unit.ControlledBy())
 	newPressureState := a.engine.GetPressureMatrix()
@@ -175,6 +146,17 @@ func (a ServerActionMove) Execute(mb *game.MessageBuffer) {
 		Forward:        unitForward,
 	})
 
+	// spectators see the whole path, no matter who could see the unit
+	mb.AddMessageForSpectators(game.VisualOwnUnitMoved{
+		UnitID:         a.unit.UnitID(),
+		Path:           foundPath,
+		Cost:           moveCost,
+		EndPosition:    destination,
+		LOSMatrix:      a.engine.GetCompleteLOSMatrix(),
+		PressureMatrix: newPressureState,
+		Forward:        unitForward,
+	})
+
 	for enemyUserID, allPaths := range pathPartsPerUser {
 		if len(allPaths[0]) > 0 {
 			for len(allPaths) > 0 && len(allPaths[len(allPaths)-1]) == 0 {
@@ -64,7 +64,7 @@ func NewServerActionFreeShot(g *game.GameInstance, unit *game.UnitInstance, camP
 		util.LogServerUnitDebug(fmt.Sprintf("[ServerActionShot] %s(%d) fires a shot from (%0.2f, %0.2f, %0.2f) in direction %0.2f, %0.2f", unit.GetName(), unit.UnitID(), camPos.X(), camPos.Y(), camPos.Z(), targetAngle[0], targetAngle[1]))
 		s.lastAimDirection = camera.GetForward()
 
-		startRay, endRay := camera.GetRandomRayInCircleFrustum(s.finalShotAccuracy())
+		startRay, endRay := camera.GetRandomRayInCircleFrustum(g.GetRandom(), s.finalShotAccuracy())
 		direction := endRay.Sub(startRay).Normalize()
 
 		rayCalls = rayCalls + 1%len(targetAngles)
@@ -116,7 +116,7 @@ func NewServerActionSnapShot(g *game.GameInstance, unit *game.UnitInstance, targ
 		camera.SetLookTarget(targetLocation)
 		s.lastAimDirection = camera.GetForward()
 
-		startRay, endRay := camera.GetRandomRayInCircleFrustum(s.finalShotAccuracy())
+		startRay, endRay := camera.GetRandomRayInCircleFrustum(g.GetRandom(), s.finalShotAccuracy())
 		direction := endRay.Sub(startRay).Normalize()
 
 		rayCalls = rayCalls + 1%len(targets)
@@ -171,30 +171,44 @@ func (a *ServerActionShot) simulateOneProjectile() game.VisualProjectile {
 
 	rayHitInfo := a.engine.RayCastFreeAim(origin, endOfRay, a.unit)
 	unitHitID := int64(-1)
-	var hitBlocks []voxel.Int3
+	var hitBlocks []game.BlockHit
+	visitedBlocks := rayHitInfo.VisitedBlocks
+	penetrationLoss := 0
+	// the projectile damages every block in its way and passes through the penetrable ones
+	for penetrations := 0; rayHitInfo.Hit && !rayHitInfo.HitUnit() && penetrations < game.MaxPenetrations; penetrations++ {
+		blockPosHit := rayHitInfo.HitInfo3D.CollisionGridPosition
+		blockDef := a.engine.GetBlockDefAt(blockPosHit)
+		if blockDef.OnDamageReceived == nil {
+			util.LogServerUnitDebug(fmt.Sprintf("[ServerActionShot] MISS -> World Collision at %s hit %s", blockPosHit.ToString(), blockDef.UniqueName))
+			break
+		}
+		material := a.engine.GetBlockMaterial(blockPosHit)
+		blockDamage := projectileBaseDamage - penetrationLoss
+		blockDef.OnDamageReceived(blockPosHit, blockDamage)
+		hitBlocks = append(hitBlocks, game.BlockHit{Position: blockPosHit, Damage: blockDamage})
+		util.LogServerUnitDebug(fmt.Sprintf("[ServerActionShot] HIT -> Block %s at %s with %d damage", blockDef.UniqueName, blockPosHit.ToString(), blockDamage))
+		if !material.Penetrable || blockDamage-material.PenetrationLoss <= 0 {
+			break
+		}
+		penetrationLoss += material.PenetrationLoss
+		behindBlock := game.PenetrationExit(origin, direction, blockPosHit)
+		rayHitInfo = a.engine.RayCastFreeAim(behindBlock, endOfRay, a.unit)
+		rayHitInfo.Origin = origin
+		rayHitInfo.Distance = float64(rayHitInfo.CollisionWorldPosition.Sub(origin).Len())
+		visitedBlocks = append(visitedBlocks, rayHitInfo.VisitedBlocks...)
+	}
+	rayHitInfo.VisitedBlocks = visitedBlocks
 	projectileDestination := rayHitInfo.HitInfo3D.CollisionWorldPosition
 
 	if rayHitInfo.HitUnit() {
 		unitHitID = int64(rayHitInfo.UnitHit.UnitID())
 		util.LogServerUnitDebug(fmt.Sprintf("[ServerActionShot] Unit was HIT %s(%d) -> %s", rayHitInfo.UnitHit.GetName(), unitHitID, rayHitInfo.BodyPart))
         if !effectInsteadOfDamage {
-            projectileBaseDamage, lethal = a.engine.HandleUnitHitWithProjectile(a.unit, a.damageModifier, rayHitInfo)
+            projectileBaseDamage, lethal = a.engine.HandleUnitHitWithProjectile(a.unit, a.damageModifier, penetrationLoss, rayHitInfo)
         }
-	} else {
-		if rayHitInfo.Hit {
-			blockPosHit := rayHitInfo.HitInfo3D.CollisionGridPosition
-			blockDef := a.engine.GetBlockDefAt(blockPosHit)
-			if blockDef.OnDamageReceived != nil {
-				blockDef.OnDamageReceived(blockPosHit, projectileBaseDamage)
-				hitBlocks = append(hitBlocks, blockPosHit)
-				util.LogServerUnitDebug(fmt.Sprintf("[ServerActionShot] HIT -> Block with on damage effect %s at %s", blockDef.UniqueName, blockPosHit.ToString()))
-			} else {
-				util.LogServerUnitDebug(fmt.Sprintf("[ServerActionShot] MISS -> World Collision at %s hit %s", rayHitInfo.HitInfo3D.CollisionGridPosition.ToString(), blockDef.UniqueName))
-			}
-		} else {
-			util.LogServerUnitDebug(fmt.Sprintf("[ServerActionShot] MISS -> No Collision, out of weapon range"))
-			projectileDestination = endOfRay
-		}
+	} else if !rayHitInfo.Hit {
+		util.LogServerUnitDebug(fmt.Sprintf("[ServerActionShot] MISS -> No Collision, out of weapon range"))
+		projectileDestination = endOfRay
 	}
     finalBlockPosition := voxel.PositionToGridInt3(projectileDestination)
 	projectile := game.VisualProjectile{
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"fmt"
+	"github.com/memmaker/battleground/engine/util"
+	"github.com/memmaker/battleground/game"
+	"time"
+)
+
+// turnClock enforces the time controls of a game. It belongs to the game goroutine,
+// the timers only hand their work back to it.
+type turnClock struct {
+	control       game.TimeControl
+	banks         map[uint64]time.Duration // player id -> time left on the chess clock
+	currentPlayer uint64
+	turnStarted   time.Time
+	turn          int // tells the timers of an earlier turn that they are late
+	warning       *time.Timer
+	expiry        *time.Timer
+}
+
+func newTurnClock(control game.TimeControl) *turnClock {
+	return &turnClock{control: control, banks: make(map[uint64]time.Duration)}
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
+
+// endTurn stops the clock of the current player and books the used time.
+func (c *turnClock) endTurn() {
+	c.stopTimers()
+	if c.turnStarted.IsZero() || c.control.Mode != game.TimeControlChessClock {
+		return
+	}
+	bank := c.banks[c.currentPlayer] - time.Since(c.turnStarted)
+	if bank < 0 {
+		bank = 0
+	}
+	c.banks[c.currentPlayer] = bank + seconds(c.control.IncrementSeconds)
+}
+
+// timeFor tells how long the player may take for the next turn.
+func (c *turnClock) timeFor(playerID uint64) time.Duration {
+	if c.control.Mode == game.TimeControlPerTurn {
+		return seconds(c.control.TurnSeconds)
+	}
+	bank, hasBank := c.banks[playerID]
+	if !hasBank {
+		bank = seconds(c.control.BankSeconds)
+		c.banks[playerID] = bank
+	}
+	return bank
+}
+
+// startTurn starts the clock for the player. onWarning and onExpiry are called from a timer goroutine
+// with the number of the turn they were set up for.
+func (c *turnClock) startTurn(playerID uint64, onWarning, onExpiry func(turn int)) time.Duration {
+	c.stopTimers()
+	c.turn++
+	c.currentPlayer = playerID
+	c.turnStarted = time.Now()
+	timeLeft := c.timeFor(playerID)
+
+	turn := c.turn
+	warnAfter := timeLeft - seconds(c.control.WarningSeconds)
+	if c.control.WarningSeconds > 0 && warnAfter > 0 {
+		c.warning = time.AfterFunc(warnAfter, func() { onWarning(turn) })
+	}
+	c.expiry = time.AfterFunc(timeLeft, func() { onExpiry(turn) })
+	return timeLeft
+}
+
+func (c *turnClock) timeLeft() time.Duration {
+	left := c.timeFor(c.currentPlayer) - time.Since(c.turnStarted)
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+// bankSeconds is nil for a fixed time per turn.
+func (c *turnClock) bankSeconds() map[uint64]float64 {
+	if c.control.Mode != game.TimeControlChessClock {
+		return nil
+	}
+	banks := make(map[uint64]float64)
+	for playerID, bank := range c.banks {
+		banks[playerID] = bank.Seconds()
+	}
+	return banks
+}
+
+func (c *turnClock) stopTimers() {
+	if c.warning != nil {
+		c.warning.Stop()
+		c.warning = nil
+	}
+	if c.expiry != nil {
+		c.expiry.Stop()
+		c.expiry = nil
+	}
+}
+
+// startTurnClock runs the clock for the next turn, if the game has time controls.
+func (b *BattleServer) startTurnClock(g *gameActor, nextPlayer uint64) (float64, map[uint64]float64) {
+	if g.clock == nil {
+		return 0, nil
+	}
+	g.clock.endTurn()
+	timeLeft := g.clock.startTurn(nextPlayer,
+		func(turn int) { g.do(func() { b.warnTurnTime(g, turn) }) },
+		func(turn int) { g.do(func() { b.turnTimedOut(g, turn) }) },
+	)
+	return timeLeft.Seconds(), g.clock.bankSeconds()
+}
+
+func (b *BattleServer) warnTurnTime(g *gameActor, turn int) {
+	if g.clock.turn != turn {
+		return // the player finished the turn in time
+	}
+	currentPlayer := g.clock.currentPlayer
+	secondsLeft := g.clock.timeLeft().Seconds()
+	for _, playerID := range g.instance.GetPlayerIDs() {
+		b.respondTo(playerID, game.TurnTimeWarningMessage{
+			CurrentPlayer: currentPlayer,
+			YourTurn:      playerID == currentPlayer,
+			SecondsLeft:   secondsLeft,
+		})
+	}
+}
+
+func (b *BattleServer) turnTimedOut(g *gameActor, turn int) {
+	if g.clock.turn != turn {
+		return
+	}
+	util.LogGameInfo(fmt.Sprintf("[BattleServer] Player %d ran out of time in game %s", g.clock.currentPlayer, g.id))
+	g.recorder.record(game.ReplayEventCommand, g.clock.currentPlayer, "TurnTimedOut", nil)
+	b.endTurn(g, true)
+}
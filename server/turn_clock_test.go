@@ -0,0 +1,57 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/memmaker/battleground/game"
+	"testing"
+	"time"
+)
+
+func TestChessClockBooksUsedTimeAndIncrement(t *testing.T) {
+	clock := newTurnClock(game.TimeControl{Mode: game.TimeControlChessClock, BankSeconds: 10, IncrementSeconds: 2})
+	ignore := func(turn int) {}
+	if timeLeft := clock.startTurn(1, ignore, ignore); timeLeft != 10*time.Second {
+		t.Fatalf("got %s for the first turn, want the whole bank", timeLeft)
+	}
+	time.Sleep(50 * time.Millisecond)
+	clock.endTurn()
+
+	bank := clock.bankSeconds()[1]
+	if bank < 11.5 || bank > 11.95 {
+		t.Errorf("bank is %0.2f seconds, want the increment minus the used time added to 10", bank)
+	}
+}
+
+func TestTurnEndsWhenTimeRunsOut(t *testing.T) {
+	server := NewBattleServer()
+	_, con := connectAndLogin(t, server, 1, game.LoginMessage{Username: "tester", ProtocolVersion: game.ProtocolVersion})
+	defer con.Close()
+
+	details := &game.MissionDetails{TimeControl: game.TimeControl{Mode: game.TimeControlPerTurn, TurnSeconds: 0.05, WarningSeconds: 0.04}}
+	gameInstance := newEmptyGameWithDetails("blitz", 1, details)
+	gameInstance.AddPlayer(2)
+	gameInstance.Start()
+	user, _ := server.getUser(1)
+	runningGame, _ := server.addGame("blitz", gameInstance, 0, user)
+	runningGame.do(func() { server.SendNextPlayer(runningGame, false) })
+
+	want := []string{"NextPlayer", "TurnTimeWarning", "NextPlayer"}
+	var last game.NextPlayerMessage
+	for _, wantedType := range want {
+		messageType, message, err := game.ReadFrame(con)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if messageType != wantedType {
+			t.Fatalf("got %s, want %s", messageType, wantedType)
+		}
+		if messageType == "NextPlayer" {
+			if err = json.Unmarshal(message, &last); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if !last.PreviousTimedOut || last.SecondsLeft != 0.05 {
+		t.Errorf("got %+v, want a timed out turn followed by a new one of 0.05 seconds", last)
+	}
+}
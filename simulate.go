@@ -0,0 +1,162 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/memmaker/battleground/game"
+	"github.com/memmaker/battleground/server"
+	"os"
+	"strings"
+	"time"
+)
+
+// simulationSide is what the flags say about one side of the simulated games.
+type simulationSide struct {
+	faction     string
+	squad       string
+	difficulty  string
+	personality string
+}
+
+// runSimulation plays games between two AI clients on an in-process server, without any rendering or networking,
+// and prints the summed up statistics. It is used for balancing the weapons. The games are seeded from the clock,
+// so two runs only agree within the statistical noise.
+func runSimulation(args []string) error {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	games := flags.Int("games", 10, "number of games to play")
+	mapName := flags.String("map", "map", "map file of the games")
+	mission := flags.String("mission", "deathmatch", "mission of the games: deathmatch or defend")
+	ruleset := flags.String("ruleset", game.DefaultRulesetName, "ruleset of the games")
+	maxTurns := flags.Int("max-turns", 60, "games that take more turns are stopped and counted as a draw")
+	sides := [2]*simulationSide{{}, {}}
+	for index, defaultFaction := range []string{"X-Com", "Deep Ones"} {
+		prefix := fmt.Sprintf("side%d-", index+1)
+		side := sides[index]
+		flags.StringVar(&side.faction, prefix+"faction", defaultFaction, "faction of the side")
+		flags.StringVar(&side.squad, prefix+"squad", "M16 Rifle,Steyr SSG 69+Smoke Grenade,Mossberg 500", "weapons of the units, separated by commas, items follow their weapon after a '+'")
+		flags.StringVar(&side.difficulty, prefix+"difficulty", game.DefaultAIDifficulty, "AI difficulty of the side")
+		flags.StringVar(&side.personality, prefix+"personality", game.DefaultAIPersonality, "AI personality of the side")
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var details *game.MissionDetails
+	switch *mission {
+	case "deathmatch":
+		details = game.NewRandomDeathmatch()
+	case "defend":
+		details = game.NewRandomDefend()
+	default:
+		return fmt.Errorf("unknown mission '%s'", *mission)
+	}
+
+	mods := loadMods()
+	aiSides := make([]game.AISide, len(sides))
+	for index, side := range sides {
+		units, err := squadFromFlag(mods.Content, side.faction, side.squad)
+		if err != nil {
+			return err
+		}
+		aiSides[index] = game.AISide{
+			Faction: side.faction,
+			Units:   units,
+			Seat:    game.AISeat{Difficulty: side.difficulty, Personality: side.personality},
+		}
+	}
+
+	// no replay directory, the games are not worth keeping
+	battleServer := server.NewBattleServer()
+	battleServer.AddMap("Dev Map", *mapName)
+	battleServer.AddMods(mods)
+	battleServer.AllowAIToSeeThroughFog(true)
+	transport := game.NewMemoryTransport()
+	defer transport.Close()
+	go battleServer.Serve(transport)
+
+	batch := game.NewBatchStatistics()
+	for match := 0; match < *games; match++ {
+		stats, err := simulateMatch(transport, mods, match, *mapName, details, *ruleset, aiSides, *maxTurns)
+		if err != nil {
+			return fmt.Errorf("game %d: %w", match+1, err)
+		}
+		batch.Add(stats)
+		fmt.Printf("Game %d/%d: winner '%s' after %d turns\n", match+1, *games, stats.Winner, stats.Turns)
+	}
+	fmt.Println()
+	batch.WriteReport(os.Stdout)
+	return nil
+}
+
+// simulateMatch plays one game. The sides take turns in creating the game, so both get to start.
+func simulateMatch(transport game.Transport, mods *game.ModSet, match int, mapName string, details *game.MissionDetails, ruleset string, sides []game.AISide, maxTurns int) (game.MatchStatistics, error) {
+	gameID := fmt.Sprintf("simulation %d", match+1)
+	creator, joiner := sides[match%2], sides[(match+1)%2]
+	creator.Username = fmt.Sprintf("ai %d-1", match+1)
+	joiner.Username = fmt.Sprintf("ai %d-2", match+1)
+
+	observer := game.NewMatchObserver()
+	spectator := game.NewConnectionWithHandler(transport, observer.OnServerMessage)
+	spectator.SetModSet(mods)
+	defer spectator.Close()
+	if err := spectator.Login(fmt.Sprintf("observer %d", match+1)); err != nil {
+		return game.MatchStatistics{}, err
+	}
+
+	first := game.NewDummyClient(transport, mods)
+	defer first.Close()
+	if err := first.CreateMatch(mapName, gameID, details, ruleset, creator); err != nil {
+		return game.MatchStatistics{}, err
+	}
+	if err := spectator.SpectateGame(gameID); err != nil {
+		return game.MatchStatistics{}, err
+	}
+	second := game.NewDummyClient(transport, mods)
+	defer second.Close()
+	if err := second.JoinMatch(gameID, joiner); err != nil {
+		return game.MatchStatistics{}, err
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-observer.Done():
+			return observer.Statistics(), nil
+		case <-ticker.C:
+			if stats := observer.Statistics(); stats.Turns > maxTurns {
+				stats.Winner = ""
+				return stats, nil
+			}
+		}
+	}
+}
+
+// squadFromFlag reads a squad like "M16 Rifle+Smoke Grenade,Steyr SSG 69". All units are of the first unit
+// type of the faction.
+func squadFromFlag(content *game.ContentDefinitions, factionName string, squad string) ([]game.UnitChoice, error) {
+	var unitType string
+	found := false
+	for _, faction := range content.Factions {
+		if faction.Name == factionName && len(faction.Units) > 0 {
+			unitType, found = faction.Units[0].Name, true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown faction '%s'", factionName)
+	}
+	var units []game.UnitChoice
+	for index, unit := range strings.Split(squad, ",") {
+		weaponAndItems := strings.Split(unit, "+")
+		for i := range weaponAndItems {
+			weaponAndItems[i] = strings.TrimSpace(weaponAndItems[i])
+		}
+		units = append(units, game.UnitChoice{
+			UnitType: unitType,
+			Name:     fmt.Sprintf("%s %d", factionName, index+1),
+			Weapon:   weaponAndItems[0],
+			Items:    weaponAndItems[1:],
+		})
+	}
+	return units, nil
+}